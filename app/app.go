@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -22,7 +23,16 @@ func Start(cfg Configuration) {
 
 	logger.Info("application is starting...")
 
-	server := &http.Server{Addr: ":8080", Handler: HTTPHandler(cfg)}
+	svc := initServices(cfg)
+	svc.start()
+
+	// requests still running when the shutdown times out are cancelled, with their oEmbed calls
+	requests, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        ":8080",
+		Handler:     httpHandler(cfg, svc),
+		BaseContext: func(net.Listener) context.Context { return requests },
+	}
 
 	// handles graceful shutdown
 	go func() {
@@ -31,16 +41,22 @@ func Start(cfg Configuration) {
 		}
 	}()
 
-	gracefulShutdown(server, 10*time.Second)
+	gracefulShutdown(server, svc, cancelRequests, 10*time.Second)
 }
 
 // HTTPHandler returns the top level HttpHandler including all the middlewares
+// Background services are started and run until the process exits
 func HTTPHandler(cfg Configuration) http.Handler {
+	svc := initServices(cfg)
+	svc.start()
+
+	return httpHandler(cfg, svc)
+}
+
+func httpHandler(cfg Configuration, svc *services) http.Handler {
 	sessionStore := initSessionStore()
 	csrfProtection := initCSRFProtection(cfg)
-	db := initDB(cfg.DBConfig)
-	bookmarksRepo := initBookmarksRepo(db)
-	oembedFetcher := initOembedFetcher(logger)
+	bookmarksRepo, usersRepo := svc.bookmarks, svc.users
 
 	r := mux.NewRouter()
 
@@ -58,13 +74,35 @@ func HTTPHandler(cfg Configuration) http.Handler {
 	apiPipeline := middlewares.Pipe(
 		defaultPipeline,
 		middlewares.BasicAuth(cfg.BasicAuthUsers),
+		middlewares.CurrentUser(usersRepo),
+	)
+
+	// This is the pipeline used by the admin endpoints
+	adminPipeline := middlewares.Pipe(
+		apiPipeline,
+		middlewares.Admin(cfg.AdminUsers),
+	)
+
+	// This is the pipeline used by the public pages of the web interface (login)
+	publicWebPipeline := middlewares.Pipe(
+		defaultPipeline,
+		middlewares.Session(sessionStore),
+		csrfProtection,
 	)
 
 	// This is the pipeline used by the web interface
 	webPipeline := middlewares.Pipe(
+		publicWebPipeline,
+		middlewares.SessionAuth("/web/login"),
+		middlewares.CurrentUser(usersRepo),
+	)
+
+	// This is the pipeline used by the resources shared by the api and the web interface
+	sharedPipeline := middlewares.Pipe(
 		defaultPipeline,
 		middlewares.Session(sessionStore),
-		csrfProtection,
+		middlewares.SessionOrBasicAuth(cfg.BasicAuthUsers),
+		middlewares.CurrentUser(usersRepo),
 	)
 
 	r.Handle("/healthcheck",
@@ -78,26 +116,104 @@ func HTTPHandler(cfg Configuration) http.Handler {
 		Methods("GET").
 		Name("get_bookmarks")
 
+	// must be declared before /bookmarks/{id}
+	r.Handle("/bookmarks/search",
+		apiPipeline(handlers.SearchBookmarks(bookmarksRepo))).
+		Methods("GET").
+		Name("search_bookmarks")
+
+	// the web interface links to the export, so it accepts the session too
+	r.Handle("/bookmarks/export",
+		sharedPipeline(handlers.GetExportBookmarks(bookmarksRepo))).
+		Methods("GET").
+		Name("get_bookmarks_export")
+
+	r.Handle("/bookmarks/import",
+		apiPipeline(handlers.PostImportBookmarks(bookmarksRepo, svc.enrichment))).
+		Methods("POST").
+		Name("post_bookmarks_import")
+
 	r.Handle("/bookmarks/{id}",
 		apiPipeline(handlers.GetBookmark(bookmarksRepo))).
 		Methods("GET").
 		Name("get_bookmark")
 
 	r.Handle("/bookmarks",
-		apiPipeline(handlers.PostBookmark(bookmarksRepo, oembedFetcher))).
+		apiPipeline(handlers.PostBookmark(bookmarksRepo, svc.enrichment))).
 		Methods("POST").
 		Name("post_bookmarks")
 
 	r.Handle("/bookmarks/{id}",
-		apiPipeline(handlers.DeleteBookmark(bookmarksRepo))).
+		apiPipeline(handlers.PatchBookmark(bookmarksRepo, svc.enrichment, svc.thumbnails))).
+		Methods("PATCH").
+		Name("patch_bookmark")
+
+	r.Handle("/bookmarks/{id}",
+		apiPipeline(handlers.DeleteBookmark(bookmarksRepo, svc.thumbnails))).
 		Methods("DELETE").
 		Name("delete_bookmark")
 
+	r.Handle("/bookmarks/{id}/refresh",
+		apiPipeline(handlers.PostRefreshBookmark(bookmarksRepo, svc.refresher))).
+		Methods("POST").
+		Name("post_bookmark_refresh")
+
 	r.Handle("/bookmarks/{id}/keywords",
 		apiPipeline(handlers.PutBookmarkKeywords(bookmarksRepo))).
 		Methods("PUT").
 		Name("put_bookmark_keywords")
 
+	r.Handle("/keywords",
+		apiPipeline(handlers.ListKeywords(bookmarksRepo))).
+		Methods("GET").
+		Name("get_keywords")
+
+	r.Handle("/keywords/{name}",
+		apiPipeline(handlers.PatchKeyword(bookmarksRepo))).
+		Methods("PATCH").
+		Name("patch_keyword")
+
+	r.Handle("/keywords/{name}",
+		apiPipeline(handlers.DeleteKeyword(bookmarksRepo))).
+		Methods("DELETE").
+		Name("delete_keyword")
+
+	r.Handle("/keywords/{name}/merge",
+		apiPipeline(handlers.PostMergeKeyword(bookmarksRepo))).
+		Methods("POST").
+		Name("post_keyword_merge")
+
+	r.Handle("/synonyms",
+		apiPipeline(handlers.ListSynonyms(bookmarksRepo))).
+		Methods("GET").
+		Name("get_synonyms")
+
+	r.Handle("/synonyms/{alias}",
+		apiPipeline(handlers.PutSynonym(bookmarksRepo))).
+		Methods("PUT").
+		Name("put_synonym")
+
+	r.Handle("/synonyms/{alias}",
+		apiPipeline(handlers.DeleteSynonym(bookmarksRepo))).
+		Methods("DELETE").
+		Name("delete_synonym")
+
+	r.Handle("/thumbnails/{id}",
+		sharedPipeline(handlers.GetThumbnail(bookmarksRepo, svc.thumbnails))).
+		Methods("GET").
+		Name("get_thumbnail")
+
+	// Admin
+	r.Handle("/admin/providers",
+		adminPipeline(handlers.ListProviders(svc.providers))).
+		Methods("GET").
+		Name("get_admin_providers")
+
+	r.Handle("/admin/providers/reload",
+		adminPipeline(handlers.PostReloadProviders(svc.providers))).
+		Methods("POST").
+		Name("post_admin_providers_reload")
+
 	// Web
 	r.Handle("/",
 		webPipeline(handlers.GetIndex())).
@@ -106,6 +222,21 @@ func HTTPHandler(cfg Configuration) http.Handler {
 
 	web := r.PathPrefix("/web").Subrouter()
 
+	web.Handle("/login",
+		publicWebPipeline(handlers.GetLogin())).
+		Methods("GET").
+		Name("get_login")
+
+	web.Handle("/login",
+		publicWebPipeline(handlers.PostLogin(cfg.BasicAuthUsers))).
+		Methods("POST").
+		Name("post_login")
+
+	web.Handle("/logout",
+		publicWebPipeline(handlers.PostLogout())).
+		Methods("POST").
+		Name("post_logout")
+
 	web.Handle("/bookmarks",
 		webPipeline(handlers.GetBookmarks(bookmarksRepo))).
 		Methods("GET").
@@ -117,22 +248,38 @@ func HTTPHandler(cfg Configuration) http.Handler {
 		Name("get_bookmarks_new")
 
 	web.Handle("/bookmarks/create",
-		webPipeline(handlers.PostCreateBookmark(bookmarksRepo, oembedFetcher))).
+		webPipeline(handlers.PostCreateBookmark(bookmarksRepo, svc.enrichment))).
 		Methods("POST").
 		Name("post_bookmarks_create")
 
+	web.Handle("/bookmarks/import",
+		webPipeline(handlers.GetImportBookmarks())).
+		Methods("GET").
+		Name("get_bookmarks_import")
+
+	web.Handle("/bookmarks/import",
+		webPipeline(handlers.PostWebImportBookmarks(bookmarksRepo, svc.enrichment))).
+		Methods("POST").
+		Name("post_bookmarks_import_web")
+
+	// must be declared after /bookmarks/new
+	web.Handle("/bookmarks/{id:[0-9]+}",
+		webPipeline(handlers.GetShowBookmark(bookmarksRepo))).
+		Methods("GET").
+		Name("get_bookmarks_show")
+
 	web.Handle("/bookmarks/{id}/edit",
 		webPipeline(handlers.GetEditBookmark(bookmarksRepo))).
 		Methods("GET").
 		Name("get_bookmarks_edit")
 
 	web.Handle("/bookmarks/{id}/update",
-		webPipeline(handlers.PostUpdateBookmark(bookmarksRepo))).
+		webPipeline(handlers.PostUpdateBookmark(bookmarksRepo, svc.enrichment, svc.thumbnails))).
 		Methods("POST").
 		Name("post_bookmarks_update")
 
 	web.Handle("/bookmarks/{id}/delete",
-		webPipeline(handlers.PostDeleteBookmark(bookmarksRepo))).
+		webPipeline(handlers.PostDeleteBookmark(bookmarksRepo, svc.thumbnails))).
 		Methods("POST").
 		Name("post_bookmarks_update")
 
@@ -150,7 +297,7 @@ func HTTPHandler(cfg Configuration) http.Handler {
 	return r
 }
 
-func gracefulShutdown(server *http.Server, timeout time.Duration) {
+func gracefulShutdown(server *http.Server, svc *services, cancelRequests context.CancelFunc, timeout time.Duration) {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
@@ -161,5 +308,7 @@ func gracefulShutdown(server *http.Server, timeout time.Duration) {
 	defer cancel()
 
 	server.Shutdown(ctx)
+	cancelRequests()
+	svc.stop(ctx)
 	logger.Info("server has shut down")
 }
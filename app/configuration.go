@@ -1,8 +1,13 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"strings"
+	"time"
+
+	"github.com/fchoquet/bookmarks/oembed"
 )
 
 // Configuration contains the application Configuration
@@ -10,13 +15,34 @@ import (
 type Configuration struct {
 	LogLevel       string
 	BasicAuthUsers UserList
-	DBConfig       DatabaseConfig
-	CSRFSecret     []byte
+	// StorageDriver selects where bookmarks are stored. Defaults to MySQL
+	StorageDriver string
+	DBConfig      DatabaseConfig
+	// SQLitePath is the database file used by the sqlite storage driver
+	SQLitePath string
+	// BlobsDir is where files like thumbnails are stored. Defaults to data/blobs
+	// Not used by the memory storage driver, which keeps them in memory too
+	BlobsDir string
+	// RefreshMaxAge is how long oEmbed properties are kept before being refreshed
+	// Defaults to a week
+	RefreshMaxAge time.Duration
+	Oembed        OembedConfig
+	// AdminUsers can access the admin endpoints. They must be declared in BasicAuthUsers too
+	AdminUsers []string
+	CSRFSecret []byte
 	// We need this option when using the application over http.
 	// Do not enable in prod!!!
 	DisableCSRFProtection bool
 }
 
+// Available storage drivers
+const (
+	StorageDriverMySQL  = "mysql"
+	StorageDriverSQLite = "sqlite"
+	// Everything is lost when the app stops. Useful for demos
+	StorageDriverMemory = "memory"
+)
+
 // DatabaseConfig holds the database config and credentials
 type DatabaseConfig struct {
 	User     string
@@ -25,6 +51,26 @@ type DatabaseConfig struct {
 	Database string
 }
 
+// OembedConfig configures where oEmbed providers are loaded from
+type OembedConfig struct {
+	// ProvidersSource is an URL or a local file. Defaults to https://oembed.com/providers.json
+	ProvidersSource string
+	// ProvidersCachePath stores the last good copy of the providers. Used when the source is down at boot
+	ProvidersCachePath string
+	// ProvidersRefreshInterval is how often providers are reloaded. Defaults to a day
+	ProvidersRefreshInterval time.Duration
+	// CustomProviders are declared by the operator. They take precedence over the public ones
+	CustomProviders []oembed.CustomProvider
+	// CacheSize is the number of oEmbed responses kept in memory. Defaults to 1000
+	CacheSize int
+	// PersistCache writes the cached responses to the blob store so that they survive restarts
+	PersistCache bool
+	// RateLimit is the number of calls per second allowed per provider. Defaults to 1
+	RateLimit float64
+	// RateBurst is the number of calls that can be made at once to a provider. Defaults to 5
+	RateBurst int
+}
+
 // UserList represents allowed users and passwords
 type UserList map[string]string
 
@@ -46,3 +92,33 @@ func ParseUsers(userString string) (UserList, error) {
 	}
 	return users, nil
 }
+
+// ParseNames parses a comma separated list of names
+func ParseNames(names string) []string {
+	parsed := []string{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			parsed = append(parsed, name)
+		}
+	}
+	return parsed
+}
+
+// LoadCustomProviders reads the operator-defined oEmbed providers from a JSON file
+// Returns no providers if path is empty
+func LoadCustomProviders(path string) ([]oembed.CustomProvider, error) {
+	providers := []oembed.CustomProvider{}
+	if path == "" {
+		return providers, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, &providers); err != nil {
+		return nil, fmt.Errorf("invalid custom providers file %s: %s", path, err)
+	}
+	return providers, nil
+}
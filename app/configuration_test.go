@@ -1,6 +1,9 @@
 package app
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +31,46 @@ func TestParseUsersWhenInvalid(t *testing.T) {
 		t.Error("Invalid input but no error returned")
 	}
 }
+
+func TestParseNames(t *testing.T) {
+	fixtures := map[string][]string{
+		"":              {},
+		"foo":           {"foo"},
+		" foo , bar ,,": {"foo", "bar"},
+	}
+
+	for input, expected := range fixtures {
+		output := ParseNames(input)
+		if strings.Join(output, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected %v - got %v", expected, output)
+		}
+	}
+}
+
+func TestLoadCustomProviders(t *testing.T) {
+	providers, err := LoadCustomProviders("")
+	if err != nil || len(providers) != 0 {
+		t.Errorf("expected no providers - got %v, %v", providers, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "providers.json")
+	ioutil.WriteFile(path, []byte(`[{
+		"name": "Internal",
+		"schemes": ["https://videos.example.com/*"],
+		"endpoint": "https://videos.example.com/oembed",
+		"auth_header": "Bearer secret"
+	}]`), 0644)
+
+	providers, err = LoadCustomProviders(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 1 || providers[0].Name != "Internal" || providers[0].AuthHeader != "Bearer secret" {
+		t.Errorf("unexpected providers: %+v", providers)
+	}
+
+	ioutil.WriteFile(path, []byte(`not json`), 0644)
+	if _, err := LoadCustomProviders(path); err == nil {
+		t.Error("invalid file but no error returned")
+	}
+}
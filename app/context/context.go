@@ -4,6 +4,7 @@ import (
 	gocontext "context"
 	"time"
 
+	"github.com/fchoquet/bookmarks/users"
 	"github.com/gorilla/sessions"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,6 +29,12 @@ var (
 
 	// sessionKey contains the session
 	sessionIDKey contextKey = 5
+
+	// usernameKey contains the name of the authenticated user
+	usernameKey contextKey = 6
+
+	// userKey contains the authenticated user
+	userKey contextKey = 7
 )
 
 // WithRequestTime returns a new context containing the request time
@@ -84,3 +91,25 @@ func Session(ctx gocontext.Context) (session *sessions.Session, ok bool) {
 	session, ok = ctx.Value(sessionIDKey).(*sessions.Session)
 	return
 }
+
+// WithUsername returns a new context containing the name of the authenticated user
+func WithUsername(ctx gocontext.Context, username string) gocontext.Context {
+	return gocontext.WithValue(ctx, usernameKey, username)
+}
+
+// Username returns the name of the authenticated user stored in the context
+func Username(ctx gocontext.Context) (username string, ok bool) {
+	username, ok = ctx.Value(usernameKey).(string)
+	return
+}
+
+// WithUser returns a new context containing the authenticated user
+func WithUser(ctx gocontext.Context, user *users.User) gocontext.Context {
+	return gocontext.WithValue(ctx, userKey, user)
+}
+
+// User returns the authenticated user stored in the context
+func User(ctx gocontext.Context) (user *users.User, ok bool) {
+	user, ok = ctx.Value(userKey).(*users.User)
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/fchoquet/bookmarks/users"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -62,3 +63,30 @@ func TestGetTransactionID(t *testing.T) {
 		t.Errorf("expected \"123-456-789\" - got %q", result)
 	}
 }
+
+func TestGetSetUsername(t *testing.T) {
+	result, ok := Username(WithUsername(gocontext.Background(), "foo"))
+
+	if !ok {
+		t.Error("Username not found in the context")
+		return
+	}
+
+	if result != "foo" {
+		t.Errorf("expected \"foo\" - got %q", result)
+	}
+}
+
+func TestGetSetUser(t *testing.T) {
+	user := &users.User{ID: 12, Name: "foo"}
+	result, ok := User(WithUser(gocontext.Background(), user))
+
+	if !ok {
+		t.Error("User not found in the context")
+		return
+	}
+
+	if result != user {
+		t.Errorf("expected %+v - got %+v", user, result)
+	}
+}
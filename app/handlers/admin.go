@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fchoquet/bookmarks/app/response"
+	"github.com/fchoquet/bookmarks/oembed"
+)
+
+type providersResponse struct {
+	LoadedAt  time.Time                   `json:"loaded_at"`
+	Providers []oembed.ProviderDefinition `json:"providers"`
+}
+
+// ListProviders returns the GET /admin/providers handler
+// It lists the loaded oEmbed providers and their URL schemes
+func ListProviders(registry oembed.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(r.Context(), w, providersResponse{
+			LoadedAt:  registry.LoadedAt(),
+			Providers: registry.Providers(),
+		}, http.StatusOK)
+	}
+}
+
+// PostReloadProviders returns the POST /admin/providers/reload handler
+// It reloads the oEmbed providers without waiting for the periodic reload
+func PostReloadProviders(registry oembed.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := registry.Reload(); err != nil {
+			// the source failed, not us. The current providers are kept
+			response.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		ListProviders(registry)(w, r)
+	}
+}
@@ -2,27 +2,70 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/fchoquet/bookmarks/app/response"
 	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/enrichment"
 	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/thumbnails"
 	"github.com/gorilla/mux"
 )
 
 // TODO more user friendly error messages
 
 // ListBookmarks returns the GET /bookmaks handler
+// Results are paginated. Pagination links are returned in the Link header
 func ListBookmarks(repo bookmarks.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		bs, _, err := repo.List(bookmarks.Filter{})
+		filter, err := parseListParams(r.URL.Query())
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.UserID = currentUser(r).ID
+
+		bs, count, err := repo.List(filter)
 		if err != nil {
 			response.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		response.Pagination(w, r.URL, filter.Pager, count)
+		response.JSON(r.Context(), w, bs, http.StatusOK)
+	}
+}
+
+// SearchBookmarks returns the GET /bookmarks/search handler
+// Results are ordered by relevance and paginated like the list endpoint
+func SearchBookmarks(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			response.Error(w, "q is required", http.StatusBadRequest)
+			return
+		}
+
+		filter, err := parseListParams(r.URL.Query())
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.UserID = currentUser(r).ID
+
+		bs, count, err := repo.Search(q, filter)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response.Pagination(w, r.URL, filter.Pager, count)
 		response.JSON(r.Context(), w, bs, http.StatusOK)
 	}
 }
@@ -41,7 +84,7 @@ func GetBookmark(repo bookmarks.Repository) http.HandlerFunc {
 			return
 		}
 
-		b, err := repo.ByID(id)
+		b, err := repo.ByID(currentUser(r).ID, id)
 		if err != nil {
 			response.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -52,12 +95,14 @@ func GetBookmark(repo bookmarks.Repository) http.HandlerFunc {
 			return
 		}
 
+		w.Header().Set("ETag", etag(b.Version))
 		response.JSON(r.Context(), w, b, http.StatusOK)
 	}
 }
 
 // PostBookmark returns the POST /bookmark handler
-func PostBookmark(repo bookmarks.Repository, fetcher oembed.Fetcher) http.HandlerFunc {
+// The bookmark is saved right away. oEmbed properties are fetched in the background
+func PostBookmark(repo bookmarks.Repository, queue enrichment.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -71,36 +116,144 @@ func PostBookmark(repo bookmarks.Repository, fetcher oembed.Fetcher) http.Handle
 			return
 		}
 
-		// Let's decorate with oembed information
-		link, err := fetcher.Fetch(b.URL)
-		if err != nil {
-			// There might be a way to have a graceful degradation here
-			// but this is out of scope
+		b.UserID = currentUser(r).ID
+		b.EnrichmentStatus = bookmarks.EnrichmentPending
+		b.EnrichmentError = ""
 
-			if notFoundErr, ok := err.(*oembed.NotFoundError); ok {
-				// not sure of the HTTP status to return. StatusFailedDependency sounds ok
-				response.Error(w, notFoundErr.Error(), http.StatusFailedDependency)
-				return
+		newB, err := repo.Insert(&b)
+		if err != nil {
+			switch err := err.(type) {
+			case *bookmarks.ValidationError:
+				invalid(w, err)
+			case *bookmarks.DuplicateError:
+				duplicate(w, err)
+			default:
+				response.Error(w, err.Error(), http.StatusInternalServerError)
 			}
-			response.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		b = *(bookmarks.FromOembed(&b, link))
+		// if the queue is full the bookmark is picked up by the next sweep
+		queue.Enqueue(newB)
 
-		newB, err := repo.Insert(&b)
+		response.JSON(r.Context(), w, newB, http.StatusCreated)
+	}
+}
+
+// PatchBookmark returns the PATCH /bookmarks/{id} handler
+// The body is a JSON Merge Patch of the URL, title, author name, notes and keywords
+// The If-Match header is required. It prevents overwriting the edits of someone else
+// A new URL is enriched again
+func PatchBookmark(repo bookmarks.Repository, queue enrichment.Queue, thumbs thumbnails.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if vars == nil || vars["id"] == "" {
+			response.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			response.Error(w, "id must be numeric", http.StatusBadRequest)
+			return
+		}
+
+		// plain JSON is tolerated, merge patches are JSON documents anyway
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != mergePatchContentType && mediaType != "application/json" {
+			response.Error(w, "Content-Type must be "+mergePatchContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		// edits made without the version they are based on would overwrite the others silently
+		if r.Header.Get("If-Match") == "" {
+			response.Error(w, "If-Match is required, with the ETag of the bookmark or *", http.StatusPreconditionRequired)
+			return
+		}
+
+		b, err := repo.ByID(currentUser(r).ID, id)
 		if err != nil {
-			// TODO: type assertion to check if validation error or internal server
 			response.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if b == nil {
+			response.Error(w, "bookmark not found", http.StatusNotFound)
+			return
+		}
 
-		response.JSON(r.Context(), w, newB, http.StatusCreated)
+		if !ifMatch(r, b) {
+			versionConflict(w, &bookmarks.VersionConflictError{ID: b.ID, Version: b.Version})
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		edit, err := parseMergePatch(body)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		urlChanged := edit.Apply(b)
+
+		// the version of b is the one loaded above, so edits made since are detected
+		if err := repo.Update(b); err != nil {
+			switch err := err.(type) {
+			case *bookmarks.VersionConflictError:
+				versionConflict(w, err)
+			case *bookmarks.DuplicateError:
+				duplicate(w, err)
+			case *bookmarks.NotFoundError:
+				response.Error(w, "bookmark not found", http.StatusNotFound)
+			case *bookmarks.ValidationError:
+				invalid(w, err)
+			default:
+				response.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if urlChanged {
+			// the thumbnail of the new URL is captured by the enrichment
+			deleteThumbnail(thumbs, id)
+			queue.Enqueue(b)
+		}
+
+		w.Header().Set("ETag", etag(b.Version))
+		response.JSON(r.Context(), w, b, http.StatusOK)
 	}
 }
 
+// versionConflict writes a 412 with the ETag of the current version
+// Clients should load the bookmark again and reapply their changes
+func versionConflict(w http.ResponseWriter, err *bookmarks.VersionConflictError) {
+	w.Header().Set("ETag", etag(err.Version))
+	response.Error(w, err.Error(), http.StatusPreconditionFailed)
+}
+
+// invalid writes a 422 listing the invalid properties of a bookmark
+func invalid(w http.ResponseWriter, err *bookmarks.ValidationError) {
+	fields := []response.FieldError{}
+	for _, field := range err.Fields {
+		fields = append(fields, response.FieldError(field))
+	}
+	response.Invalid(w, fields)
+}
+
+// duplicate writes a 409 with the location of the bookmark of the same page, when it is known
+func duplicate(w http.ResponseWriter, err *bookmarks.DuplicateError) {
+	if err.ID != 0 {
+		w.Header().Set("Location", fmt.Sprintf("/bookmarks/%d", err.ID))
+	}
+	response.Error(w, err.Error(), http.StatusConflict)
+}
+
 // DeleteBookmark returns the DELETE /bookmaks/:id handler
-func DeleteBookmark(repo bookmarks.Repository) http.HandlerFunc {
+// The thumbnail of the bookmark is deleted too
+func DeleteBookmark(repo bookmarks.Repository, thumbs thumbnails.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		if vars == nil || vars["id"] == "" {
@@ -114,7 +267,7 @@ func DeleteBookmark(repo bookmarks.Repository) http.HandlerFunc {
 		}
 
 		// First load the bookmark
-		b, err := repo.ByID(id)
+		b, err := repo.ByID(currentUser(r).ID, id)
 		if err != nil {
 			response.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -125,16 +278,52 @@ func DeleteBookmark(repo bookmarks.Repository) http.HandlerFunc {
 		}
 
 		// Then deletes it
-		if err := repo.Delete(id); err != nil {
+		if err := repo.Delete(currentUser(r).ID, id); err != nil {
 			response.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		deleteThumbnail(thumbs, id)
 
 		// Returns the bookmark in the json payload
 		response.JSON(r.Context(), w, b, http.StatusOK)
 	}
 }
 
+// PostRefreshBookmark returns the POST /bookmarks/{id}/refresh handler
+// It fetches oEmbed properties again without waiting for the periodic refresh
+func PostRefreshBookmark(repo bookmarks.Repository, refresher enrichment.Refresher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if vars == nil || vars["id"] == "" {
+			response.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			response.Error(w, "id must be numeric", http.StatusBadRequest)
+			return
+		}
+
+		b, err := repo.ByID(currentUser(r).ID, id)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if b == nil {
+			response.Error(w, "bookmark not found", http.StatusNotFound)
+			return
+		}
+
+		b, err = refresher.Refresh(r.Context(), b)
+		if err != nil {
+			oembedError(w, err)
+			return
+		}
+
+		response.JSON(r.Context(), w, b, http.StatusOK)
+	}
+}
+
 // PutBookmarkKeywords returns the PUT /bookmarks/{id}/keywords handler
 func PutBookmarkKeywords(repo bookmarks.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -150,7 +339,7 @@ func PutBookmarkKeywords(repo bookmarks.Repository) http.HandlerFunc {
 		}
 
 		// First load the bookmark
-		b, err := repo.ByID(id)
+		b, err := repo.ByID(currentUser(r).ID, id)
 		if err != nil {
 			response.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -174,13 +363,48 @@ func PutBookmarkKeywords(repo bookmarks.Repository) http.HandlerFunc {
 		}
 
 		// Now updates the bookmark
-		if err := repo.UpdateKeywords(id, kws); err != nil {
-			response.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := repo.UpdateKeywords(currentUser(r).ID, id, kws); err != nil {
+			switch err := err.(type) {
+			case *bookmarks.ValidationError:
+				invalid(w, err)
+			default:
+				response.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Returns the updated bookmark in the json payload. Its version changed
+		b, err = repo.ByID(currentUser(r).ID, id)
+		if err != nil || b == nil {
+			response.Error(w, "could not load the updated bookmark", http.StatusInternalServerError)
 			return
 		}
 
-		// Returns the updated bookmark in the json payload
-		b.Keywords = kws
+		w.Header().Set("ETag", etag(b.Version))
 		response.JSON(r.Context(), w, b, http.StatusOK)
 	}
 }
+
+// oembedError writes the error of an oEmbed fetch
+// The provider failed, not us, so unknown errors are bad gateways
+func oembedError(w http.ResponseWriter, err error) {
+	switch err := err.(type) {
+	case *oembed.UnknownProviderError:
+		response.Error(w, "no oEmbed provider supports this URL", http.StatusUnprocessableEntity)
+	case *oembed.NotFoundError:
+		response.Error(w, "the provider does not know this URL. It may have been deleted", http.StatusUnprocessableEntity)
+	case *oembed.UnauthorizedError:
+		response.Error(w, "the provider refused to describe this URL. The content may be private", http.StatusUnprocessableEntity)
+	case *oembed.RateLimitError:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+		response.Error(w, "too many calls to the provider, try again later", http.StatusTooManyRequests)
+	case *oembed.TimeoutError:
+		response.Error(w, "the provider did not answer in time", http.StatusGatewayTimeout)
+	case *oembed.FormatNotImplementedError:
+		response.Error(w, "the provider supports neither JSON nor XML", http.StatusBadGateway)
+	case *oembed.MalformedResponseError:
+		response.Error(w, "the provider returned an invalid oEmbed response", http.StatusBadGateway)
+	default:
+		response.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
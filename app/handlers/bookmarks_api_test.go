@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appcontext "github.com/fchoquet/bookmarks/app/context"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostBookmark(t *testing.T) {
+	repo := bookmarks.NewMemoryRepository()
+	queue := &fakeQueue{}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/bookmarks", strings.NewReader(body))
+		r = r.WithContext(appcontext.WithUser(r.Context(), &users.User{ID: 1, Name: "test"}))
+		w := httptest.NewRecorder()
+		PostBookmark(repo, queue)(w, r)
+		return w
+	}
+
+	w := post(`{"url": "https://vimeo.com/1?utm_source=twitter", "keywords": []}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	if !assert.Len(t, queue.enqueued, 1) {
+		t.FailNow()
+	}
+
+	// the same page
+	w = post(`{"url": "https://VIMEO.com/1/", "keywords": []}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, fmt.Sprintf("/bookmarks/%d", queue.enqueued[0]), w.Header().Get("Location"))
+	assert.Len(t, queue.enqueued, 1)
+
+	// every invalid property is reported
+	w = post(`{"url": "not an URL", "author_name": "` + strings.Repeat("a", 101) + `", "keywords": []}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"field": "url"`)
+	assert.Contains(t, w.Body.String(), `"field": "author_name"`)
+	assert.Contains(t, w.Body.String(), `"type": "validation_error"`)
+}
+
+func TestDuplicate(t *testing.T) {
+	w := httptest.NewRecorder()
+	duplicate(w, &bookmarks.DuplicateError{URL: "https://vimeo.com/1", ID: 12})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "/bookmarks/12", w.Header().Get("Location"))
+
+	// the other bookmark was not found after a concurrent insertion
+	w = httptest.NewRecorder()
+	duplicate(w, &bookmarks.DuplicateError{URL: "https://vimeo.com/1"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.NotContains(t, w.Body.String(), "bookmark 0")
+}
+
+func TestOembedError(t *testing.T) {
+	fixtures := []struct {
+		err  error
+		code int
+	}{
+		{&oembed.UnknownProviderError{URL: "https://example.com"}, http.StatusUnprocessableEntity},
+		{&oembed.NotFoundError{}, http.StatusUnprocessableEntity},
+		{&oembed.UnauthorizedError{StatusCode: 403}, http.StatusUnprocessableEntity},
+		{&oembed.RateLimitError{Provider: "Vimeo", RetryAfter: 1500 * time.Millisecond}, http.StatusTooManyRequests},
+		{&oembed.TimeoutError{URL: "https://vimeo.com/1"}, http.StatusGatewayTimeout},
+		{&oembed.FormatNotImplementedError{}, http.StatusBadGateway},
+		{&oembed.ProviderError{StatusCode: 500}, http.StatusBadGateway},
+		{errors.New("unknown"), http.StatusBadGateway},
+	}
+
+	for _, fixture := range fixtures {
+		w := httptest.NewRecorder()
+		oembedError(w, fixture.err)
+		assert.Equal(t, fixture.code, w.Code, "%T", fixture.err)
+	}
+
+	w := httptest.NewRecorder()
+	oembedError(w, &oembed.RateLimitError{Provider: "Vimeo", RetryAfter: 1500 * time.Millisecond})
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+}
@@ -1,21 +1,29 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/fchoquet/bookmarks/app/context"
-	"github.com/fchoquet/bookmarks/app/response"
 	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/enrichment"
 	"github.com/fchoquet/bookmarks/oembed"
 	"github.com/fchoquet/bookmarks/pager"
+	"github.com/fchoquet/bookmarks/thumbnails"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
 
 const itemsPerPage = 5
 
+// size of the embedded players when the provider does not return one
+const (
+	defaultEmbedWidth  = 640
+	defaultEmbedHeight = 360
+)
+
 // GetIndex is the default handler
 func GetIndex() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -25,21 +33,35 @@ func GetIndex() http.HandlerFunc {
 }
 
 // GetBookmarks returns the bookmarks list
+// It accepts the same filters as the API
 func GetBookmarks(repo bookmarks.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		page, err := strconv.Atoi(r.FormValue("page"))
-		if err != nil || page < 0 {
-			// pages are 1-based to match the URL directly
-			page = 1
+		page := formPage(r.FormValue("page"))
+
+		query := r.URL.Query()
+		filter, err := parseFilterParams(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		pager := pager.New(page, itemsPerPage)
-
-		bookmarks, count, err := repo.List(bookmarks.Filter{
-			Pager: pager,
-		})
+		filter.UserID = currentUser(r).ID
+		filter.Pager = pager
+
+		var (
+			bs    []*bookmarks.Bookmark
+			count int
+		)
+		q := strings.TrimSpace(query.Get("q"))
+		if q != "" {
+			bs, count, err = repo.Search(q, filter)
+		} else {
+			bs, count, err = repo.List(filter)
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		lastPage := pager.PageOf(count - 1)
@@ -49,9 +71,19 @@ func GetBookmarks(repo bookmarks.Repository) http.HandlerFunc {
 			pages = append(pages, i+1)
 		}
 
+		// pagination and export links must keep the current filters
+		query.Del("page")
+		filters := ""
+		if encoded := query.Encode(); encoded != "" {
+			filters = encoded + "&"
+		}
+
 		renderTemplate(w, r, "bookmarks_index.html", map[string]interface{}{
-			"bookmarks": bookmarks,
-			"url":       "/web/bookmarks?page=",
+			"bookmarks": bs,
+			"filters":   query,
+			"q":         q,
+			"url":       "/web/bookmarks?" + filters + "page=",
+			"exportURL": "/bookmarks/export?" + filters + "format=",
 			"count":     count,
 			"page":      page,
 			"pages":     pages,
@@ -63,12 +95,15 @@ func GetBookmarks(repo bookmarks.Repository) http.HandlerFunc {
 // GetNewBookmark returns the bookmarks creation form
 func GetNewBookmark() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, r, "bookmarks_new.html", map[string]interface{}{})
+		renderTemplate(w, r, "bookmarks_new.html", map[string]interface{}{
+			"errors": map[string]string{},
+		})
 	}
 }
 
 // PostCreateBookmark creates a new bookmark
-func PostCreateBookmark(repo bookmarks.Repository, fetcher oembed.Fetcher) http.HandlerFunc {
+// oEmbed properties are fetched in the background
+func PostCreateBookmark(repo bookmarks.Repository, queue enrichment.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, _ := context.Session(r.Context())
 
@@ -76,32 +111,46 @@ func PostCreateBookmark(repo bookmarks.Repository, fetcher oembed.Fetcher) http.
 		keywords := r.FormValue("keywords")
 		logger := log.WithField("url", url)
 
-		// Let's decorate with oembed information
-		link, err := fetcher.Fetch(url)
-		if err != nil {
-			logger.WithError(err).Warning("an invalid URL was submitted")
+		b := &bookmarks.Bookmark{
+			URL:              url,
+			UserID:           currentUser(r).ID,
+			EnrichmentStatus: bookmarks.EnrichmentPending,
+			Keywords:         splitKeywords(keywords),
+		}
+
+		newB, err := repo.Insert(b)
+		if dup, ok := err.(*bookmarks.DuplicateError); ok {
 			session.AddFlash(Flash{
 				Level:   FlashLevelWarning,
 				Title:   "Holy guacamole!",
-				Message: "This URL does not seem correct",
+				Message: "You already bookmarked this page",
 			})
 			session.Save(r, w)
-			http.Redirect(w, r, "/web/bookmarks/new", http.StatusSeeOther)
+			location := "/web/bookmarks"
+			if dup.ID != 0 {
+				location = fmt.Sprintf("/web/bookmarks/%d", dup.ID)
+			}
+			http.Redirect(w, r, location, http.StatusSeeOther)
 			return
 		}
-
-		b := bookmarks.FromOembed(&bookmarks.Bookmark{URL: url}, link)
-		for _, kw := range strings.Split(keywords, ",") {
-			b.Keywords = append(b.Keywords, bookmarks.Keyword(kw))
+		if validationErr, ok := err.(*bookmarks.ValidationError); ok {
+			logger.WithError(err).Warning("an invalid bookmark was submitted")
+			// the form is displayed again with the submitted values
+			renderTemplateStatus(w, r, "bookmarks_new.html", map[string]interface{}{
+				"url":      url,
+				"keywords": keywords,
+				"errors":   fieldErrors(validationErr),
+			}, http.StatusUnprocessableEntity)
+			return
 		}
-
-		_, err = repo.Insert(b)
 		if err != nil {
-			// TODO: type assertion to check if validation error or internal server
-			response.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		// if the queue is full the bookmark is picked up by the next sweep
+		queue.Enqueue(newB)
+
 		// back to the list
 		session.AddFlash(Flash{
 			Level:   FlashLevelSuccess,
@@ -113,8 +162,10 @@ func PostCreateBookmark(repo bookmarks.Repository, fetcher oembed.Fetcher) http.
 	}
 }
 
-// GetEditBookmark retruns the edit form of a bookmark
-func GetEditBookmark(repo bookmarks.Repository) http.HandlerFunc {
+// GetShowBookmark returns the page of a bookmark
+// Videos and rich links are played with the embed code of the provider. It is sanitized then
+// displayed in a sandboxed iframe so that its scripts cannot access the application
+func GetShowBookmark(repo bookmarks.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		if vars == nil || vars["id"] == "" {
@@ -128,8 +179,7 @@ func GetEditBookmark(repo bookmarks.Repository) http.HandlerFunc {
 			return
 		}
 
-		// load existing bookmark
-		b, err := repo.ByID(id)
+		b, err := repo.ByID(currentUser(r).ID, id)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -145,16 +195,62 @@ func GetEditBookmark(repo bookmarks.Repository) http.HandlerFunc {
 			keywords = append(keywords, string(kw))
 		}
 
-		renderTemplate(w, r, "bookmarks_edit.html", map[string]interface{}{
-			"id":       b.ID,
-			"url":      b.URL,
+		// players need a size. Most providers return one
+		width, height := b.Width, b.Height
+		if width <= 0 || height <= 0 {
+			width, height = defaultEmbedWidth, defaultEmbedHeight
+		}
+
+		renderTemplate(w, r, "bookmarks_show.html", map[string]interface{}{
+			"bookmark": b,
 			"keywords": strings.Join(keywords, ","),
+			// a plain string: the template escapes it for the srcdoc attribute
+			"embed":  embedDocument(b.HTML),
+			"width":  width,
+			"height": height,
 		})
 	}
 }
 
-// PostUpdateBookmark updates a bookmark (the keywords only so far)
-func PostUpdateBookmark(repo bookmarks.Repository) http.HandlerFunc {
+// GetEditBookmark retruns the edit form of a bookmark
+func GetEditBookmark(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if vars == nil || vars["id"] == "" {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		// load existing bookmark
+		b, err := repo.ByID(currentUser(r).ID, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if b == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		renderTemplate(w, r, "bookmarks_edit.html", map[string]interface{}{
+			"bookmark": b,
+			"keywords": joinKeywords(b.Keywords),
+			"errors":   map[string]string{},
+		})
+	}
+}
+
+// PostUpdateBookmark updates a bookmark
+// Only the fields present in the form are changed, so that partial forms (ie: the keywords of
+// the bookmark page) can post here too. The version field prevents overwriting the edits of someone else
+func PostUpdateBookmark(repo bookmarks.Repository, queue enrichment.Queue, thumbs thumbnails.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, _ := context.Session(r.Context())
 
@@ -170,29 +266,126 @@ func PostUpdateBookmark(repo bookmarks.Repository) http.HandlerFunc {
 			return
 		}
 
-		keywords := []bookmarks.Keyword{}
-		for _, kw := range strings.Split(r.FormValue("keywords"), ",") {
-			keywords = append(keywords, bookmarks.Keyword(kw))
+		version, err := strconv.Atoi(r.FormValue("version"))
+		if err != nil {
+			http.Error(w, "version is required", http.StatusBadRequest)
+			return
 		}
 
-		if err := repo.UpdateKeywords(id, keywords); err != nil {
+		b, err := repo.ByID(currentUser(r).ID, id)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if b == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
 
-		// back to the list
+		urlChanged := formEdit(r).Apply(b)
+		// the edit is based on the version displayed by the form, not on the one loaded above
+		b.Version = version
+
+		editURL := fmt.Sprintf("/web/bookmarks/%d/edit", id)
+		if err := repo.Update(b); err != nil {
+			switch err := err.(type) {
+			case *bookmarks.VersionConflictError:
+				session.AddFlash(Flash{
+					Level:   FlashLevelWarning,
+					Title:   "Holy guacamole!",
+					Message: "Someone modified this bookmark in the meantime. Your changes were not saved, please review them again",
+				})
+				session.Save(r, w)
+				http.Redirect(w, r, editURL, http.StatusSeeOther)
+			case *bookmarks.DuplicateError:
+				session.AddFlash(Flash{
+					Level:   FlashLevelWarning,
+					Title:   "Holy guacamole!",
+					Message: "You already bookmarked this URL. Your changes were not saved",
+				})
+				session.Save(r, w)
+				http.Redirect(w, r, editURL, http.StatusSeeOther)
+			case *bookmarks.NotFoundError:
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			case *bookmarks.ValidationError:
+				// the form is displayed again with the submitted values, and the submitted version
+				renderTemplateStatus(w, r, "bookmarks_edit.html", map[string]interface{}{
+					"bookmark": b,
+					"keywords": joinKeywords(b.Keywords),
+					"errors":   fieldErrors(err),
+				}, http.StatusUnprocessableEntity)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if urlChanged {
+			// the thumbnail of the new URL is captured by the enrichment
+			deleteThumbnail(thumbs, id)
+			queue.Enqueue(b)
+		}
+
+		// back to the list, or to the page of the bookmark
 		session.AddFlash(Flash{
 			Level:   FlashLevelSuccess,
 			Title:   "Congratulations!",
 			Message: "Bookmark successfuly updated",
 		})
 		session.Save(r, w)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, localURL(r.FormValue("back"), "/"), http.StatusSeeOther)
 	}
 }
 
-// PostDeleteBookmark deletes a bookmark
-func PostDeleteBookmark(repo bookmarks.Repository) http.HandlerFunc {
+// fieldErrors returns the message of the first error of each invalid field, by field name
+// Forms display them next to their fields
+func fieldErrors(err *bookmarks.ValidationError) map[string]string {
+	errs := map[string]string{}
+	for _, field := range err.Fields {
+		// the keywords share a single field: keywords[2] => keywords
+		name := strings.SplitN(field.Field, "[", 2)[0]
+		if _, ok := errs[name]; !ok {
+			errs[name] = field.Message
+		}
+	}
+	return errs
+}
+
+// joinKeywords returns the value of the keywords field of the forms
+func joinKeywords(kws []bookmarks.Keyword) string {
+	keywords := []string{}
+	for _, kw := range kws {
+		keywords = append(keywords, string(kw))
+	}
+	return strings.Join(keywords, ",")
+}
+
+// formEdit reads the changes of a bookmark from the fields present in the posted form
+func formEdit(r *http.Request) bookmarks.Edit {
+	r.ParseForm()
+
+	field := func(name string) *string {
+		if _, ok := r.PostForm[name]; !ok {
+			return nil
+		}
+		value := strings.TrimSpace(r.PostForm.Get(name))
+		return &value
+	}
+
+	edit := bookmarks.Edit{
+		URL:        field("url"),
+		Title:      field("title"),
+		AuthorName: field("author_name"),
+		Notes:      field("notes"),
+	}
+	if keywords := field("keywords"); keywords != nil {
+		edit.Keywords = splitKeywords(*keywords)
+	}
+	return edit
+}
+
+// PostDeleteBookmark deletes a bookmark and its thumbnail
+func PostDeleteBookmark(repo bookmarks.Repository, thumbs thumbnails.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, _ := context.Session(r.Context())
 
@@ -208,10 +401,15 @@ func PostDeleteBookmark(repo bookmarks.Repository) http.HandlerFunc {
 			return
 		}
 
-		if err := repo.Delete(id); err != nil {
+		if err := repo.Delete(currentUser(r).ID, id); err != nil {
+			if _, ok := err.(*bookmarks.NotFoundError); ok {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		deleteThumbnail(thumbs, id)
 
 		// back to the list
 		session.AddFlash(Flash{
@@ -223,3 +421,32 @@ func PostDeleteBookmark(repo bookmarks.Repository) http.HandlerFunc {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
+
+// embedDocument returns the document displayed by the iframe of an embed code, or an empty
+// string if nothing is left once sanitized
+func embedDocument(embed string) string {
+	sanitized := oembed.SanitizeHTML(embed)
+	if strings.TrimSpace(sanitized) == "" {
+		return ""
+	}
+	return `<!doctype html><style>body{margin:0}iframe,img,video{max-width:100%}</style>` + sanitized
+}
+
+// formPage returns the page of the list requested by the browser
+// Pages are 1-based to match the URL directly. Invalid values show the first page
+func formPage(value string) int {
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// localURL returns rawURL if it is a path of this application, fallback otherwise
+// It prevents redirections to other sites
+func localURL(rawURL, fallback string) string {
+	if !strings.HasPrefix(rawURL, "/") || strings.HasPrefix(rawURL, "//") || strings.HasPrefix(rawURL, "/\\") {
+		return fallback
+	}
+	return rawURL
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedDocument(t *testing.T) {
+	assert.Equal(t, "", embedDocument(""))
+	assert.Equal(t, "", embedDocument(`<script>alert(1)</script>`))
+	assert.Equal(t,
+		`<!doctype html><style>body{margin:0}iframe,img,video{max-width:100%}</style><iframe src="https://player.vimeo.com/video/1"></iframe>`,
+		embedDocument(`<iframe src="https://player.vimeo.com/video/1" onload="alert(1)"></iframe>`),
+	)
+}
+
+func TestLocalURL(t *testing.T) {
+	fixtures := map[string]string{
+		"/web/bookmarks/1":    "/web/bookmarks/1",
+		"":                    "/",
+		"https://evil.com":    "/",
+		"//evil.com":          "/",
+		"/\\evil.com":         "/",
+		"javascript:alert(1)": "/",
+	}
+
+	for rawURL, expected := range fixtures {
+		assert.Equal(t, expected, localURL(rawURL, "/"), rawURL)
+	}
+}
+
+func TestFormPage(t *testing.T) {
+	fixtures := map[string]int{
+		"":    1,
+		"abc": 1,
+		"-1":  1,
+		"0":   1,
+		"1":   1,
+		"3":   3,
+	}
+
+	for value, expected := range fixtures {
+		assert.Equal(t, expected, formPage(value), value)
+	}
+}
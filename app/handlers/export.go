@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fchoquet/bookmarks/app/response"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/exporter"
+	"github.com/fchoquet/bookmarks/pager"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetExportBookmarks returns the GET /bookmarks/export handler
+// It accepts the filters of the list endpoint, and q to export the results of a search
+// The collection is streamed, so errors occurring after the first batch can only be logged
+func GetExportBookmarks(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format := exporter.Format(query.Get("format"))
+		if format == "" {
+			format = exporter.FormatJSON
+		}
+		if !format.Valid() {
+			response.Error(w, "format must be html, json, csv or atom", http.StatusBadRequest)
+			return
+		}
+
+		filter, err := parseFilterParams(query)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user := currentUser(r)
+		filter.UserID = user.ID
+
+		q := strings.TrimSpace(query.Get("q"))
+		source := func(p pager.Pager) ([]*bookmarks.Bookmark, int, error) {
+			filter.Pager = p
+			if q != "" {
+				return repo.Search(q, filter)
+			}
+			return repo.List(filter)
+		}
+
+		feed := exporter.Feed{
+			Title:  "Bookmarks of " + user.Name,
+			URL:    requestURL(r),
+			Author: user.Name,
+		}
+
+		ew := &exportWriter{ResponseWriter: w, format: format}
+		if err := exporter.Export(ew, format, feed, source); err != nil {
+			if !ew.started {
+				response.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// the response is truncated. Clients see an invalid file
+			log.WithError(err).WithField("format", format).Error("export interrupted")
+		}
+	}
+}
+
+// exportWriter sends the headers of the export with its first bytes
+// so that an error can still be returned if the export fails right away
+type exportWriter struct {
+	http.ResponseWriter
+	format  exporter.Format
+	started bool
+}
+
+func (w *exportWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.Header().Set("Content-Type", w.format.ContentType())
+		// feeds are meant to be subscribed to, not downloaded
+		if w.format != exporter.FormatAtom {
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bookmarks.%s"`, w.format.Extension()))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// requestURL rebuilds the absolute URL of the request
+// The scheme is https behind TLS terminating proxies setting X-Forwarded-Proto
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fchoquet/bookmarks/app/context"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetExportBookmarks(t *testing.T) {
+	repo := bookmarks.NewMemoryRepository()
+	for _, b := range []*bookmarks.Bookmark{
+		{UserID: 1, URL: "https://vimeo.com/1", Keywords: []bookmarks.Keyword{"video"}},
+		{UserID: 1, URL: "https://example.com/", Keywords: []bookmarks.Keyword{}},
+		{UserID: 2, URL: "https://vimeo.com/2", Keywords: []bookmarks.Keyword{"video"}},
+	} {
+		if _, err := repo.Insert(b); !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	export := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/bookmarks/export?"+query, nil)
+		r = r.WithContext(context.WithUser(r.Context(), &users.User{ID: 1, Name: "test"}))
+		w := httptest.NewRecorder()
+		GetExportBookmarks(repo)(w, r)
+		return w
+	}
+
+	w := export("format=csv&keywords=video")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="bookmarks.csv"`, w.Header().Get("Content-Disposition"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.True(t, strings.HasPrefix(lines[1], "https://vimeo.com/1,"), lines[1])
+	}
+
+	w = export("format=atom")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+	assert.Contains(t, w.Body.String(), "<id>http://example.com/bookmarks/export?format=atom</id>")
+
+	assert.Equal(t, http.StatusBadRequest, export("format=xml").Code)
+	assert.Equal(t, http.StatusBadRequest, export("added_after=yesterday").Code)
+}
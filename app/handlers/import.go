@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/fchoquet/bookmarks/app/context"
+	"github.com/fchoquet/bookmarks/app/response"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/enrichment"
+	"github.com/fchoquet/bookmarks/importer"
+)
+
+// maxImportSize is the maximum size of an uploaded export, in bytes
+// Exports of thousands of bookmarks are a few megabytes
+const maxImportSize = 10 << 20
+
+// PostImportBookmarks returns the POST /bookmarks/import handler
+// The export is either the body of the request or the file field of a multipart form
+// The format is given by the format parameter, or detected
+func PostImportBookmarks(repo bookmarks.Repository, queue enrichment.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := readImport(w, r)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report := importer.Import(repo, queue, currentUser(r).ID, entries)
+		response.JSON(r.Context(), w, report, http.StatusOK)
+	}
+}
+
+// GetImportBookmarks returns the import form
+func GetImportBookmarks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, r, "bookmarks_import.html", map[string]interface{}{})
+	}
+}
+
+// PostWebImportBookmarks imports an uploaded export and displays the report
+func PostWebImportBookmarks(repo bookmarks.Repository, queue enrichment.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := readImport(w, r)
+		if err != nil {
+			session, _ := context.Session(r.Context())
+			session.AddFlash(Flash{
+				Level:   FlashLevelWarning,
+				Title:   "Holy guacamole!",
+				Message: "This file cannot be imported: " + err.Error(),
+			})
+			session.Save(r, w)
+			http.Redirect(w, r, "/web/bookmarks/import", http.StatusSeeOther)
+			return
+		}
+
+		renderTemplate(w, r, "bookmarks_import.html", map[string]interface{}{
+			"report": importer.Import(repo, queue, currentUser(r).ID, entries),
+		})
+	}
+}
+
+// readImport reads and parses the uploaded export
+func readImport(w http.ResponseWriter, r *http.Request) ([]importer.Entry, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var file io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("file is required")
+		}
+		defer f.Close()
+		file = f
+	}
+
+	// the form might have been parsed before the body was limited
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportSize {
+		return nil, errors.New("the file is too large")
+	}
+
+	format := importer.Format(r.FormValue("format"))
+	if format != "" && !format.Valid() {
+		return nil, errors.New("format must be netscape, pocket or pinboard")
+	}
+
+	return importer.Parse(data, format)
+}
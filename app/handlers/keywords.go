@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/fchoquet/bookmarks/app/response"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// ListKeywords returns the GET /keywords handler
+// Keywords are sorted by name, with the number of bookmarks having them
+func ListKeywords(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usages, err := repo.Keywords(currentUser(r).ID)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response.JSON(r.Context(), w, usages, http.StatusOK)
+	}
+}
+
+// PatchKeyword returns the PATCH /keywords/{name} handler
+// The body sets the new name: {"name": "golang"}. Use the merge endpoint if the user already has it
+func PatchKeyword(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name bookmarks.Keyword `json:"name"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userID := currentUser(r).ID
+		if err := repo.RenameKeyword(userID, keywordVar(r), body.Name); err != nil {
+			keywordError(w, err)
+			return
+		}
+
+		respondKeyword(w, r, repo, body.Name)
+	}
+}
+
+// PostMergeKeyword returns the POST /keywords/{name}/merge handler
+// The keyword is replaced by the one of the body on all the bookmarks: {"into": "golang"}
+func PostMergeKeyword(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Into bookmarks.Keyword `json:"into"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userID := currentUser(r).ID
+		if err := repo.MergeKeyword(userID, keywordVar(r), body.Into); err != nil {
+			keywordError(w, err)
+			return
+		}
+
+		respondKeyword(w, r, repo, body.Into)
+	}
+}
+
+// DeleteKeyword returns the DELETE /keywords/{name} handler
+// The keyword is removed from all the bookmarks. They are not deleted
+func DeleteKeyword(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := currentUser(r).ID
+		name := keywordVar(r)
+
+		// returned in the json payload, like deleted bookmarks
+		usage, err := findKeyword(repo, userID, name)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := repo.DeleteKeyword(userID, name); err != nil {
+			keywordError(w, err)
+			return
+		}
+
+		response.JSON(r.Context(), w, usage, http.StatusOK)
+	}
+}
+
+// ListSynonyms returns the GET /synonyms handler
+// Synonyms are sorted by keyword
+func ListSynonyms(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		synonyms, err := repo.Synonyms(currentUser(r).ID)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response.JSON(r.Context(), w, synonyms, http.StatusOK)
+	}
+}
+
+// PutSynonym returns the PUT /synonyms/{alias} handler
+// The body sets the keyword of the alias: {"keyword": "javascript"}. The bookmarks tagged
+// with the alias are tagged with the keyword instead
+func PutSynonym(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Keyword bookmarks.Keyword `json:"keyword"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		alias := bookmarks.Keyword(mux.Vars(r)["alias"])
+		synonym, err := repo.AddSynonym(currentUser(r).ID, alias, body.Keyword)
+		if err != nil {
+			keywordError(w, err)
+			return
+		}
+
+		response.JSON(r.Context(), w, synonym, http.StatusOK)
+	}
+}
+
+// DeleteSynonym returns the DELETE /synonyms/{alias} handler
+// The bookmarks are not changed
+func DeleteSynonym(repo bookmarks.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := currentUser(r).ID
+		alias := bookmarks.NormalizeKeyword(bookmarks.Keyword(mux.Vars(r)["alias"]))
+
+		// returned in the json payload, like deleted keywords
+		synonyms, err := repo.Synonyms(userID)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var deleted *bookmarks.Synonym
+		for _, synonym := range synonyms {
+			if synonym.Alias == alias {
+				deleted = synonym
+			}
+		}
+
+		if err := repo.DeleteSynonym(userID, alias); err != nil {
+			keywordError(w, err)
+			return
+		}
+
+		response.JSON(r.Context(), w, deleted, http.StatusOK)
+	}
+}
+
+// keywordVar returns the keyword of the URL. mux decodes it
+func keywordVar(r *http.Request) bookmarks.Keyword {
+	return bookmarks.Keyword(mux.Vars(r)["name"])
+}
+
+// readJSON decodes the JSON body of a request
+func readJSON(r *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// findKeyword returns the usage of a keyword of a user, or nil if no bookmark has it
+// Like in the repository, the keyword is normalized and its synonyms are resolved
+func findKeyword(repo bookmarks.Repository, userID int, name bookmarks.Keyword) (*bookmarks.KeywordUsage, error) {
+	name = bookmarks.NormalizeKeyword(name)
+
+	synonyms, err := repo.Synonyms(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, synonym := range synonyms {
+		if synonym.Alias == name {
+			name = synonym.Keyword
+		}
+	}
+
+	usages, err := repo.Keywords(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, usage := range usages {
+		if usage.Name == name {
+			return usage, nil
+		}
+	}
+	return nil, nil
+}
+
+// respondKeyword writes the usage of a renamed or merged keyword
+func respondKeyword(w http.ResponseWriter, r *http.Request, repo bookmarks.Repository, name bookmarks.Keyword) {
+	usage, err := findKeyword(repo, currentUser(r).ID, name)
+	if err != nil || usage == nil {
+		response.Error(w, "could not load the updated keyword", http.StatusInternalServerError)
+		return
+	}
+
+	response.JSON(r.Context(), w, usage, http.StatusOK)
+}
+
+// keywordError maps the errors of the keyword and synonym methods of the repository to statuses
+func keywordError(w http.ResponseWriter, err error) {
+	switch err := err.(type) {
+	case *bookmarks.KeywordNotFoundError, *bookmarks.SynonymNotFoundError:
+		response.Error(w, err.Error(), http.StatusNotFound)
+	case *bookmarks.KeywordExistsError:
+		response.Error(w, err.Error()+". Merge the keywords instead", http.StatusConflict)
+	case *bookmarks.ValidationError:
+		invalid(w, err)
+	default:
+		response.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
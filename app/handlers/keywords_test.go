@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appcontext "github.com/fchoquet/bookmarks/app/context"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/users"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywords(t *testing.T) {
+	repo := bookmarks.NewMemoryRepository()
+	for _, b := range []*bookmarks.Bookmark{
+		{UserID: 1, URL: "https://vimeo.com/1", Keywords: []bookmarks.Keyword{"go", "web dev"}},
+		{UserID: 1, URL: "https://vimeo.com/2", Keywords: []bookmarks.Keyword{"go", "video"}},
+	} {
+		if _, err := repo.Insert(b); !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	call := func(handler http.HandlerFunc, method, name, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/keywords", strings.NewReader(body))
+		if name != "" {
+			r = mux.SetURLVars(r, map[string]string{"name": name})
+		}
+		r = r.WithContext(appcontext.WithUser(r.Context(), &users.User{ID: 1, Name: "test"}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := call(ListKeywords(repo), "GET", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"name": "go", "count": 2}, {"name": "video", "count": 1}, {"name": "web dev", "count": 1}]`, w.Body.String())
+
+	w = call(PatchKeyword(repo), "PATCH", "go", `{"name": "golang"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name": "golang", "count": 2}`, w.Body.String())
+
+	assert.Equal(t, http.StatusConflict, call(PatchKeyword(repo), "PATCH", "video", `{"name": "golang"}`).Code)
+	assert.Equal(t, http.StatusNotFound, call(PatchKeyword(repo), "PATCH", "go", `{"name": "rust"}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, call(PatchKeyword(repo), "PATCH", "video", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, call(PatchKeyword(repo), "PATCH", "video", `not json`).Code)
+
+	w = call(PostMergeKeyword(repo), "POST", "web dev", `{"into": "golang"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name": "golang", "count": 2}`, w.Body.String())
+
+	w = call(DeleteKeyword(repo), "DELETE", "video", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name": "video", "count": 1}`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, call(DeleteKeyword(repo), "DELETE", "video", "").Code)
+
+	w = call(ListKeywords(repo), "GET", "", "")
+	assert.JSONEq(t, `[{"name": "golang", "count": 2}]`, w.Body.String())
+}
+
+func TestSynonyms(t *testing.T) {
+	repo := bookmarks.NewMemoryRepository()
+	b, err := repo.Insert(&bookmarks.Bookmark{UserID: 1, URL: "https://vimeo.com/1", Keywords: []bookmarks.Keyword{"js"}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// the keyword handlers are called too
+	call := func(handler http.HandlerFunc, method, name, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/synonyms", strings.NewReader(body))
+		if name != "" {
+			r = mux.SetURLVars(r, map[string]string{"alias": name, "name": name})
+		}
+		r = r.WithContext(appcontext.WithUser(r.Context(), &users.User{ID: 1, Name: "test"}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := call(PutSynonym(repo), "PUT", "JS", `{"keyword": "JavaScript"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"alias": "js", "keyword": "javascript"}`, w.Body.String())
+
+	loaded, err := repo.ByID(1, b.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []bookmarks.Keyword{"javascript"}, loaded.Keywords)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, call(PutSynonym(repo), "PUT", "js", `{"keyword": "js"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, call(PutSynonym(repo), "PUT", "js", `not json`).Code)
+
+	w = call(ListSynonyms(repo), "GET", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"alias": "js", "keyword": "javascript"}]`, w.Body.String())
+
+	// renaming to an alias renames to its keyword
+	w = call(PatchKeyword(repo), "PATCH", "javascript", `{"name": "ecmascript"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = call(PostMergeKeyword(repo), "POST", "ecmascript", `{"into": " JS "}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name": "ecmascript", "count": 1}`, w.Body.String())
+
+	w = call(DeleteSynonym(repo), "DELETE", "js", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"alias": "js", "keyword": "ecmascript"}`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, call(DeleteSynonym(repo), "DELETE", "js", "").Code)
+}
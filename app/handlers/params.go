@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/pager"
+)
+
+// API pagination defaults
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// parseListParams builds a bookmarks filter from the query parameters of the list endpoint
+// The user is not set here. It's the responsibility of the caller
+func parseListParams(query url.Values) (bookmarks.Filter, error) {
+	filter, err := parseFilterParams(query)
+	if err != nil {
+		return filter, err
+	}
+
+	page, err := intParam(query, "page", 1)
+	if err != nil || page < 1 {
+		return filter, fmt.Errorf("page must be a positive integer")
+	}
+
+	perPage, err := intParam(query, "per_page", defaultPerPage)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		return filter, fmt.Errorf("per_page must be an integer between 1 and %d", maxPerPage)
+	}
+
+	filter.Pager = pager.New(page, perPage)
+
+	if sort := query.Get("sort"); sort != "" {
+		filter.Sort = bookmarks.SortField(sort)
+		if !filter.Sort.Valid() {
+			return filter, fmt.Errorf("invalid sort field: %s", sort)
+		}
+	}
+
+	if order := query.Get("order"); order != "" {
+		filter.Order = bookmarks.SortOrder(order)
+		if !filter.Order.Valid() {
+			return filter, fmt.Errorf("invalid order: %s", order)
+		}
+	}
+
+	return filter, nil
+}
+
+// parseFilterParams builds a bookmarks filter from the filtering query parameters
+// (ie: everything but pagination and sort). Shared by the API and the web interface
+func parseFilterParams(query url.Values) (bookmarks.Filter, error) {
+	filter := bookmarks.Filter{
+		AuthorName: strings.TrimSpace(query.Get("author")),
+		Provider:   oembed.Provider(strings.TrimSpace(query.Get("provider"))),
+		Type:       oembed.LinkType(strings.TrimSpace(query.Get("type"))),
+		Host:       strings.TrimSpace(query.Get("host")),
+	}
+
+	filter.Keywords = splitKeywords(query.Get("keywords"))
+
+	if match := query.Get("keywords_match"); match != "" {
+		filter.KeywordsMatch = bookmarks.KeywordsMatch(match)
+		if !filter.KeywordsMatch.Valid() {
+			return filter, fmt.Errorf("invalid keywords_match: %s", match)
+		}
+	}
+
+	var err error
+	if filter.AddedAfter, err = dateParam(query, "added_after"); err != nil {
+		return filter, err
+	}
+	if filter.AddedBefore, err = dateParam(query, "added_before"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// splitKeywords splits comma separated keywords and drops the empty ones
+func splitKeywords(raw string) []bookmarks.Keyword {
+	keywords := []bookmarks.Keyword{}
+	for _, kw := range strings.Split(raw, ",") {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			keywords = append(keywords, bookmarks.Keyword(kw))
+		}
+	}
+	return keywords
+}
+
+// dateParam parses a date query parameter. Both 2006-01-02 and RFC3339 formats are accepted
+// returns nil if missing
+func dateParam(query url.Values, name string) (*time.Time, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD)", name)
+}
+
+// intParam returns the value of an integer query parameter or defaultValue if missing
+func intParam(query url.Values, name string, defaultValue int) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(raw)
+}
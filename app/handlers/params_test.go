@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListParams(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("with default values", func(t *testing.T) {
+		filter, err := parseListParams(url.Values{})
+
+		assert.Nil(err)
+		assert.Equal(1, filter.Pager.Page())
+		assert.Equal(defaultPerPage, filter.Pager.Limit())
+		assert.Equal(bookmarks.SortField(""), filter.Sort)
+		assert.Equal(bookmarks.SortOrder(""), filter.Order)
+	})
+
+	t.Run("with valid values", func(t *testing.T) {
+		query, _ := url.ParseQuery("page=3&per_page=50&sort=title&order=desc")
+		filter, err := parseListParams(query)
+
+		assert.Nil(err)
+		assert.Equal(3, filter.Pager.Page())
+		assert.Equal(50, filter.Pager.Limit())
+		assert.Equal(bookmarks.SortByTitle, filter.Sort)
+		assert.Equal(bookmarks.OrderDesc, filter.Order)
+	})
+
+	t.Run("with filters", func(t *testing.T) {
+		query, _ := url.ParseQuery("keywords=design, video,&keywords_match=all&author=John&provider=Vimeo&type=video&host=vimeo.com&added_after=2018-03-01&added_before=2018-04-01T00:00:00Z")
+		filter, err := parseListParams(query)
+
+		assert.Nil(err)
+		assert.Equal([]bookmarks.Keyword{"design", "video"}, filter.Keywords)
+		assert.Equal(bookmarks.MatchAll, filter.KeywordsMatch)
+		assert.Equal("John", filter.AuthorName)
+		assert.Equal(oembed.ProviderVimeo, filter.Provider)
+		assert.Equal(oembed.LinkTypeVideo, filter.Type)
+		assert.Equal("vimeo.com", filter.Host)
+		assert.Equal(time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC), *filter.AddedAfter)
+		assert.Equal(time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC), *filter.AddedBefore)
+	})
+
+	t.Run("with invalid values", func(t *testing.T) {
+		queries := []string{
+			"keywords_match=some",
+			"added_after=yesterday",
+			"added_before=01/04/2018",
+			"page=0",
+			"page=blah",
+			"per_page=0",
+			"per_page=1000",
+			"sort=url",
+			"order=up",
+		}
+
+		for _, raw := range queries {
+			query, _ := url.ParseQuery(raw)
+			_, err := parseListParams(query)
+
+			assert.NotNil(err, raw)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+)
+
+// mergePatchContentType is the media type of JSON Merge Patch documents (RFC 7396)
+const mergePatchContentType = "application/merge-patch+json"
+
+// parseMergePatch reads the changes of a bookmark from a JSON Merge Patch document
+// Only the editable properties can be patched. null resets a property, except the URL which is required
+func parseMergePatch(body []byte) (bookmarks.Edit, error) {
+	edit := bookmarks.Edit{}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return edit, errors.New("the body must be a JSON object")
+	}
+
+	// sorted so that errors do not depend on the map order
+	names := make([]string, 0, len(patch))
+	for name := range patch {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		raw := patch[name]
+		null := strings.TrimSpace(string(raw)) == "null"
+
+		var err error
+		switch name {
+		case "url":
+			if null {
+				return edit, errors.New("url cannot be removed")
+			}
+			edit.URL, err = stringPatch(raw, null)
+		case "title":
+			edit.Title, err = stringPatch(raw, null)
+		case "author_name":
+			edit.AuthorName, err = stringPatch(raw, null)
+		case "notes":
+			edit.Notes, err = stringPatch(raw, null)
+		case "keywords":
+			edit.Keywords = []bookmarks.Keyword{}
+			if !null {
+				err = json.Unmarshal(raw, &edit.Keywords)
+			}
+		default:
+			return edit, fmt.Errorf("%s cannot be edited", name)
+		}
+
+		if err != nil {
+			return edit, fmt.Errorf("invalid %s: %s", name, err)
+		}
+	}
+
+	return edit, nil
+}
+
+// stringPatch returns the new value of a string property. null resets it
+func stringPatch(raw json.RawMessage, null bool) (*string, error) {
+	var s string
+	if null {
+		return &s, nil
+	}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// etag returns the ETag of a version of a bookmark. It changes with every edit
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch tells if the If-Match header of the request matches the ETag of a bookmark
+// A missing header matches nothing. `*` matches any version
+func ifMatch(r *http.Request, b *bookmarks.Bookmark) bool {
+	header := r.Header.Get("If-Match")
+	current := etag(b.Version)
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
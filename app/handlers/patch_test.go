@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appcontext "github.com/fchoquet/bookmarks/app/context"
+	"github.com/fchoquet/bookmarks/blobs"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/thumbnails"
+	"github.com/fchoquet/bookmarks/users"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	edit, err := parseMergePatch([]byte(`{"title": "A video", "author_name": null, "keywords": ["video"]}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "A video", *edit.Title)
+		assert.Equal(t, "", *edit.AuthorName)
+		assert.Equal(t, []bookmarks.Keyword{"video"}, edit.Keywords)
+		assert.Nil(t, edit.URL)
+		assert.Nil(t, edit.Notes)
+	}
+
+	edit, err = parseMergePatch([]byte(`{"keywords": null}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []bookmarks.Keyword{}, edit.Keywords)
+	}
+
+	for _, body := range []string{
+		`[]`,
+		`null`,
+		`{"url": null}`,
+		`{"title": 42}`,
+		`{"provider": "Vimeo"}`,
+		`{"title": "A video", "version": 2}`,
+	} {
+		_, err := parseMergePatch([]byte(body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	b := &bookmarks.Bookmark{Version: 3}
+
+	fixtures := map[string]bool{
+		``:             false,
+		`*`:            true,
+		`"3"`:          true,
+		`"1", "3"`:     true,
+		`"2"`:          false,
+		`W/"3"`:        false,
+		`3`:            false,
+		`"2", W/"3"`:   false,
+		` "3" , "4" `:  true,
+		`"30"`:         false,
+		`"3", garbage`: true,
+	}
+
+	for header, expected := range fixtures {
+		r := httptest.NewRequest("PATCH", "/bookmarks/1", nil)
+		if header != "" {
+			r.Header.Set("If-Match", header)
+		}
+		assert.Equal(t, expected, ifMatch(r, b), header)
+	}
+}
+
+// fakeQueue records the enqueued bookmarks
+type fakeQueue struct {
+	enqueued []int
+}
+
+func (q *fakeQueue) Enqueue(b *bookmarks.Bookmark) bool {
+	q.enqueued = append(q.enqueued, b.ID)
+	return true
+}
+
+func (q *fakeQueue) Start() {}
+
+func (q *fakeQueue) Stop(ctx context.Context) error { return nil }
+
+func TestPatchBookmark(t *testing.T) {
+	repo := bookmarks.NewMemoryRepository()
+	queue := &fakeQueue{}
+	thumbs := thumbnails.NewStore(blobs.NewMemoryStore(), thumbnails.DefaultOptions)
+
+	b, err := repo.Insert(&bookmarks.Bookmark{
+		UserID:     1,
+		URL:        "https://vimeo.com/1",
+		Title:      "A video",
+		AuthorName: "Jane Doe",
+		Keywords:   []bookmarks.Keyword{"video"},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	patch := func(body, contentType, ifMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PATCH", "/bookmarks/1", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		r = r.WithContext(appcontext.WithUser(r.Context(), &users.User{ID: 1, Name: "test"}))
+		w := httptest.NewRecorder()
+		PatchBookmark(repo, queue, thumbs)(w, r)
+		return w
+	}
+
+	w := patch(`{"title": "My video", "notes": "To watch"}`, mergePatchContentType, `"1"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"notes": "To watch"`)
+	assert.Empty(t, queue.enqueued)
+
+	loaded, _ := repo.ByID(1, b.ID)
+	assert.Equal(t, "My video", loaded.Title)
+	assert.Equal(t, "Jane Doe", loaded.AuthorName)
+
+	// someone else edited the bookmark since version 1
+	w = patch(`{"title": "Overwritten"}`, mergePatchContentType, `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// the version is required
+	w = patch(`{"title": "Overwritten"}`, mergePatchContentType, "")
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	loaded, _ = repo.ByID(1, b.ID)
+	assert.Equal(t, "My video", loaded.Title)
+
+	// a new URL is enriched again
+	w = patch(`{"url": "https://www.flickr.com/photos/1"}`, "application/json", "*")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int{b.ID}, queue.enqueued)
+	loaded, _ = repo.ByID(1, b.ID)
+	assert.Equal(t, bookmarks.EnrichmentPending, loaded.EnrichmentStatus)
+	assert.Equal(t, "", loaded.Title)
+
+	// the URL of another bookmark
+	other, err := repo.Insert(&bookmarks.Bookmark{UserID: 1, URL: "https://vimeo.com/2", Keywords: []bookmarks.Keyword{}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	w = patch(`{"url": "https://vimeo.com/2/#comments"}`, mergePatchContentType, `"3"`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, fmt.Sprintf("/bookmarks/%d", other.ID), w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, patch(`{}`, "text/plain", "").Code)
+	assert.Equal(t, http.StatusBadRequest, patch(`{"id": 2}`, mergePatchContentType, `"3"`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, patch(`{"url": "not an URL"}`, mergePatchContentType, `"3"`).Code)
+}
@@ -41,6 +41,11 @@ const (
 )
 
 func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data map[string]interface{}) {
+	renderTemplateStatus(w, r, name, data, http.StatusOK)
+}
+
+// renderTemplateStatus renders a page with another status than 200, ie: forms with invalid fields
+func renderTemplateStatus(w http.ResponseWriter, r *http.Request, name string, data map[string]interface{}, code int) {
 	// automatically appends flash messages
 	if _, ok := data["flashes"]; !ok {
 		session, ok := context.Session(r.Context())
@@ -51,11 +56,23 @@ func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data ma
 		}
 	}
 
+	// automatically appends the logged in user
+	if _, ok := data["username"]; !ok {
+		if username, ok := context.Username(r.Context()); ok {
+			data["username"] = username
+		}
+	}
+
 	// automatically appends CSRF field
 	if _, ok := data[csrf.TemplateTag]; !ok {
 		data[csrf.TemplateTag] = csrf.TemplateField(r)
 	}
 
+	// after the session is saved: its cookie is a header
+	if code != http.StatusOK {
+		w.WriteHeader(code)
+	}
+
 	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
 		// TODO: nicer error page
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fchoquet/bookmarks/app/response"
+	"github.com/fchoquet/bookmarks/blobs"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/thumbnails"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// thumbnailMaxAge is how long browsers can cache thumbnails, in seconds
+// They rarely change and are revalidated with the ETag anyway
+const thumbnailMaxAge = 24 * 60 * 60
+
+// GetThumbnail returns the GET /thumbnails/{id} handler
+// It serves the local copy of the thumbnail of a bookmark
+func GetThumbnail(repo bookmarks.Repository, thumbs thumbnails.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if vars == nil || vars["id"] == "" {
+			response.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			response.Error(w, "id must be numeric", http.StatusBadRequest)
+			return
+		}
+
+		// thumbnails are as private as their bookmark
+		b, err := repo.ByID(currentUser(r).ID, id)
+		if err != nil {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if b == nil || !b.HasThumbnail {
+			response.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		blob, err := thumbs.Open(id)
+		if err != nil {
+			if _, ok := err.(*blobs.NotFoundError); ok {
+				response.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer blob.Close()
+
+		w.Header().Set("Content-Type", thumbnails.ContentType)
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", thumbnailMaxAge))
+		w.Header().Set("ETag", fmt.Sprintf(`"%d-%d"`, id, blob.ModTime.UnixNano()))
+
+		// handles conditional and range requests
+		http.ServeContent(w, r, "", blob.ModTime, blob)
+	}
+}
+
+// deleteThumbnail deletes the thumbnail of a deleted bookmark, or of a bookmark whose URL changed
+// Failing is not a big deal: nobody can access it anymore
+func deleteThumbnail(thumbs thumbnails.Store, id int) {
+	if err := thumbs.Delete(id); err != nil {
+		log.WithError(err).WithField("bookmark_id", id).Warning("could not delete thumbnail")
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/fchoquet/bookmarks/app/context"
+	"github.com/fchoquet/bookmarks/app/middlewares"
+	"github.com/fchoquet/bookmarks/users"
+)
+
+// currentUser returns the authenticated user
+// The CurrentUser middleware guarantees that it is set on every authenticated route
+// so a missing user is a wiring error. The Recovery middleware will catch it
+func currentUser(r *http.Request) *users.User {
+	user, ok := context.User(r.Context())
+	if !ok {
+		panic("no authenticated user in context")
+	}
+	return user
+}
+
+// GetLogin returns the login form
+func GetLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, r, "login.html", map[string]interface{}{})
+	}
+}
+
+// PostLogin logs a user in
+// Credentials are the same as the ones used by the API basic authentication
+func PostLogin(credentials map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := context.Session(r.Context())
+
+		username := r.FormValue("username")
+		password, ok := credentials[username]
+		if !ok || password != r.FormValue("password") {
+			session.AddFlash(Flash{
+				Level:   FlashLevelDanger,
+				Title:   "Oh snap!",
+				Message: "Invalid username or password",
+			})
+			session.Save(r, w)
+			http.Redirect(w, r, "/web/login", http.StatusSeeOther)
+			return
+		}
+
+		session.Values[middlewares.SessionUsernameKey] = username
+		session.Save(r, w)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// PostLogout logs the current user out
+func PostLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := context.Session(r.Context())
+
+		delete(session.Values, middlewares.SessionUsernameKey)
+		session.Save(r, w)
+		http.Redirect(w, r, "/web/login", http.StatusSeeOther)
+	}
+}
@@ -3,10 +3,13 @@ package middlewares
 import (
 	"net/http"
 
+	"github.com/fchoquet/bookmarks/app/context"
 	"github.com/fchoquet/bookmarks/app/response"
+	"github.com/fchoquet/bookmarks/users"
 )
 
 // BasicAuth adds basic authentication to the passed handler
+// The authenticated username is injected in the context
 func BasicAuth(users map[string]string) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -17,7 +20,109 @@ func BasicAuth(users map[string]string) Middleware {
 				return
 			}
 
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(w, r.WithContext(context.WithUsername(r.Context(), username)))
+		})
+	}
+}
+
+// SessionAuth redirects to the login page if no user is logged in the session
+// The authenticated username is injected in the context
+// It must be used after the Session middleware
+func SessionAuth(loginURL string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, ok := context.Session(r.Context())
+			if !ok {
+				http.Error(w, "no session found", http.StatusInternalServerError)
+				return
+			}
+
+			username, ok := session.Values[SessionUsernameKey].(string)
+			if !ok || username == "" {
+				http.Redirect(w, r, loginURL, http.StatusSeeOther)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(context.WithUsername(r.Context(), username)))
+		})
+	}
+}
+
+// SessionOrBasicAuth accepts both the users logged in the session and basic authentication
+// It is used by resources shared by the API and the web interface, like thumbnails
+// Unlike SessionAuth it does not redirect to the login page. It must be used after the Session middleware
+func SessionOrBasicAuth(users map[string]string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username, password, ok := r.BasicAuth(); ok {
+				if !checkUser(users, username, password) {
+					response.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+				h.ServeHTTP(w, r.WithContext(context.WithUsername(r.Context(), username)))
+				return
+			}
+
+			session, ok := context.Session(r.Context())
+			if !ok {
+				http.Error(w, "no session found", http.StatusInternalServerError)
+				return
+			}
+
+			username, ok := session.Values[SessionUsernameKey].(string)
+			if !ok || username == "" {
+				response.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(context.WithUsername(r.Context(), username)))
+		})
+	}
+}
+
+// CurrentUser loads the authenticated user and injects it in the context
+// It must be used after an authentication middleware (BasicAuth or SessionAuth)
+func CurrentUser(repo users.Repository) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, ok := context.Username(r.Context())
+			if !ok {
+				response.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			user, err := repo.ByName(username)
+			if err != nil {
+				response.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if user == nil {
+				// users are registered at boot time so this should not happen
+				// unless the configuration and the DB are out of sync
+				response.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(context.WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// Admin restricts access to the given users
+// It must be used after an authentication middleware (BasicAuth or SessionAuth)
+func Admin(admins []string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, _ := context.Username(r.Context())
+			for _, admin := range admins {
+				if username != "" && username == admin {
+					h.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			response.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		})
 	}
 }
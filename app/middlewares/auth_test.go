@@ -4,6 +4,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/fchoquet/bookmarks/app/context"
+	"github.com/fchoquet/bookmarks/users"
+	"github.com/gorilla/sessions"
 )
 
 func TestBasicAuth(t *testing.T) {
@@ -33,3 +37,175 @@ func TestBasicAuth(t *testing.T) {
 		t.Errorf("expected %d - got %d", 200, recorder2.Code)
 	}
 }
+
+func TestBasicAuthInjectsUsername(t *testing.T) {
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, ok := context.Username(r.Context())
+		if !ok {
+			t.Error("username not found in context")
+			return
+		}
+
+		if username != "foo" {
+			t.Errorf("expected \"foo\" - got %q", username)
+		}
+	})
+
+	req, _ := http.NewRequest("GET", "whatever", nil)
+	req.SetBasicAuth("foo", "bar")
+	BasicAuth(map[string]string{"foo": "bar"})(testHandler).ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestSessionAuth(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("secret"))
+	middleware := SessionAuth("/login")
+
+	t.Run("when no user is logged in", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "whatever", nil)
+		session, _ := store.Get(req, "session")
+		req = req.WithContext(context.WithSession(req.Context(), session))
+
+		recorder := httptest.NewRecorder()
+		middleware(testHandler{}).ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusSeeOther {
+			t.Errorf("expected %d - got %d", http.StatusSeeOther, recorder.Code)
+		}
+
+		if location := recorder.Header().Get("Location"); location != "/login" {
+			t.Errorf("expected \"/login\" - got %q", location)
+		}
+	})
+
+	t.Run("when a user is logged in", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "whatever", nil)
+		session, _ := store.Get(req, "session")
+		session.Values[SessionUsernameKey] = "foo"
+		req = req.WithContext(context.WithSession(req.Context(), session))
+
+		testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username, _ := context.Username(r.Context()); username != "foo" {
+				t.Errorf("expected \"foo\" - got %q", username)
+			}
+		})
+
+		recorder := httptest.NewRecorder()
+		middleware(testHandler).ServeHTTP(recorder, req)
+
+		if recorder.Code != 200 {
+			t.Errorf("expected %d - got %d", 200, recorder.Code)
+		}
+	})
+}
+
+func TestSessionOrBasicAuth(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("secret"))
+	h := SessionOrBasicAuth(map[string]string{"foo": "bar"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, _ := context.Username(r.Context()); username != "foo" {
+			t.Errorf("expected \"foo\" - got %q", username)
+		}
+	}))
+
+	fixtures := map[string]struct {
+		basicAuth       []string
+		sessionUsername string
+		expected        int
+	}{
+		"valid basic auth":   {basicAuth: []string{"foo", "bar"}, expected: 200},
+		"invalid basic auth": {basicAuth: []string{"foo", "baz"}, sessionUsername: "foo", expected: 401},
+		"logged in":          {sessionUsername: "foo", expected: 200},
+		"anonymous":          {expected: 401},
+	}
+
+	for name, fixture := range fixtures {
+		req, _ := http.NewRequest("GET", "whatever", nil)
+		if fixture.basicAuth != nil {
+			req.SetBasicAuth(fixture.basicAuth[0], fixture.basicAuth[1])
+		}
+		session, _ := store.Get(req, "session")
+		if fixture.sessionUsername != "" {
+			session.Values[SessionUsernameKey] = fixture.sessionUsername
+		}
+		req = req.WithContext(context.WithSession(req.Context(), session))
+
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+
+		if recorder.Code != fixture.expected {
+			t.Errorf("%s: expected %d - got %d", name, fixture.expected, recorder.Code)
+		}
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	middleware := CurrentUser(testUsersRepo{"foo": {ID: 12, Name: "foo"}})
+
+	t.Run("when the user is registered", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "whatever", nil)
+		req = req.WithContext(context.WithUsername(req.Context(), "foo"))
+
+		testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := context.User(r.Context())
+			if !ok {
+				t.Error("user not found in context")
+				return
+			}
+
+			if user.ID != 12 {
+				t.Errorf("expected 12 - got %d", user.ID)
+			}
+		})
+
+		recorder := httptest.NewRecorder()
+		middleware(testHandler).ServeHTTP(recorder, req)
+
+		if recorder.Code != 200 {
+			t.Errorf("expected %d - got %d", 200, recorder.Code)
+		}
+	})
+
+	t.Run("when the user is unknown", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "whatever", nil)
+		req = req.WithContext(context.WithUsername(req.Context(), "bar"))
+
+		recorder := httptest.NewRecorder()
+		middleware(testHandler{}).ServeHTTP(recorder, req)
+
+		if recorder.Code != 401 {
+			t.Errorf("expected %d - got %d", 401, recorder.Code)
+		}
+	})
+}
+
+type testUsersRepo map[string]*users.User
+
+func (repo testUsersRepo) ByName(name string) (*users.User, error) {
+	return repo[name], nil
+}
+
+func (repo testUsersRepo) Register(name string) (*users.User, error) {
+	return repo[name], nil
+}
+
+func TestAdmin(t *testing.T) {
+	h := Admin([]string{"admin"})(testHandler{})
+
+	fixtures := map[string]int{
+		"admin": 200,
+		"foo":   403,
+		"":      403,
+	}
+
+	for username, expected := range fixtures {
+		req, _ := http.NewRequest("GET", "whatever", nil)
+		if username != "" {
+			req = req.WithContext(context.WithUsername(req.Context(), username))
+		}
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+
+		if recorder.Code != expected {
+			t.Errorf("%q: expected %d - got %d", username, expected, recorder.Code)
+		}
+	}
+}
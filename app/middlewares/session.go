@@ -7,6 +7,9 @@ import (
 	"github.com/gorilla/sessions"
 )
 
+// SessionUsernameKey is the session key holding the name of the logged in user
+const SessionUsernameKey = "username"
+
 // Session starts a session
 func Session(store sessions.Store) Middleware {
 	return func(h http.Handler) http.Handler {
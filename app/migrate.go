@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fchoquet/bookmarks/database"
+)
+
+// Migrate is the entry point of the migrate subcommand: bookmarks migrate up|down|status
+// Migrations are also applied when the application starts. This command is
+// useful to check the schema or to revert a migration
+func Migrate(cfg Configuration, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: bookmarks migrate up|down|status")
+	}
+
+	db, driver := initDB(cfg)
+	if db == nil {
+		return fmt.Errorf("the %s storage driver does not need migrations", cfg.StorageDriver)
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, driver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "nothing to apply")
+		}
+		return err
+
+	case "down":
+		reverted, err := migrator.Down()
+		switch {
+		case reverted != nil:
+			fmt.Fprintf(out, "reverted %04d_%s\n", reverted.Version, reverted.Name)
+		case err == nil:
+			fmt.Fprintln(out, "nothing to revert")
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
@@ -5,16 +5,41 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fchoquet/bookmarks/pager"
 )
 
 type errorResponse struct {
 	Errors []errorLine `json:"errors"`
 }
 
+// errorLine is an error of the response
+// Type tells clients what went wrong without parsing the message
 type errorLine struct {
 	Type    string `json:"type,omitempty"`
 	Message string `json:"message"`
 	Code    int    `json:"code,omitempty"`
+	// The invalid property and the validation rule it breaks, for validation errors
+	Field string `json:"field,omitempty"`
+	Rule  string `json:"rule,omitempty"`
+}
+
+// TypeValidation is the type of the errors of invalid properties
+const TypeValidation = "validation_error"
+
+// errorType returns the type of the errors of a status: not_found, internal_server_error...
+func errorType(code int) string {
+	return strings.Replace(strings.ToLower(http.StatusText(code)), " ", "_", -1)
+}
+
+// FieldError is a property of the request that is not valid
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
 }
 
 // Error generates a formatted error
@@ -29,18 +54,41 @@ func Error(w http.ResponseWriter, msg string, code int) {
 // You should return and stop the middleware chain after calling this function
 // since nothing prevents from stacking json structures
 func Errors(w http.ResponseWriter, msgs []string, code int) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(code)
-
 	resp := errorResponse{}
 
 	for _, msg := range msgs {
 		resp.Errors = append(resp.Errors, errorLine{
+			Type:    errorType(code),
 			Message: msg,
 			Code:    code,
 		})
 	}
 
+	writeErrors(w, resp, code)
+}
+
+// Invalid generates a 422 error listing the invalid properties of the request
+// You should return and stop the middleware chain after calling this function
+func Invalid(w http.ResponseWriter, fields []FieldError) {
+	resp := errorResponse{}
+
+	for _, field := range fields {
+		resp.Errors = append(resp.Errors, errorLine{
+			Type:    TypeValidation,
+			Message: field.Message,
+			Code:    http.StatusUnprocessableEntity,
+			Field:   field.Field,
+			Rule:    field.Rule,
+		})
+	}
+
+	writeErrors(w, resp, http.StatusUnprocessableEntity)
+}
+
+func writeErrors(w http.ResponseWriter, resp errorResponse, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+
 	j, err := json.MarshalIndent(resp, "", "    ")
 	if err != nil {
 		// It should never happen, but not sure what we can do if it's the case.
@@ -64,6 +112,39 @@ func JSON(ctx gocontext.Context, w http.ResponseWriter, resp interface{}, code i
 	return nil
 }
 
+// Pagination sets the X-Total-Count and Link headers of a paginated response
+// Links are built from the request URL by replacing the page query parameter
+// It must be called before writing the response body
+func Pagination(w http.ResponseWriter, u *url.URL, p pager.Pager, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if !p.Enabled() {
+		return
+	}
+
+	lastPage := p.PageOf(total - 1)
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	link := func(page int, rel string) string {
+		query := u.Query()
+		query.Set("page", strconv.Itoa(page))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, query.Encode(), rel)
+	}
+
+	links := []string{link(1, "first")}
+	if p.Page() > 1 && p.Page() <= lastPage {
+		links = append(links, link(p.Page()-1, "prev"))
+	}
+	if p.Page() < lastPage {
+		links = append(links, link(p.Page()+1, "next"))
+	}
+	links = append(links, link(lastPage, "last"))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
 // StatusAwareResponseWriter is a custom response writer that keeps track of status code
 // This is useful for logging
 type StatusAwareResponseWriter struct {
@@ -0,0 +1,81 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/fchoquet/bookmarks/pager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagination(t *testing.T) {
+	assert := assert.New(t)
+
+	u, _ := url.Parse("/bookmarks?sort=title&page=2&per_page=10")
+
+	fixtures := []struct {
+		page     int
+		total    int
+		expected string
+	}{
+		{
+			page:  2,
+			total: 35,
+			expected: `</bookmarks?page=1&per_page=10&sort=title>; rel="first", ` +
+				`</bookmarks?page=1&per_page=10&sort=title>; rel="prev", ` +
+				`</bookmarks?page=3&per_page=10&sort=title>; rel="next", ` +
+				`</bookmarks?page=4&per_page=10&sort=title>; rel="last"`,
+		},
+		{
+			page:  1,
+			total: 5,
+			expected: `</bookmarks?page=1&per_page=10&sort=title>; rel="first", ` +
+				`</bookmarks?page=1&per_page=10&sort=title>; rel="last"`,
+		},
+		{
+			page:  1,
+			total: 0,
+			expected: `</bookmarks?page=1&per_page=10&sort=title>; rel="first", ` +
+				`</bookmarks?page=1&per_page=10&sort=title>; rel="last"`,
+		},
+	}
+
+	for _, f := range fixtures {
+		recorder := httptest.NewRecorder()
+		Pagination(recorder, u, pager.New(f.page, 10), f.total)
+
+		assert.Equal(f.expected, recorder.Header().Get("Link"))
+	}
+
+	t.Run("without pager", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		Pagination(recorder, u, pager.NoPager(), 12)
+
+		assert.Equal("12", recorder.Header().Get("X-Total-Count"))
+		assert.Equal("", recorder.Header().Get("Link"))
+	})
+}
+
+func TestErrors(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Error(recorder, "bookmark not found", http.StatusNotFound)
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.JSONEq(t, `{"errors": [{"type": "not_found", "message": "bookmark not found", "code": 404}]}`, recorder.Body.String())
+}
+
+func TestInvalid(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Invalid(recorder, []FieldError{
+		{Field: "url", Rule: "required", Message: "url is required"},
+		{Field: "title", Rule: "max", Message: "title must be at most 100 characters long"},
+	})
+
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.JSONEq(t, `{"errors": [
+		{"type": "validation_error", "message": "url is required", "code": 422, "field": "url", "rule": "required"},
+		{"type": "validation_error", "message": "title must be at most 100 characters long", "code": 422, "field": "title", "rule": "max"}
+	]}`, recorder.Body.String())
+}
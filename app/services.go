@@ -1,13 +1,20 @@
 package app
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
+	"time"
 
 	"github.com/fchoquet/bookmarks/app/handlers"
 	"github.com/fchoquet/bookmarks/app/middlewares"
+	"github.com/fchoquet/bookmarks/blobs"
 	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/database"
+	"github.com/fchoquet/bookmarks/enrichment"
 	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/thumbnails"
+	"github.com/fchoquet/bookmarks/users"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
@@ -22,6 +29,56 @@ import (
 // The default logger
 var logger log.FieldLogger
 
+// services are shared by the handlers and might run in the background
+type services struct {
+	bookmarks  bookmarks.Repository
+	users      users.Repository
+	enrichment enrichment.Queue
+	refresher  enrichment.Refresher
+	providers  oembed.Registry
+	thumbnails thumbnails.Store
+	keywords   bookmarks.KeywordSweeper
+}
+
+func initServices(cfg Configuration) *services {
+	bookmarksRepo, usersRepo := initStorage(cfg)
+	blobStore := initBlobStore(cfg)
+	providers := initOembedRegistry(cfg.Oembed)
+	oembedFetcher := initOembedFetcher(cfg.Oembed, providers)
+	thumbs := thumbnails.NewStore(blobStore, thumbnails.DefaultOptions)
+
+	return &services{
+		bookmarks:  bookmarksRepo,
+		users:      usersRepo,
+		enrichment: initEnrichmentQueue(bookmarksRepo, initCachingFetcher(cfg.Oembed, oembedFetcher, blobStore), thumbs),
+		// the refresher is there to get the latest properties. It does not use the cache
+		refresher:  initRefresher(cfg, bookmarksRepo, oembedFetcher, thumbs),
+		providers:  providers,
+		thumbnails: thumbs,
+		keywords:   bookmarks.NewKeywordSweeper(bookmarksRepo, logger, bookmarks.DefaultSweepInterval),
+	}
+}
+
+// start starts the background services
+func (svc *services) start() {
+	svc.providers.Start()
+	svc.enrichment.Start()
+	svc.refresher.Start()
+	svc.keywords.Start()
+}
+
+// stop waits for the background services to finish their current jobs
+func (svc *services) stop(ctx context.Context) {
+	if err := svc.enrichment.Stop(ctx); err != nil {
+		logger.WithError(err).Warning("enrichment queue did not stop gracefully")
+	}
+	if err := svc.refresher.Stop(ctx); err != nil {
+		logger.WithError(err).Warning("refresher did not stop gracefully")
+	}
+	svc.providers.Stop()
+	svc.keywords.Stop()
+}
+
 func initLogger(cfg Configuration) log.FieldLogger {
 	level, err := log.ParseLevel(cfg.LogLevel)
 	if err != nil {
@@ -49,7 +106,51 @@ func initCSRFProtection(cfg Configuration) middlewares.Middleware {
 	return csrf.Protect(cfg.CSRFSecret, csrf.Secure(!cfg.DisableCSRFProtection))
 }
 
-func initDB(cfg DatabaseConfig) *sqlx.DB {
+// initStorage returns the repositories backed by the configured storage driver
+// Configured users are registered so that they can own bookmarks
+func initStorage(cfg Configuration) (bookmarks.Repository, users.Repository) {
+	var (
+		bookmarksRepo bookmarks.Repository
+		usersRepo     users.Repository
+	)
+
+	db, driver := initDB(cfg)
+	switch driver {
+	case database.DriverMySQL:
+		initMigrations(db, driver)
+		bookmarksRepo, usersRepo = bookmarks.NewRepository(db), users.NewRepository(db)
+	case database.DriverSQLite:
+		initMigrations(db, driver)
+		bookmarksRepo, usersRepo = bookmarks.NewSQLiteRepository(db), users.NewRepository(db)
+	default:
+		bookmarksRepo, usersRepo = bookmarks.NewMemoryRepository(), users.NewMemoryRepository()
+	}
+
+	for name := range cfg.BasicAuthUsers {
+		if _, err := usersRepo.Register(name); err != nil {
+			panic(err)
+		}
+	}
+
+	return bookmarksRepo, usersRepo
+}
+
+// initDB connects to the database of the configured storage driver
+// It returns the database driver, or no database at all for the memory driver
+func initDB(cfg Configuration) (*sqlx.DB, string) {
+	switch cfg.StorageDriver {
+	case "", StorageDriverMySQL:
+		return initMySQL(cfg.DBConfig), database.DriverMySQL
+	case StorageDriverSQLite:
+		return initSQLite(cfg.SQLitePath), database.DriverSQLite
+	case StorageDriverMemory:
+		return nil, ""
+	default:
+		panic(fmt.Errorf("unknown storage driver: %s", cfg.StorageDriver))
+	}
+}
+
+func initMySQL(cfg DatabaseConfig) *sqlx.DB {
 	// see https://github.com/go-sql-driver/mysql/issues/9 for the explanation of ?parseTime=true
 	configuration := fmt.Sprintf(
 		"%s:%s@tcp(%s:3306)/%s?parseTime=true",
@@ -62,16 +163,124 @@ func initDB(cfg DatabaseConfig) *sqlx.DB {
 	return sqlx.MustConnect("mysql", configuration)
 }
 
-func initBookmarksRepo(db *sqlx.DB) bookmarks.Repository {
-	return bookmarks.NewRepository(db)
+// initSQLite opens the SQLite database
+// The driver is only available when compiled with -tags sqlite
+func initSQLite(path string) *sqlx.DB {
+	if path == "" {
+		path = "bookmarks.db"
+	}
+
+	db := sqlx.MustConnect("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=1&_busy_timeout=5000", path))
+	// SQLite does not support concurrent writes anyway
+	db.SetMaxOpenConns(1)
+
+	return db
 }
 
-func initOembedFetcher(logger log.FieldLogger) oembed.Fetcher {
-	fetcher, err := oembed.NewFetcher(logger)
-	// There might be a way to have a graceful degradation here
-	// but what's the point of starting this app if we can't fetch oembed props?
+// initMigrations applies the pending migrations
+// Replicas starting at the same time wait for each other
+func initMigrations(db *sqlx.DB, driver string) {
+	migrator, err := database.NewMigrator(db, driver)
+	if err != nil {
+		panic(err)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, m := range applied {
+		logger.WithField("version", m.Version).Infof("migration %s applied", m.Name)
+	}
+}
+
+// initBlobStore returns the store of files like thumbnails
+// They are kept in memory with the memory storage driver so that nothing outlives the bookmarks
+func initBlobStore(cfg Configuration) blobs.Store {
+	if cfg.StorageDriver == StorageDriverMemory {
+		return blobs.NewMemoryStore()
+	}
+
+	dir := cfg.BlobsDir
+	if dir == "" {
+		dir = "data/blobs"
+	}
+
+	store, err := blobs.NewFileStore(dir)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func initEnrichmentQueue(repo bookmarks.Repository, fetcher oembed.Fetcher, thumbs thumbnails.Store) enrichment.Queue {
+	return enrichment.NewQueue(repo, fetcher, thumbs, logger, enrichment.DefaultOptions)
+}
+
+func initRefresher(cfg Configuration, repo bookmarks.Repository, fetcher oembed.Fetcher, thumbs thumbnails.Store) enrichment.Refresher {
+	opts := enrichment.DefaultRefreshOptions
+	if cfg.RefreshMaxAge > 0 {
+		opts.MaxAge = cfg.RefreshMaxAge
+	}
+	return enrichment.NewRefresher(repo, fetcher, thumbs, logger, opts)
+}
+
+// initOembedFetcher returns a fetcher using the oEmbed providers first,
+// then the metadata of the page for the sites that are not providers
+// Calls are rate limited so that we do not get throttled
+func initOembedFetcher(cfg OembedConfig, providers oembed.Registry) oembed.Fetcher {
+	rateLimit := oembed.DefaultRateLimitOptions
+	if cfg.RateLimit > 0 {
+		rateLimit.Rate = cfg.RateLimit
+	}
+	if cfg.RateBurst > 0 {
+		rateLimit.Burst = cfg.RateBurst
+	}
+	limiter := oembed.NewRateLimiter(rateLimit)
+
+	fetcher, err := oembed.NewFetcher(providers, cfg.CustomProviders, limiter, logger, oembed.DefaultFetcherOptions)
+	if err != nil {
+		panic(err)
+	}
+
+	return oembed.NewChainFetcher(fetcher, oembed.NewHTMLFetcher(limiter, logger, oembed.DefaultFetcherOptions))
+}
+
+// initCachingFetcher caches the responses of a fetcher
+func initCachingFetcher(cfg OembedConfig, fetcher oembed.Fetcher, blobStore blobs.Store) oembed.Fetcher {
+	cacheSize := cfg.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = 1000
+	}
+	var cacheStore blobs.Store
+	if cfg.PersistCache {
+		cacheStore = blobStore
+	}
+
+	return oembed.NewCachingFetcher(fetcher, oembed.NewCache(cacheSize, cacheStore, logger), oembed.DefaultCacheOptions)
+}
+
+// initOembedRegistry loads the oEmbed providers
+// The last good copy is used if the source is down. There might be a way to have a graceful
+// degradation if there is no copy at all, but what's the point of starting this app if we
+// can't fetch oembed props?
+func initOembedRegistry(cfg OembedConfig) oembed.Registry {
+	opts := oembed.RegistryOptions{
+		Source:          cfg.ProvidersSource,
+		CachePath:       cfg.ProvidersCachePath,
+		RefreshInterval: cfg.ProvidersRefreshInterval,
+	}
+	if opts.Source == "" {
+		opts.Source = oembed.ProvidersURL
+	}
+	if opts.RefreshInterval == 0 {
+		opts.RefreshInterval = 24 * time.Hour
+	}
+
+	registry, err := oembed.NewRegistry(opts, logger)
 	if err != nil {
 		panic(err)
 	}
-	return fetcher
+	return registry
 }
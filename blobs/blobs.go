@@ -0,0 +1,196 @@
+// Package blobs stores binary files like thumbnails
+// The local filesystem is used by default. Other backends (S3...) only need to implement Store
+package blobs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store stores blobs by key. Keys are slash separated paths (thumbnails/12.jpg)
+type Store interface {
+	// Put creates or replaces a blob
+	Put(key string, content io.Reader) error
+	// Get opens a blob. The caller must close it
+	// Returns a NotFoundError if the blob does not exist
+	Get(key string) (*Blob, error)
+	// Delete deletes a blob. Deleting a missing blob is not an error
+	Delete(key string) error
+}
+
+// Blob is an opened blob
+type Blob struct {
+	io.ReadSeeker
+	io.Closer
+	ModTime time.Time
+}
+
+// NotFoundError is returned when a blob does not exist
+type NotFoundError struct {
+	Key string
+}
+
+// Error implements the Error interface
+func (err *NotFoundError) Error() string {
+	return fmt.Sprintf("blob %s not found", err.Key)
+}
+
+// validKey rejects keys that could escape the root of the store
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key: %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key: %q", key)
+		}
+	}
+	return nil
+}
+
+type fileStore struct {
+	root string
+}
+
+// NewFileStore returns a store keeping blobs in a local directory
+func NewFileStore(root string) (Store, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &fileStore{root: root}, nil
+}
+
+func (s *fileStore) path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put implements the Store interface
+// Blobs are written to a temporary file first so that readers never see partial content
+func (s *fileStore) Put(key string, content io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get implements the Store interface
+func (s *fileStore) Get(key string) (*Blob, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, &NotFoundError{Key: key}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Blob{ReadSeeker: f, Closer: f, ModTime: info.ModTime()}, nil
+}
+
+// Delete implements the Store interface
+func (s *fileStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type memoryBlob struct {
+	content []byte
+	modTime time.Time
+}
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+// NewMemoryStore returns a store keeping blobs in memory
+// Everything is lost when the app stops. Useful for tests and demos
+func NewMemoryStore() Store {
+	return &memoryStore{blobs: map[string]memoryBlob{}}
+}
+
+// Put implements the Store interface
+func (s *memoryStore) Put(key string, content io.Reader) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = memoryBlob{content: b, modTime: time.Now()}
+	return nil
+}
+
+// Get implements the Store interface
+func (s *memoryStore) Get(key string) (*Blob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, &NotFoundError{Key: key}
+	}
+
+	return &Blob{ReadSeeker: bytes.NewReader(blob.content), Closer: ioutil.NopCloser(nil), ModTime: blob.modTime}, nil
+}
+
+// Delete implements the Store interface
+func (s *memoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
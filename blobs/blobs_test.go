@@ -0,0 +1,49 @@
+package blobs
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for name, s := range map[string]Store{"file": fileStore, "memory": NewMemoryStore()} {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, s)
+		})
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	_, err := s.Get("thumbnails/1.jpg")
+	assert.IsType(t, &NotFoundError{}, err)
+
+	assert.NoError(t, s.Put("thumbnails/1.jpg", strings.NewReader("first")))
+	assert.NoError(t, s.Put("thumbnails/1.jpg", strings.NewReader("second")))
+
+	blob, err := s.Get("thumbnails/1.jpg")
+	if assert.NoError(t, err) {
+		content, err := ioutil.ReadAll(blob)
+		assert.NoError(t, err)
+		assert.Equal(t, "second", string(content))
+		assert.False(t, blob.ModTime.IsZero())
+		assert.NoError(t, blob.Close())
+	}
+
+	assert.NoError(t, s.Delete("thumbnails/1.jpg"))
+	_, err = s.Get("thumbnails/1.jpg")
+	assert.IsType(t, &NotFoundError{}, err)
+	// deleting twice is harmless
+	assert.NoError(t, s.Delete("thumbnails/1.jpg"))
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "thumbnails/../../secret", "thumbnails//1.jpg"} {
+		assert.Error(t, s.Put(key, strings.NewReader("x")), key)
+	}
+}
@@ -1,12 +1,14 @@
 package bookmarks
 
 import (
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/fchoquet/bookmarks/oembed"
 	"github.com/fchoquet/bookmarks/pager"
 	"github.com/jmoiron/sqlx"
-	"gopkg.in/go-playground/validator.v9"
 )
 
 // Bookmark represents a bookmark
@@ -14,11 +16,11 @@ type Bookmark struct {
 	ID int `json:"id;omitempty" db:"id"`
 
 	// Shared properties
-	// Some properties are required at the domain level but not in the API
-	// Missing properties are populated using oEmbed
-	URL        string     `json:"url" db:"url" validate:"required,max=255"`
-	Title      string     `json:"title" db:"title" validate:"required,max=100"`
-	AuthorName string     `json:"author_name" db:"author_name" validate:"required,max=100"`
+	// Missing properties are populated asynchronously using oEmbed
+	// so only the URL is required
+	URL        string     `json:"url" db:"url" validate:"required,max=255,url"`
+	Title      string     `json:"title" db:"title" validate:"max=100"`
+	AuthorName string     `json:"author_name" db:"author_name" validate:"max=100"`
 	AddedDate  *time.Time `json:"added_date" db:"added_date"`
 
 	// These properties are specific to the target link and might not make sense
@@ -28,100 +30,535 @@ type Bookmark struct {
 	Height   int `json:"height;omitempty" db:"height"`
 	Duration int `json:"duration;omitempty" db:"duration"`
 
-	Keywords []Keyword `json:"keywords"`
+	// oEmbed provider and link type. Might be empty if unknown
+	Provider oembed.Provider `json:"provider,omitempty" db:"provider_name"`
+	Type     oembed.LinkType `json:"type,omitempty" db:"link_type"`
 
-	// TODO: Bookmarks should be attached to a user. I'm not sure if it's in the
-	// scope of this exercise
-	UserID int
+	// Other oEmbed properties. Most of them are optional
+	ProviderURL     string `json:"provider_url,omitempty" db:"provider_url" validate:"max=2000"`
+	AuthorURL       string `json:"author_url,omitempty" db:"author_url" validate:"max=2000"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty" db:"thumbnail_url" validate:"max=2000"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty" db:"thumbnail_width"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty" db:"thumbnail_height"`
+	// The source of the image of photo links. The bookmarked URL is usually a page showing it
+	PhotoURL string `json:"photo_url,omitempty" db:"photo_url" validate:"max=2000"`
+	// The embed code returned by the provider. It is not sanitized
+	HTML string `json:"html,omitempty" db:"html" validate:"max=65535"`
+	// How long the provider allows caching the properties, in seconds
+	CacheAge int `json:"cache_age,omitempty" db:"cache_age"`
+	// Tells if a resized copy of the thumbnail is stored locally
+	HasThumbnail bool `json:"has_thumbnail" db:"has_thumbnail"`
+
+	// Host is derived from the URL. It is stored to allow filtering by site
+	Host string `json:"-" db:"host"`
+	// CanonicalURL is the normalized URL (see CanonicalURL), replaced by the canonical page
+	// returned by the provider once enriched. Users cannot bookmark the same page twice
+	CanonicalURL string `json:"canonical_url,omitempty" db:"canonical_url"`
+
+	// Tells if oEmbed properties have been fetched
+	EnrichmentStatus EnrichmentStatus `json:"enrichment_status" db:"enrichment_status"`
+	EnrichmentError  string           `json:"enrichment_error,omitempty" db:"enrichment_error"`
+
+	// When oEmbed properties were last fetched. They are refreshed periodically
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty" db:"last_refreshed_at"`
+	// When the refresh is tried again after a failure. nil if the last refresh succeeded
+	NextRefreshAt *time.Time `json:"-" db:"next_refresh_at"`
+	// The provider does not know this link anymore
+	DeadLink bool `json:"dead_link" db:"dead_link"`
+
+	// Keywords are normalized when saved, see NormalizeKeyword, and synonyms are resolved
+	Keywords []Keyword `json:"keywords" validate:"dive,max=50"`
+
+	// Notes are free text written by the user
+	Notes string `json:"notes" db:"notes" validate:"max=10000"`
+
+	// Version is incremented by every edit of the user. Background jobs do not change it
+	// Edits based on an older version are rejected with a VersionConflictError
+	Version   int        `json:"version" db:"version"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+
+	// The owner of the bookmark. Never exposed, the API only returns bookmarks
+	// owned by the authenticated user anyway
+	UserID int `json:"-" db:"user_id" validate:"required"`
 }
 
+// EnrichmentStatus tells if the oEmbed properties of a bookmark have been fetched
+type EnrichmentStatus string
+
+// Enrichment statuses
+const (
+	EnrichmentPending EnrichmentStatus = "pending"
+	EnrichmentDone    EnrichmentStatus = "done"
+	EnrichmentFailed  EnrichmentStatus = "failed"
+)
+
 // Repository stores bookmarks to a permanent storage
+// Bookmarks are private: every method is scoped to the user owning them
 type Repository interface {
-	// List returns a list of bookmarks. Can be filtered.
+	// List returns a list of bookmarks owned by filter.UserID. Can be filtered.
 	// It also returns the total number of bookmarks (useful with pagination)
 	List(fitler Filter) ([]*Bookmark, int, error)
 
-	// Load loads a unique bookmark by its URL. returns nil if not found
-	ByID(id int) (*Bookmark, error)
+	// Search returns bookmarks matching a full-text query, most relevant first
+	// The query is matched against titles, authors, URLs and keywords. It
+	// supports quoted phrases and -exclusions (see ParseSearch)
+	// The filter restricts and paginates the results. Its sort is ignored
+	Search(query string, filter Filter) ([]*Bookmark, int, error)
+
+	// Load loads a unique bookmark by its ID. returns nil if not found
+	ByID(userID, id int) (*Bookmark, error)
+
+	// Insert creates a new bookmark owned by b.UserID
+	// Returns a ValidationError if the bookmark is not valid and a DuplicateError
+	// if the user already bookmarked the same canonical URL
+	Insert(b *Bookmark) (*Bookmark, error)
+
+	// Update saves the edits of a bookmark owned by b.UserID: URL, title, author name, notes
+	// and keywords, as well as its oEmbed properties and enrichment status, reset when the URL changes
+	// b.Version is the version the edits are based on. Returns a ValidationError if the edits are
+	// not valid, a VersionConflictError if the bookmark was edited since, a NotFoundError if the user
+	// does not own it and a DuplicateError if the new URL is already bookmarked
+	// On success b.Version is incremented and b.UpdatedAt is set
+	Update(b *Bookmark) error
+
+	// Update updates an existing bookmark's keywords. Like any edit it increments the version
+	// Returns a NotFoundError if the user does not own this bookmark and a ValidationError
+	// if a keyword is too long
+	UpdateKeywords(userID, id int, keywords []Keyword) error
+
+	// Keywords returns the keywords of a user with the number of bookmarks having them, by name
+	Keywords(userID int) ([]*KeywordUsage, error)
+
+	// RenameKeyword renames a keyword on all the bookmarks of a user
+	// Returns a KeywordNotFoundError if no bookmark of the user has it, a KeywordExistsError
+	// if the user already has the new one and a ValidationError if the new name is not valid
+	// The version of the bookmarks is incremented, like for any edit. The aliases of the keyword
+	// follow it. The children of hierarchical keywords are not renamed
+	RenameKeyword(userID int, from, to Keyword) error
+
+	// MergeKeyword replaces a keyword by another one, existing or not, on all the bookmarks of a user
+	// Bookmarks having both keep one. Errors are the ones of RenameKeyword
+	MergeKeyword(userID int, from, into Keyword) error
+
+	// DeleteKeyword removes a keyword from all the bookmarks of a user
+	// Returns a KeywordNotFoundError if no bookmark of the user has it
+	DeleteKeyword(userID int, name Keyword) error
+
+	// DeleteOrphanKeywords deletes the keywords no bookmark has anymore and returns how many
+	// Keywords are shared by all the users. Like the enrichment methods, it is used by background jobs
+	DeleteOrphanKeywords() (int, error)
+
+	// Synonyms returns the synonyms of a user, by keyword
+	Synonyms(userID int) ([]*Synonym, error)
 
-	// Insert creates a new bookmark. Returns an error if already exists
-	Insert(*Bookmark) (*Bookmark, error)
+	// AddSynonym makes a keyword an alias of another one for a user and returns the saved synonym
+	// If the keyword is an alias itself, the alias is added to its set. The bookmarks tagged with
+	// the alias are tagged with the keyword instead. Returns a ValidationError if the synonym is not valid
+	AddSynonym(userID int, alias, keyword Keyword) (*Synonym, error)
 
-	// Update updates an existing bookmark's keywords
-	UpdateKeywords(id int, keywords []Keyword) error
+	// DeleteSynonym deletes an alias of a user. The bookmarks are not changed
+	// Returns a SynonymNotFoundError if the user has no such alias
+	DeleteSynonym(userID int, alias Keyword) error
 
 	// Delete delets an existing bookmark
-	Delete(id int) error
+	// Returns a NotFoundError if the user does not own this bookmark
+	Delete(userID, id int) error
+
+	// SaveEnrichment updates the oEmbed properties and the enrichment status of a bookmark
+	// A non-empty canonical URL is saved too, unless another bookmark of the user already has it
+	// Other properties are left untouched. Does nothing if the bookmark does not exist anymore
+	// or if it was edited since b was loaded (b.Version is outdated): the edit wins
+	// Like the following methods, it is used by background jobs so it is not scoped to a user
+	SaveEnrichment(b *Bookmark) error
+
+	// PendingEnrichments returns bookmarks whose oEmbed properties have not been fetched yet
+	// oldest first
+	PendingEnrichments(limit int) ([]*Bookmark, error)
+
+	// StaleBookmarks returns enriched bookmarks not refreshed since before, and the ones whose
+	// last refresh failed once their next refresh is due at now. Bookmarks never refreshed are
+	// compared using their added date. Least recently refreshed first
+	StaleBookmarks(before, now time.Time, limit int) ([]*Bookmark, error)
 }
 
 // Filter allows filtering of Bookmarks
 type Filter struct {
-	ID    *int
+	// UserID is mandatory. Users can't see each other's bookmarks
+	UserID int
+	ID     *int
+	// URL matches the exact URL of the bookmark
+	URL   string
 	Pager pager.Pager
+	// Zero values sort bookmarks by insertion order
+	Sort  SortField
+	Order SortOrder
+
+	// Keywords filters bookmarks tagged with any (or all, see KeywordsMatch) of these keywords
+	Keywords      []Keyword
+	KeywordsMatch KeywordsMatch
+	AuthorName    string
+	Provider      oembed.Provider
+	Type          oembed.LinkType
+	// Host matches the site of the bookmark, with or without the www prefix
+	Host string
+	// AddedAfter is inclusive, AddedBefore is exclusive
+	AddedAfter  *time.Time
+	AddedBefore *time.Time
 }
 
-// NewRepository returns a default Repository implementation
+// KeywordsMatch defines how keyword filters are combined
+type KeywordsMatch string
+
+// Available keyword matches. The default is MatchAny
+const (
+	MatchAny KeywordsMatch = "any"
+	MatchAll KeywordsMatch = "all"
+)
+
+// Valid returns true if the match is a known one
+func (m KeywordsMatch) Valid() bool {
+	return m == MatchAny || m == MatchAll
+}
+
+// SortField is a field bookmarks can be sorted by
+type SortField string
+
+// Available sort fields
+const (
+	SortByAddedDate SortField = "added_date"
+	SortByTitle     SortField = "title"
+	SortByAuthor    SortField = "author"
+)
+
+// sortColumns maps sort fields to DB columns
+var sortColumns = map[SortField]string{
+	SortByAddedDate: "added_date",
+	SortByTitle:     "title",
+	SortByAuthor:    "author_name",
+}
+
+// Valid returns true if bookmarks can be sorted by this field
+func (f SortField) Valid() bool {
+	_, ok := sortColumns[f]
+	return ok
+}
+
+// SortOrder is the direction of a sort
+type SortOrder string
+
+// Available sort orders
+const (
+	OrderAsc  SortOrder = "asc"
+	OrderDesc SortOrder = "desc"
+)
+
+// Valid returns true if the order is a known one
+func (o SortOrder) Valid() bool {
+	return o == OrderAsc || o == OrderDesc
+}
+
+// NotFoundError is returned when a bookmark does not exist or is owned by another user
+type NotFoundError struct {
+	ID int
+}
+
+// Error implements the Error interface
+func (err *NotFoundError) Error() string {
+	return fmt.Sprintf("bookmark %d not found", err.ID)
+}
+
+// KeywordNotFoundError is returned when no bookmark of a user has a keyword
+type KeywordNotFoundError struct {
+	Name Keyword
+}
+
+// Error implements the Error interface
+func (err *KeywordNotFoundError) Error() string {
+	return fmt.Sprintf("keyword %s not found", err.Name)
+}
+
+// KeywordExistsError is returned when renaming a keyword to one the user already has
+// Keywords can be merged instead
+type KeywordExistsError struct {
+	Name Keyword
+}
+
+// Error implements the Error interface
+func (err *KeywordExistsError) Error() string {
+	return fmt.Sprintf("keyword %s already exists", err.Name)
+}
+
+// SynonymNotFoundError is returned when deleting an alias a user does not have
+type SynonymNotFoundError struct {
+	Alias Keyword
+}
+
+// Error implements the Error interface
+func (err *SynonymNotFoundError) Error() string {
+	return fmt.Sprintf("synonym %s not found", err.Alias)
+}
+
+// VersionConflictError is returned when a bookmark was edited since the version an edit is based on
+type VersionConflictError struct {
+	ID int
+	// the current version of the bookmark
+	Version int
+}
+
+// Error implements the Error interface
+func (err *VersionConflictError) Error() string {
+	return fmt.Sprintf("bookmark %d was modified since (current version: %d)", err.ID, err.Version)
+}
+
+// DuplicateError is returned when a user bookmarks a page twice
+type DuplicateError struct {
+	URL string
+	// the existing bookmark. 0 if it could not be found, e.g. deleted in the meantime
+	ID int
+}
+
+// Error implements the Error interface
+func (err *DuplicateError) Error() string {
+	if err.ID == 0 {
+		return fmt.Sprintf("%s is already bookmarked", err.URL)
+	}
+	return fmt.Sprintf("%s is already bookmarked (bookmark %d)", err.URL, err.ID)
+}
+
+// NewRepository returns a default Repository implementation, backed by MySQL
 // Let's not use anything more fancy than sqlx
 // Raw sql is enough given the extreme simplicity of the queries
 func NewRepository(db *sqlx.DB) Repository {
 	return &repository{
-		db: db,
+		db:      db,
+		dialect: mysqlDialect{},
 	}
 }
 
+// NewSQLiteRepository returns a Repository implementation backed by SQLite
+// The driver must be registered by the caller
+func NewSQLiteRepository(db *sqlx.DB) Repository {
+	return &repository{
+		db:      db,
+		dialect: sqliteDialect{},
+	}
+}
+
+// repository is shared by SQL databases. Most queries are standard SQL
+// The differences are isolated in a dialect
 type repository struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	dialect dialect
+}
+
+// dialect isolates the SQL that differs between database engines
+type dialect interface {
+	// forUpdate returns the clause locking selected rows until the end of the transaction
+	forUpdate() string
+
+	// isDuplicate tells if err is the violation of a unique index
+	isDuplicate(err error) bool
+
+	// search returns the condition matching search terms and the ORDER BY clause
+	// sorting the results by relevance. Arguments are added to args
+	// ok is false if there is nothing to search
+	search(terms []SearchTerm, args map[string]interface{}) (condition, orderBy string, ok bool)
 }
 
+// bookmarkColumns lists the columns mapped to the Bookmark struct
+// Let's not use SELECT * so that adding a column does not break existing code
+// Canonical URLs are NULL for the duplicates saved before they were detected
+const bookmarkColumns = `id, user_id, url, title, author_name, added_date, width, height, duration,
+provider_name, link_type, host, enrichment_status, enrichment_error, last_refreshed_at, next_refresh_at,
+dead_link, provider_url, author_url, thumbnail_url, thumbnail_width, thumbnail_height, html, cache_age,
+has_thumbnail, photo_url, notes, version, updated_at, COALESCE(canonical_url, '') AS canonical_url`
+
 func (rep *repository) List(filter Filter) ([]*Bookmark, int, error) {
-	sql := `SELECT * FROM bookmarks`
-	args := struct {
-		ID int
-	}{}
+	var err error
+	if filter.Keywords, err = resolveKeywords(rep.db, filter.UserID, filter.Keywords); err != nil {
+		return nil, 0, err
+	}
 
-	if filter.ID != nil {
-		sql += ` WHERE id = :id`
-		args.ID = *filter.ID
+	where, args := filter.where()
+	return rep.list(where, filter.orderBy(), args, filter.Pager)
+}
+
+func (rep *repository) Search(query string, filter Filter) ([]*Bookmark, int, error) {
+	var err error
+	if filter.Keywords, err = resolveKeywords(rep.db, filter.UserID, filter.Keywords); err != nil {
+		return nil, 0, err
 	}
 
-	if filter.Pager == nil {
-		filter.Pager = pager.NoPager()
+	where, args := filter.where()
+
+	condition, orderBy, ok := rep.dialect.search(ParseSearch(query), args)
+	if !ok {
+		// nothing searchable
+		return []*Bookmark{}, 0, nil
 	}
 
-	rows, err := rep.db.NamedQuery(sql, args)
-	if err != nil {
+	return rep.list(where+` AND `+condition, orderBy, args, filter.Pager)
+}
+
+// list runs a paginated query. It also returns the total number of matching bookmarks
+func (rep *repository) list(where, orderBy string, args map[string]interface{}, p pager.Pager) ([]*Bookmark, int, error) {
+	if p == nil {
+		p = pager.NoPager()
+	}
+
+	// count first, it saves the main query if the page is out of range
+	var count int
+	if err := rep.namedGet(&count, `SELECT COUNT(*) FROM bookmarks WHERE `+where, args); err != nil {
 		return nil, 0, err
 	}
-	defer rows.Close()
 
 	bookmarks := []*Bookmark{}
-	index := -1
-	for rows.Next() {
-		index++
-		if !filter.Pager.IsVisible(index) {
-			continue
-		}
+	if count == 0 || p.First() >= count {
+		return bookmarks, count, nil
+	}
+
+	sql := `SELECT ` + bookmarkColumns + ` FROM bookmarks WHERE ` + where + ` ORDER BY ` + orderBy
+	if p.Enabled() {
+		sql += ` LIMIT :limit OFFSET :offset`
+		args["limit"] = p.Limit()
+		args["offset"] = p.First()
+	}
+
+	if err := rep.namedSelect(&bookmarks, sql, args); err != nil {
+		return nil, 0, err
+	}
+
+	if err := loadKeywords(rep.db, bookmarks); err != nil {
+		return nil, 0, err
+	}
+
+	return bookmarks, count, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// escapeLike escapes the LIKE wildcards using ! as escape character, in all dialects
+// Patterns must be followed by ESCAPE '!'
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
 
-		var b Bookmark
-		if err = rows.StructScan(&b); err != nil {
-			return nil, 0, err
+// where builds the WHERE clause matching the filter, with its named arguments
+// Keywords must be normalized
+func (filter Filter) where() (string, map[string]interface{}) {
+	conditions := []string{`user_id = :user_id`}
+	args := map[string]interface{}{
+		"user_id": filter.UserID,
+	}
+
+	if filter.ID != nil {
+		conditions = append(conditions, `id = :id`)
+		args["id"] = *filter.ID
+	}
+
+	if len(filter.Keywords) > 0 {
+		// named parameters do not support slices, so let's generate them per keyword
+		// a keyword matches itself and its children: video matches video/tutorials
+		matches := make([]string, 0, len(filter.Keywords))
+		for i, kw := range filter.Keywords {
+			name := fmt.Sprintf("keyword_%d", i)
+			matches = append(matches, fmt.Sprintf(`(kw.name = :%[1]s OR kw.name LIKE :%[1]s_children ESCAPE '!')`, name))
+			args[name] = string(kw)
+			args[name+"_children"] = escapeLike(string(kw)) + KeywordSeparator + "%"
 		}
 
-		keywords, err := loadKeywords(rep.db, b.ID)
-		if err != nil {
-			return nil, 0, err
+		subQuery := `
+SELECT bkw.bookmark_id
+FROM bookmark_keywords bkw
+INNER JOIN keywords kw ON kw.id = bkw.keyword_id
+WHERE `
+
+		if filter.KeywordsMatch == MatchAll {
+			// several children can match the same keyword, so let's use a sub-query per keyword
+			for _, match := range matches {
+				conditions = append(conditions, `id IN (`+subQuery+match+`)`)
+			}
+		} else {
+			conditions = append(conditions, `id IN (`+subQuery+strings.Join(matches, " OR ")+`)`)
 		}
+	}
+
+	if filter.URL != "" {
+		conditions = append(conditions, `url = :url`)
+		args["url"] = filter.URL
+	}
+
+	if filter.AuthorName != "" {
+		conditions = append(conditions, `author_name = :author_name`)
+		args["author_name"] = filter.AuthorName
+	}
+
+	if filter.Provider != "" {
+		conditions = append(conditions, `provider_name = :provider_name`)
+		args["provider_name"] = string(filter.Provider)
+	}
+
+	if filter.Type != "" {
+		conditions = append(conditions, `link_type = :link_type`)
+		args["link_type"] = string(filter.Type)
+	}
+
+	if filter.Host != "" {
+		conditions = append(conditions, `host = :host`)
+		args["host"] = normalizeHost(filter.Host)
+	}
+
+	if filter.AddedAfter != nil {
+		conditions = append(conditions, `added_date >= :added_after`)
+		args["added_after"] = filter.AddedAfter.UTC()
+	}
+
+	if filter.AddedBefore != nil {
+		conditions = append(conditions, `added_date < :added_before`)
+		args["added_before"] = filter.AddedBefore.UTC()
+	}
+
+	return strings.Join(conditions, ` AND `), args
+}
 
-		b.Keywords = keywords
+// orderBy builds the ORDER BY clause. Unknown fields fall back to insertion order
+// Columns can't be passed as query arguments but they are whitelisted so this is safe
+func (filter Filter) orderBy() string {
+	direction := `ASC`
+	if filter.Order == OrderDesc {
+		direction = `DESC`
+	}
 
-		bookmarks = append(bookmarks, &b)
+	column, ok := sortColumns[filter.Sort]
+	if !ok {
+		return `id ` + direction
 	}
 
-	return bookmarks, index + 1, nil
+	// id is a tie-breaker, otherwise pages are not stable
+	return column + ` ` + direction + `, id ` + direction
 }
 
-func (rep *repository) ByID(id int) (*Bookmark, error) {
-	bookmarks, _, err := rep.List(Filter{ID: &id})
+// namedGet is the named parameters version of sqlx.Get
+func (rep *repository) namedGet(dest interface{}, sql string, args map[string]interface{}) error {
+	query, params, err := sqlx.Named(sql, args)
+	if err != nil {
+		return err
+	}
+	return rep.db.Get(dest, rep.db.Rebind(query), params...)
+}
+
+// namedSelect is the named parameters version of sqlx.Select
+func (rep *repository) namedSelect(dest interface{}, sql string, args map[string]interface{}) error {
+	query, params, err := sqlx.Named(sql, args)
+	if err != nil {
+		return err
+	}
+	return rep.db.Select(dest, rep.db.Rebind(query), params...)
+}
+
+func (rep *repository) ByID(userID, id int) (*Bookmark, error) {
+	bookmarks, _, err := rep.List(Filter{UserID: userID, ID: &id})
 	if err != nil || len(bookmarks) == 0 {
 		return nil, err
 	}
@@ -130,26 +567,36 @@ func (rep *repository) ByID(id int) (*Bookmark, error) {
 }
 
 func (rep *repository) Insert(b *Bookmark) (*Bookmark, error) {
-	if err := validator.New().Struct(b); err != nil {
+	var err error
+	if b.Keywords, err = resolveKeywords(rep.db, b.UserID, b.Keywords); err != nil {
 		return nil, err
 	}
 
-	// generates an added date if none passed
-	if b.AddedDate == nil {
-		now := time.Now()
-		b.AddedDate = &now
+	if err = validate(b); err != nil {
+		return nil, err
 	}
 
+	prepareInsert(b)
+
 	// start a transaction
 	tx, err := rep.db.Beginx()
 	if err != nil {
 		return nil, err
 	}
 
+	if err := rep.checkDuplicate(tx, b); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	newB, err := insert(tx, b)
 	if err != nil {
 		// there's little we can do if Rollback fails, so let's ignore this case
 		tx.Rollback()
+		if rep.dialect.isDuplicate(err) {
+			// inserted concurrently. It is committed now
+			return nil, rep.duplicateOf(b)
+		}
 		return nil, err
 	}
 
@@ -160,13 +607,41 @@ func (rep *repository) Insert(b *Bookmark) (*Bookmark, error) {
 	return newB, nil
 }
 
+// prepareInsert populates the generated properties of a new bookmark
+func prepareInsert(b *Bookmark) {
+	// generates an added date if none passed
+	// dates are stored in UTC so that they can be compared whatever the engine
+	addedDate := time.Now().UTC()
+	if b.AddedDate != nil {
+		addedDate = b.AddedDate.UTC()
+	}
+	b.AddedDate = &addedDate
+
+	b.Host = hostOf(b.URL)
+	b.CanonicalURL = CanonicalURL(b.URL)
+
+	// bookmarks are complete unless told otherwise
+	if b.EnrichmentStatus == "" {
+		b.EnrichmentStatus = EnrichmentDone
+	}
+
+	b.Version = 1
+	b.UpdatedAt = nil
+}
+
 func insert(tx *sqlx.Tx, b *Bookmark) (*Bookmark, error) {
-	// the primary key on url will ensure that the record does not exist
+	// the unique index on the canonical URL ensures that the user did not bookmark the page yet
 	sql := `
 INSERT INTO bookmarks (
-    url, title, author_name, added_date, width, height, duration
+    user_id, url, title, author_name, added_date, width, height, duration,
+    provider_name, link_type, host, enrichment_status, enrichment_error, last_refreshed_at, dead_link,
+    provider_url, author_url, thumbnail_url, thumbnail_width, thumbnail_height, html, cache_age,
+    has_thumbnail, photo_url, notes, version, canonical_url
 ) VALUES (
-    :url, :title, :author_name, :added_date, :width, :height, :duration
+    :user_id, :url, :title, :author_name, :added_date, :width, :height, :duration,
+    :provider_name, :link_type, :host, :enrichment_status, :enrichment_error, :last_refreshed_at, :dead_link,
+    :provider_url, :author_url, :thumbnail_url, :thumbnail_width, :thumbnail_height, :html, :cache_age,
+    :has_thumbnail, :photo_url, :notes, :version, NULLIF(:canonical_url, '')
 )
 `
 	res, err := tx.NamedExec(sql, b)
@@ -188,27 +663,155 @@ INSERT INTO bookmarks (
 	return b, nil
 }
 
-func (rep *repository) UpdateKeywords(id int, keywords []Keyword) error {
+func (rep *repository) Update(b *Bookmark) error {
+	var err error
+	if b.Keywords, err = resolveKeywords(rep.db, b.UserID, b.Keywords); err != nil {
+		return err
+	}
+
+	if err = validate(b); err != nil {
+		return err
+	}
+
 	tx, err := rep.db.Beginx()
 	if err != nil {
 		return err
 	}
 
+	if err := rep.update(tx, b); err != nil {
+		tx.Rollback()
+		if dup, ok := err.(*DuplicateError); ok && dup.ID == 0 {
+			// the same URL was saved concurrently. It is committed now
+			c := *b
+			c.CanonicalURL = CanonicalURL(b.URL)
+			return rep.duplicateOf(&c)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// update saves the edits of a bookmark in a transaction. See Repository.Update
+func (rep *repository) update(tx *sqlx.Tx, b *Bookmark) error {
+	current, err := rep.lock(tx, b.UserID, b.ID)
+	if err != nil {
+		return err
+	}
+	if current.Version != b.Version {
+		return &VersionConflictError{ID: b.ID, Version: current.Version}
+	}
+
+	updatedAt := time.Now().UTC()
+	c := truncateEnrichment(b)
+	c.Host = hostOf(c.URL)
+	c.UpdatedAt = &updatedAt
+	c.Version = b.Version + 1
+	c.CanonicalURL = current.CanonicalURL
+	if current.URL != b.URL {
+		// the canonical URL returned by the provider was the one of the previous URL
+		c.CanonicalURL = CanonicalURL(c.URL)
+		if err := rep.checkDuplicate(tx, c); err != nil {
+			return err
+		}
+	}
+
+	sql := `
+UPDATE bookmarks SET
+    url = :url,
+    host = :host,
+    title = :title,
+    author_name = :author_name,
+    notes = :notes,
+    width = :width,
+    height = :height,
+    duration = :duration,
+    provider_name = :provider_name,
+    link_type = :link_type,
+    enrichment_status = :enrichment_status,
+    enrichment_error = :enrichment_error,
+    last_refreshed_at = :last_refreshed_at,
+    next_refresh_at = :next_refresh_at,
+    dead_link = :dead_link,
+    provider_url = :provider_url,
+    author_url = :author_url,
+    thumbnail_url = :thumbnail_url,
+    thumbnail_width = :thumbnail_width,
+    thumbnail_height = :thumbnail_height,
+    html = :html,
+    cache_age = :cache_age,
+    has_thumbnail = :has_thumbnail,
+    photo_url = :photo_url,
+    version = :version,
+    updated_at = :updated_at,
+    canonical_url = NULLIF(:canonical_url, '')
+WHERE id = :id
+`
+	if _, err := tx.NamedExec(sql, c); err != nil {
+		if rep.dialect.isDuplicate(err) {
+			// the existing bookmark is looked up by Update, outside of the transaction
+			return &DuplicateError{URL: c.URL}
+		}
+		return err
+	}
+
+	if err := saveKeywords(tx, b.ID, b.Keywords); err != nil {
+		return err
+	}
+
+	b.Host = c.Host
+	b.CanonicalURL = c.CanonicalURL
+	b.Version = c.Version
+	b.UpdatedAt = c.UpdatedAt
+	return nil
+}
+
+func (rep *repository) UpdateKeywords(userID, id int, keywords []Keyword) error {
+	keywords, err := resolveKeywords(rep.db, userID, keywords)
+	if err != nil {
+		return err
+	}
+
+	if err = validate(&keywordList{Keywords: keywords}); err != nil {
+		return err
+	}
+
+	tx, err := rep.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := rep.checkOwnership(tx, userID, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if err := saveKeywords(tx, id, keywords); err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	sql := `UPDATE bookmarks SET version = version + 1, updated_at = ? WHERE id = ?`
+	if _, err := tx.Exec(sql, time.Now().UTC(), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (rep *repository) Delete(id int) error {
+func (rep *repository) Delete(userID, id int) error {
 	tx, err := rep.db.Beginx()
 	if err != nil {
 		return err
 	}
 
-	if err := delete(tx, id); err != nil {
+	if err := rep.checkOwnership(tx, userID, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := deleteBookmark(tx, id); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -216,7 +819,7 @@ func (rep *repository) Delete(id int) error {
 	return tx.Commit()
 }
 
-func delete(tx *sqlx.Tx, id int) error {
+func deleteBookmark(tx *sqlx.Tx, id int) error {
 	if err := deleteKwAssociations(tx, id); err != nil {
 		return err
 	}
@@ -226,6 +829,214 @@ func delete(tx *sqlx.Tx, id int) error {
 	return err
 }
 
+func (rep *repository) SaveEnrichment(b *Bookmark) error {
+	sql := `
+UPDATE bookmarks SET
+    title = :title,
+    author_name = :author_name,
+    width = :width,
+    height = :height,
+    duration = :duration,
+    provider_name = :provider_name,
+    link_type = :link_type,
+    enrichment_status = :enrichment_status,
+    enrichment_error = :enrichment_error,
+    last_refreshed_at = :last_refreshed_at,
+    next_refresh_at = :next_refresh_at,
+    dead_link = :dead_link,
+    provider_url = :provider_url,
+    author_url = :author_url,
+    thumbnail_url = :thumbnail_url,
+    thumbnail_width = :thumbnail_width,
+    thumbnail_height = :thumbnail_height,
+    html = :html,
+    cache_age = :cache_age,
+    has_thumbnail = :has_thumbnail,
+    photo_url = :photo_url
+WHERE id = :id AND version = :version
+`
+	if _, err := rep.db.NamedExec(sql, truncateEnrichment(b)); err != nil {
+		return err
+	}
+
+	// the canonical URL of the provider might reveal a duplicate. The first bookmark keeps it
+	if b.CanonicalURL == "" {
+		return nil
+	}
+
+	sql = `UPDATE bookmarks SET canonical_url = :canonical_url WHERE id = :id AND version = :version
+AND NOT EXISTS (
+    SELECT 1 FROM (
+        SELECT id FROM bookmarks WHERE user_id = :user_id AND canonical_url = :canonical_url AND id <> :id
+    ) AS duplicates
+)`
+	if _, err := rep.db.NamedExec(sql, b); err != nil && !rep.dialect.isDuplicate(err) {
+		return err
+	}
+	return nil
+}
+
+func (rep *repository) PendingEnrichments(limit int) ([]*Bookmark, error) {
+	sql := `SELECT ` + bookmarkColumns + ` FROM bookmarks WHERE enrichment_status = ? ORDER BY id LIMIT ?`
+
+	bookmarks := []*Bookmark{}
+	if err := rep.db.Select(&bookmarks, sql, EnrichmentPending, limit); err != nil {
+		return nil, err
+	}
+
+	if err := loadKeywords(rep.db, bookmarks); err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+func (rep *repository) StaleBookmarks(before, now time.Time, limit int) ([]*Bookmark, error) {
+	sql := `SELECT ` + bookmarkColumns + ` FROM bookmarks
+WHERE enrichment_status <> :pending
+AND (
+    next_refresh_at <= :now
+    OR (next_refresh_at IS NULL AND (last_refreshed_at < :before OR (last_refreshed_at IS NULL AND added_date < :before)))
+)
+ORDER BY COALESCE(next_refresh_at, last_refreshed_at, added_date), id
+LIMIT :limit`
+
+	args := map[string]interface{}{
+		"pending": EnrichmentPending,
+		"before":  before.UTC(),
+		"now":     now.UTC(),
+		"limit":   limit,
+	}
+
+	bookmarks := []*Bookmark{}
+	if err := rep.namedSelect(&bookmarks, sql, args); err != nil {
+		return nil, err
+	}
+
+	if err := loadKeywords(rep.db, bookmarks); err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+// truncateEnrichment makes sure that oEmbed properties fit in the DB columns
+// Providers do not care about our column sizes
+func truncateEnrichment(b *Bookmark) *Bookmark {
+	c := *b
+	c.Title = truncate(c.Title, 100)
+	c.AuthorName = truncate(c.AuthorName, 100)
+	c.EnrichmentError = truncate(c.EnrichmentError, 255)
+	c.Provider = oembed.Provider(truncate(string(c.Provider), 100))
+	// truncated URLs and HTML would be broken anyway
+	c.ProviderURL = dropIfLonger(c.ProviderURL, maxURLLength)
+	c.AuthorURL = dropIfLonger(c.AuthorURL, maxURLLength)
+	c.ThumbnailURL = dropIfLonger(c.ThumbnailURL, maxURLLength)
+	c.PhotoURL = dropIfLonger(c.PhotoURL, maxURLLength)
+	c.HTML = dropIfLonger(c.HTML, maxHTMLLength)
+	if c.LastRefreshedAt != nil {
+		lastRefreshedAt := c.LastRefreshedAt.UTC()
+		c.LastRefreshedAt = &lastRefreshedAt
+	}
+	if c.NextRefreshAt != nil {
+		nextRefreshAt := c.NextRefreshAt.UTC()
+		c.NextRefreshAt = &nextRefreshAt
+	}
+	return &c
+}
+
+// Sizes of the oEmbed columns
+const (
+	maxURLLength = 2000
+	// MySQL TEXT columns hold 64KB
+	maxHTMLLength = 65535
+)
+
+// dropIfLonger returns an empty string if s does not fit in a column
+// Sizes are in bytes to match MySQL TEXT columns, which makes it conservative for varchars
+func dropIfLonger(s string, max int) string {
+	if len(s) > max {
+		return ""
+	}
+	return s
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// checkOwnership returns a NotFoundError if the bookmark does not belong to the user
+// it locks the bookmark row until the end of the transaction
+func (rep *repository) checkOwnership(tx *sqlx.Tx, userID, id int) error {
+	var count int
+	sql := `SELECT COUNT(*) FROM bookmarks WHERE id = ? AND user_id = ?` + rep.dialect.forUpdate()
+	if err := tx.Get(&count, sql, id, userID); err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return &NotFoundError{ID: id}
+	}
+
+	return nil
+}
+
+// checkDuplicate returns a DuplicateError if the user has another bookmark with the same canonical URL
+func (rep *repository) checkDuplicate(tx *sqlx.Tx, b *Bookmark) error {
+	if b.CanonicalURL == "" {
+		return nil
+	}
+
+	var ids []int
+	sql := `SELECT id FROM bookmarks WHERE user_id = ? AND canonical_url = ? AND id <> ?`
+	if err := tx.Select(&ids, sql, b.UserID, b.CanonicalURL, b.ID); err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		return &DuplicateError{URL: b.URL, ID: ids[0]}
+	}
+	return nil
+}
+
+// duplicateOf returns the DuplicateError of a bookmark whose insertion or update violated the
+// unique index. The ID is left to 0 if the other bookmark is not found anymore
+func (rep *repository) duplicateOf(b *Bookmark) error {
+	var ids []int
+	sql := `SELECT id FROM bookmarks WHERE user_id = ? AND canonical_url = ? AND id <> ?`
+	if err := rep.db.Select(&ids, sql, b.UserID, b.CanonicalURL, b.ID); err != nil {
+		return err
+	}
+
+	err := &DuplicateError{URL: b.URL}
+	if len(ids) > 0 {
+		err.ID = ids[0]
+	}
+	return err
+}
+
+// lock returns the stored URL, canonical URL and version of a bookmark
+// and locks its row until the end of the transaction
+// Returns a NotFoundError if the bookmark does not belong to the user
+func (rep *repository) lock(tx *sqlx.Tx, userID, id int) (*Bookmark, error) {
+	var bookmarks []*Bookmark
+	sql := `SELECT url, COALESCE(canonical_url, '') AS canonical_url, version FROM bookmarks
+WHERE id = ? AND user_id = ?` + rep.dialect.forUpdate()
+	if err := tx.Select(&bookmarks, sql, id, userID); err != nil {
+		return nil, err
+	}
+
+	if len(bookmarks) == 0 {
+		return nil, &NotFoundError{ID: id}
+	}
+
+	return bookmarks[0], nil
+}
+
 // FromOembed decorates a bookmark with oEmbed information
 // it does not overwrite existing properties
 // this is obvioulsy arguable, but I'm not sure of the expectation here
@@ -249,6 +1060,108 @@ func FromOembed(b *Bookmark, link *oembed.Link) *Bookmark {
 	if b.Duration == 0 {
 		b.Duration = link.Duration
 	}
+	if b.Provider == "" {
+		b.Provider = link.Provider
+	}
+	if b.Type == "" {
+		b.Type = link.Type
+	}
+	if b.ProviderURL == "" {
+		b.ProviderURL = link.ProviderURL
+	}
+	if b.AuthorURL == "" {
+		b.AuthorURL = link.AuthorURL
+	}
+	if b.ThumbnailURL == "" {
+		b.ThumbnailURL = link.ThumbnailURL
+		b.ThumbnailWidth = int(link.ThumbnailWidth)
+		b.ThumbnailHeight = int(link.ThumbnailHeight)
+	}
+	if b.HTML == "" {
+		b.HTML = link.HTML
+	}
+	if b.PhotoURL == "" && link.Type == oembed.LinkTypePhoto {
+		b.PhotoURL = link.URL
+	}
+	b.CacheAge = int(link.CacheAge)
+	setCanonicalURL(b, link)
 
 	return b
 }
+
+// setCanonicalURL sets the canonical URL of a bookmark to the page of the provider
+// It is more reliable than the normalization of the URL, used when the provider does not tell
+// Bookmarks saved before the duplicates were detected have none, or their raw URL
+func setCanonicalURL(b *Bookmark, link *oembed.Link) {
+	if canonical := CanonicalURL(link.WebPage); canonical != "" {
+		b.CanonicalURL = canonical
+	} else if b.CanonicalURL == "" || b.CanonicalURL == b.URL {
+		b.CanonicalURL = CanonicalURL(b.URL)
+	}
+}
+
+// RefreshFromOembed updates a bookmark with fresh oEmbed information
+// Unlike FromOembed it overwrites existing properties, unless the provider does not return them anymore
+func RefreshFromOembed(b *Bookmark, link *oembed.Link) *Bookmark {
+	if link == nil {
+		return b
+	}
+
+	if link.Title != "" {
+		b.Title = link.Title
+	}
+	if link.AuthorName != "" {
+		b.AuthorName = link.AuthorName
+	}
+	if link.Width != 0 {
+		b.Width = int(link.Width)
+	}
+	if link.Height != 0 {
+		b.Height = int(link.Height)
+	}
+	if link.Duration != 0 {
+		b.Duration = link.Duration
+	}
+	if link.Provider != "" {
+		b.Provider = link.Provider
+	}
+	if link.Type != "" {
+		b.Type = link.Type
+	}
+	if link.ProviderURL != "" {
+		b.ProviderURL = link.ProviderURL
+	}
+	if link.AuthorURL != "" {
+		b.AuthorURL = link.AuthorURL
+	}
+	if link.ThumbnailURL != "" {
+		b.ThumbnailURL = link.ThumbnailURL
+		b.ThumbnailWidth = int(link.ThumbnailWidth)
+		b.ThumbnailHeight = int(link.ThumbnailHeight)
+	}
+	if link.HTML != "" {
+		b.HTML = link.HTML
+	}
+	if link.URL != "" && link.Type == oembed.LinkTypePhoto {
+		b.PhotoURL = link.URL
+	}
+	b.CacheAge = int(link.CacheAge)
+	setCanonicalURL(b, link)
+
+	return b
+}
+
+// hostOf returns the normalized host of an URL or an empty string if invalid
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return normalizeHost(u.Hostname())
+}
+
+// normalizeHost lowercases a host name and removes the www prefix
+// so that www.vimeo.com and vimeo.com are considered the same site
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
@@ -0,0 +1,103 @@
+package bookmarks
+
+import (
+	"testing"
+
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostOf(t *testing.T) {
+	fixtures := map[string]string{
+		"https://www.flickr.com/photos/adesignstudio/39146026050/": "flickr.com",
+		"https://Vimeo.com/12345":                                  "vimeo.com",
+		"http://player.vimeo.com:8080/video/12345":                 "player.vimeo.com",
+		"not an url": "",
+	}
+
+	for input, expected := range fixtures {
+		if output := hostOf(input); output != expected {
+			t.Errorf("expected %q - got %q", expected, output)
+		}
+	}
+}
+
+func TestRefreshFromOembed(t *testing.T) {
+	b := &Bookmark{
+		Title:      "Old title",
+		AuthorName: "John Doe",
+		Width:      640,
+		Height:     480,
+		Duration:   60,
+	}
+
+	RefreshFromOembed(b, &oembed.Link{
+		Title:    "New title",
+		Width:    1280,
+		Height:   720,
+		Provider: oembed.ProviderVimeo,
+	})
+
+	assert.Equal(t, "New title", b.Title)
+	// the provider does not return it anymore
+	assert.Equal(t, "John Doe", b.AuthorName)
+	assert.Equal(t, 1280, b.Width)
+	assert.Equal(t, 720, b.Height)
+	assert.Equal(t, 60, b.Duration)
+	assert.Equal(t, oembed.ProviderVimeo, b.Provider)
+}
+
+func TestFromOembed(t *testing.T) {
+	b := &Bookmark{Title: "My title"}
+
+	FromOembed(b, &oembed.Link{
+		Title:           "Provider title",
+		AuthorName:      "Jane Doe",
+		AuthorURL:       "https://vimeo.com/jane",
+		ProviderURL:     "https://vimeo.com/",
+		ThumbnailURL:    "https://i.vimeocdn.com/video/1.jpg",
+		ThumbnailWidth:  295,
+		ThumbnailHeight: 166,
+		HTML:            "<iframe></iframe>",
+		CacheAge:        3600,
+	})
+
+	// existing properties are kept
+	assert.Equal(t, "My title", b.Title)
+	assert.Equal(t, "Jane Doe", b.AuthorName)
+	assert.Equal(t, "https://vimeo.com/jane", b.AuthorURL)
+	assert.Equal(t, "https://vimeo.com/", b.ProviderURL)
+	assert.Equal(t, "https://i.vimeocdn.com/video/1.jpg", b.ThumbnailURL)
+	assert.Equal(t, 295, b.ThumbnailWidth)
+	assert.Equal(t, 166, b.ThumbnailHeight)
+	assert.Equal(t, "<iframe></iframe>", b.HTML)
+	assert.Equal(t, 3600, b.CacheAge)
+	// not a photo
+	assert.Equal(t, "", b.PhotoURL)
+
+	b = FromOembed(&Bookmark{}, &oembed.Link{
+		Type: oembed.LinkTypePhoto,
+		URL:  "https://farm1.staticflickr.com/1/1_b.jpg",
+	})
+	assert.Equal(t, "https://farm1.staticflickr.com/1/1_b.jpg", b.PhotoURL)
+}
+
+func TestSetCanonicalURL(t *testing.T) {
+	fixtures := []struct {
+		url, canonical, webPage, expected string
+	}{
+		// the page of the provider
+		{"https://youtu.be/x", "https://youtu.be/x", "https://www.youtube.com/watch?v=x&feature=share", "https://www.youtube.com/watch?feature=share&v=x"},
+		// kept if the provider does not return it anymore
+		{"https://youtu.be/x", "https://www.youtube.com/watch?v=x", "", "https://www.youtube.com/watch?v=x"},
+		// saved before the duplicates were detected
+		{"https://Vimeo.com/1/", "", "", "https://vimeo.com/1"},
+		{"https://Vimeo.com/1/", "https://Vimeo.com/1/", "", "https://vimeo.com/1"},
+	}
+
+	for _, fixture := range fixtures {
+		b := &Bookmark{URL: fixture.url, CanonicalURL: fixture.canonical}
+		setCanonicalURL(b, &oembed.Link{WebPage: fixture.webPage})
+		assert.Equal(t, fixture.expected, b.CanonicalURL, fixture.url)
+	}
+}
@@ -0,0 +1,949 @@
+// Package bookmarkstest provides a conformance test suite that every
+// bookmarks.Repository implementation must pass
+package bookmarkstest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/pager"
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory returns an empty repository and the IDs of two distinct users
+// It is called once per test so that tests are isolated
+type Factory func(t *testing.T) (repo bookmarks.Repository, alice, bob int)
+
+// Run runs the conformance test suite against the repositories built by newRepo
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("insert and load", func(t *testing.T) { testInsertAndLoad(t, newRepo) })
+	t.Run("insert validates bookmarks", func(t *testing.T) { testInsertValidation(t, newRepo) })
+	t.Run("bookmarks are private", func(t *testing.T) { testPrivacy(t, newRepo) })
+	t.Run("list paginates", func(t *testing.T) { testPagination(t, newRepo) })
+	t.Run("list sorts", func(t *testing.T) { testSort(t, newRepo) })
+	t.Run("list filters", func(t *testing.T) { testFilters(t, newRepo) })
+	t.Run("search", func(t *testing.T) { testSearch(t, newRepo) })
+	t.Run("update", func(t *testing.T) { testUpdate(t, newRepo) })
+	t.Run("update keywords", func(t *testing.T) { testUpdateKeywords(t, newRepo) })
+	t.Run("delete", func(t *testing.T) { testDelete(t, newRepo) })
+	t.Run("enrichment", func(t *testing.T) { testEnrichment(t, newRepo) })
+	t.Run("stale bookmarks", func(t *testing.T) { testStaleBookmarks(t, newRepo) })
+	t.Run("duplicates", func(t *testing.T) { testDuplicates(t, newRepo) })
+	t.Run("keywords", func(t *testing.T) { testKeywords(t, newRepo) })
+	t.Run("keyword normalization", func(t *testing.T) { testKeywordNormalization(t, newRepo) })
+	t.Run("keyword hierarchy", func(t *testing.T) { testKeywordHierarchy(t, newRepo) })
+	t.Run("synonyms", func(t *testing.T) { testSynonyms(t, newRepo) })
+}
+
+// Fixture builds a valid bookmark. Tests override the properties they care about
+func Fixture(userID int, url string) *bookmarks.Bookmark {
+	return &bookmarks.Bookmark{
+		UserID:     userID,
+		URL:        url,
+		Title:      "Title of " + url,
+		AuthorName: "John Doe",
+		Keywords:   []bookmarks.Keyword{},
+	}
+}
+
+// must stops the test if err is not nil
+func must(t *testing.T, err error, msgAndArgs ...interface{}) {
+	if !assert.NoError(t, err, msgAndArgs...) {
+		t.FailNow()
+	}
+}
+
+func mustInsert(t *testing.T, repo bookmarks.Repository, b *bookmarks.Bookmark) *bookmarks.Bookmark {
+	newB, err := repo.Insert(b)
+	must(t, err)
+	return newB
+}
+
+func ids(bs []*bookmarks.Bookmark) []int {
+	ids := []int{}
+	for _, b := range bs {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+func date(year int, month time.Month, day int) *time.Time {
+	d := time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	return &d
+}
+
+func testInsertAndLoad(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	b := Fixture(alice, "https://vimeo.com/123")
+	b.Width = 640
+	b.Height = 480
+	b.Duration = 120
+	b.Provider = oembed.ProviderVimeo
+	b.Type = oembed.LinkTypeVideo
+	b.AddedDate = date(2018, 3, 22)
+	b.Keywords = []bookmarks.Keyword{"design", "video"}
+
+	newB := mustInsert(t, repo, b)
+	assert.NotZero(t, newB.ID)
+
+	loaded, err := repo.ByID(alice, newB.ID)
+	must(t, err)
+	if !assert.NotNil(t, loaded) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, newB.ID, loaded.ID)
+	assert.Equal(t, alice, loaded.UserID)
+	assert.Equal(t, "https://vimeo.com/123", loaded.URL)
+	assert.Equal(t, b.Title, loaded.Title)
+	assert.Equal(t, "John Doe", loaded.AuthorName)
+	assert.Equal(t, 640, loaded.Width)
+	assert.Equal(t, 480, loaded.Height)
+	assert.Equal(t, 120, loaded.Duration)
+	assert.Equal(t, oembed.ProviderVimeo, loaded.Provider)
+	assert.Equal(t, oembed.LinkTypeVideo, loaded.Type)
+	assert.Equal(t, "vimeo.com", loaded.Host)
+	assert.True(t, b.AddedDate.Equal(*loaded.AddedDate), "expected %s - got %s", b.AddedDate, loaded.AddedDate)
+	assert.ElementsMatch(t, []bookmarks.Keyword{"design", "video"}, loaded.Keywords)
+
+	// an added date is generated if missing
+	newB = mustInsert(t, repo, Fixture(alice, "https://vimeo.com/456"))
+	if !assert.NotNil(t, newB.AddedDate) {
+		t.FailNow()
+	}
+	assert.WithinDuration(t, time.Now(), *newB.AddedDate, time.Minute)
+
+	// unknown bookmarks
+	loaded, err = repo.ByID(alice, 999999)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded)
+}
+
+func testInsertValidation(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	invalid := []*bookmarks.Bookmark{
+		Fixture(alice, ""),
+		Fixture(alice, "not an url"),
+		Fixture(0, "https://vimeo.com/123"),
+	}
+
+	for _, b := range invalid {
+		_, err := repo.Insert(b)
+		assert.IsType(t, &bookmarks.ValidationError{}, err, b.URL)
+	}
+
+	_, count, err := repo.List(bookmarks.Filter{UserID: alice})
+	must(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func testPrivacy(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	aliceB := mustInsert(t, repo, Fixture(alice, "https://vimeo.com/1"))
+	bobB := mustInsert(t, repo, Fixture(bob, "https://vimeo.com/2"))
+
+	bs, count, err := repo.List(bookmarks.Filter{UserID: alice})
+	must(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []int{aliceB.ID}, ids(bs))
+
+	loaded, err := repo.ByID(alice, bobB.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded)
+
+	err = repo.UpdateKeywords(alice, bobB.ID, []bookmarks.Keyword{"hacked"})
+	assert.IsType(t, &bookmarks.NotFoundError{}, err)
+
+	err = repo.Delete(alice, bobB.ID)
+	assert.IsType(t, &bookmarks.NotFoundError{}, err)
+
+	loaded, err = repo.ByID(bob, bobB.ID)
+	must(t, err)
+	if !assert.NotNil(t, loaded) {
+		t.FailNow()
+	}
+	assert.Empty(t, loaded.Keywords)
+}
+
+func testPagination(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	inserted := []int{}
+	for _, url := range []string{"https://a.com", "https://b.com", "https://c.com", "https://d.com", "https://e.com"} {
+		inserted = append(inserted, mustInsert(t, repo, Fixture(alice, url)).ID)
+	}
+
+	fixtures := []struct {
+		pager    pager.Pager
+		expected []int
+	}{
+		{nil, inserted},
+		{pager.NoPager(), inserted},
+		{pager.New(1, 2), inserted[0:2]},
+		{pager.New(2, 2), inserted[2:4]},
+		{pager.New(3, 2), inserted[4:5]},
+		{pager.New(4, 2), []int{}},
+	}
+
+	for _, f := range fixtures {
+		bs, count, err := repo.List(bookmarks.Filter{UserID: alice, Pager: f.pager})
+		must(t, err)
+		assert.Equal(t, 5, count)
+		assert.Equal(t, f.expected, ids(bs))
+	}
+}
+
+func testSort(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	b1 := Fixture(alice, "https://a.com")
+	b1.Title = "banana"
+	b1.AuthorName = "Zoe"
+	b1.AddedDate = date(2018, 3, 2)
+	b1 = mustInsert(t, repo, b1)
+
+	b2 := Fixture(alice, "https://b.com")
+	b2.Title = "Apple"
+	b2.AuthorName = "mike"
+	b2.AddedDate = date(2018, 3, 3)
+	b2 = mustInsert(t, repo, b2)
+
+	b3 := Fixture(alice, "https://c.com")
+	b3.Title = "cherry"
+	b3.AuthorName = "Mike"
+	b3.AddedDate = date(2018, 3, 1)
+	b3 = mustInsert(t, repo, b3)
+
+	fixtures := []struct {
+		sort     bookmarks.SortField
+		order    bookmarks.SortOrder
+		expected []int
+	}{
+		{"", "", []int{b1.ID, b2.ID, b3.ID}},
+		{"", bookmarks.OrderDesc, []int{b3.ID, b2.ID, b1.ID}},
+		{bookmarks.SortByAddedDate, bookmarks.OrderAsc, []int{b3.ID, b1.ID, b2.ID}},
+		{bookmarks.SortByAddedDate, bookmarks.OrderDesc, []int{b2.ID, b1.ID, b3.ID}},
+		// text sorts are case insensitive
+		{bookmarks.SortByTitle, bookmarks.OrderAsc, []int{b2.ID, b1.ID, b3.ID}},
+		// id is the tie-breaker
+		{bookmarks.SortByAuthor, bookmarks.OrderAsc, []int{b2.ID, b3.ID, b1.ID}},
+		{bookmarks.SortByAuthor, bookmarks.OrderDesc, []int{b1.ID, b3.ID, b2.ID}},
+	}
+
+	for _, f := range fixtures {
+		bs, _, err := repo.List(bookmarks.Filter{UserID: alice, Sort: f.sort, Order: f.order})
+		must(t, err)
+		assert.Equal(t, f.expected, ids(bs), "sort: %q - order: %q", f.sort, f.order)
+	}
+}
+
+func testFilters(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	video := Fixture(alice, "https://vimeo.com/1")
+	video.AuthorName = "Jane"
+	video.Provider = oembed.ProviderVimeo
+	video.Type = oembed.LinkTypeVideo
+	video.AddedDate = date(2018, 2, 15)
+	video.Keywords = []bookmarks.Keyword{"design", "video"}
+	video = mustInsert(t, repo, video)
+
+	photo := Fixture(alice, "https://www.flickr.com/photos/1")
+	photo.AuthorName = "John"
+	photo.Provider = oembed.ProviderFlickr
+	photo.Type = oembed.LinkTypePhoto
+	photo.AddedDate = date(2018, 3, 15)
+	photo.Keywords = []bookmarks.Keyword{"design"}
+	photo = mustInsert(t, repo, photo)
+
+	other := Fixture(alice, "https://vimeo.com/2")
+	other.AuthorName = "John"
+	other.Provider = oembed.ProviderVimeo
+	other.Type = oembed.LinkTypeVideo
+	other.AddedDate = date(2018, 3, 20)
+	other.Keywords = []bookmarks.Keyword{"music"}
+	other = mustInsert(t, repo, other)
+
+	// bob's bookmarks must never show up
+	bobs := Fixture(bob, "https://vimeo.com/3")
+	bobs.Keywords = []bookmarks.Keyword{"design", "video"}
+	mustInsert(t, repo, bobs)
+
+	fixtures := []struct {
+		name     string
+		filter   bookmarks.Filter
+		expected []int
+	}{
+		{"no filter", bookmarks.Filter{}, []int{video.ID, photo.ID, other.ID}},
+		{"id", bookmarks.Filter{ID: &photo.ID}, []int{photo.ID}},
+		{"url", bookmarks.Filter{URL: "https://vimeo.com/2"}, []int{other.ID}},
+		{"other user's url", bookmarks.Filter{URL: "https://vimeo.com/3"}, []int{}},
+		{"any keyword", bookmarks.Filter{Keywords: []bookmarks.Keyword{"video", "music"}}, []int{video.ID, other.ID}},
+		{"all keywords", bookmarks.Filter{Keywords: []bookmarks.Keyword{"design", "video"}, KeywordsMatch: bookmarks.MatchAll}, []int{video.ID}},
+		{"unknown keyword", bookmarks.Filter{Keywords: []bookmarks.Keyword{"unknown"}}, []int{}},
+		{"author", bookmarks.Filter{AuthorName: "john"}, []int{photo.ID, other.ID}},
+		{"provider", bookmarks.Filter{Provider: oembed.ProviderVimeo}, []int{video.ID, other.ID}},
+		{"type", bookmarks.Filter{Type: oembed.LinkTypePhoto}, []int{photo.ID}},
+		{"host", bookmarks.Filter{Host: "flickr.com"}, []int{photo.ID}},
+		{"host with www", bookmarks.Filter{Host: "www.Flickr.com"}, []int{photo.ID}},
+		{"added after", bookmarks.Filter{AddedAfter: date(2018, 3, 15)}, []int{photo.ID, other.ID}},
+		{"added before", bookmarks.Filter{AddedBefore: date(2018, 3, 15)}, []int{video.ID}},
+		{
+			"combined",
+			bookmarks.Filter{
+				Keywords:    []bookmarks.Keyword{"design", "music"},
+				Provider:    oembed.ProviderVimeo,
+				AuthorName:  "John",
+				AddedAfter:  date(2018, 3, 1),
+				AddedBefore: date(2018, 4, 1),
+			},
+			[]int{other.ID},
+		},
+	}
+
+	for _, f := range fixtures {
+		f.filter.UserID = alice
+		bs, count, err := repo.List(f.filter)
+		must(t, err, f.name)
+		assert.Equal(t, f.expected, ids(bs), f.name)
+		assert.Equal(t, len(f.expected), count, f.name)
+	}
+}
+
+func testSearch(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	b1 := Fixture(alice, "https://vimeo.com/1")
+	b1.Title = "Design patterns explained"
+	b1.AuthorName = "Gang of four"
+	b1.Keywords = []bookmarks.Keyword{"programming"}
+	b1 = mustInsert(t, repo, b1)
+
+	b2 := Fixture(alice, "https://www.flickr.com/photos/2")
+	b2.Title = "Patterns in nature"
+	b2.AuthorName = "Jane Goodall"
+	b2.Keywords = []bookmarks.Keyword{"nature", "tutorial"}
+	b2 = mustInsert(t, repo, b2)
+
+	bobs := Fixture(bob, "https://vimeo.com/3")
+	bobs.Title = "Design patterns for bob"
+	mustInsert(t, repo, bobs)
+
+	fixtures := []struct {
+		query    string
+		expected []int
+	}{
+		{"patterns", []int{b1.ID, b2.ID}},
+		{"design patterns", []int{b1.ID}},
+		{`"patterns explained"`, []int{b1.ID}},
+		{`"explained patterns"`, []int{}},
+		{"patterns -design", []int{b2.ID}},
+		{`patterns -"design patterns"`, []int{b2.ID}},
+		// authors, urls and keywords are searched too
+		{"goodall", []int{b2.ID}},
+		{"flickr", []int{b2.ID}},
+		{"tutorial", []int{b2.ID}},
+		{"PROGRAMMING", []int{b1.ID}},
+		// nothing to search
+		{"", []int{}},
+		{"-design", []int{}},
+	}
+
+	for _, f := range fixtures {
+		bs, count, err := repo.Search(f.query, bookmarks.Filter{UserID: alice})
+		must(t, err, f.query)
+		assert.ElementsMatch(t, f.expected, ids(bs), f.query)
+		assert.Equal(t, len(f.expected), count, f.query)
+	}
+
+	// results can be filtered and paginated
+	bs, count, err := repo.Search("patterns", bookmarks.Filter{
+		UserID:   alice,
+		Keywords: []bookmarks.Keyword{"nature"},
+		Pager:    pager.New(1, 1),
+	})
+	must(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []int{b2.ID}, ids(bs))
+
+	// keyword updates are searchable
+	must(t, repo.UpdateKeywords(alice, b1.ID, []bookmarks.Keyword{"architecture"}))
+	bs, _, err = repo.Search("architecture", bookmarks.Filter{UserID: alice})
+	must(t, err)
+	assert.Equal(t, []int{b1.ID}, ids(bs))
+}
+
+func testUpdate(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	b := Fixture(alice, "https://vimeo.com/1")
+	b.Keywords = []bookmarks.Keyword{"design"}
+	b.AddedDate = date(2018, 1, 1)
+	b = mustInsert(t, repo, b)
+	assert.Equal(t, 1, b.Version)
+	assert.Nil(t, b.UpdatedAt)
+
+	edited, err := repo.ByID(alice, b.ID)
+	must(t, err)
+	edited.URL = "https://www.flickr.com/photos/1"
+	edited.Title = "A photo"
+	edited.AuthorName = ""
+	edited.Notes = "Seen at the conference"
+	edited.Keywords = []bookmarks.Keyword{"photo", "design"}
+	edited.Provider = ""
+	edited.EnrichmentStatus = bookmarks.EnrichmentPending
+	// not editable
+	edited.AddedDate = date(2019, 1, 1)
+	must(t, repo.Update(edited))
+	assert.Equal(t, 2, edited.Version)
+	assert.NotNil(t, edited.UpdatedAt)
+
+	loaded, err := repo.ByID(alice, b.ID)
+	must(t, err)
+	assert.Equal(t, "https://www.flickr.com/photos/1", loaded.URL)
+	assert.Equal(t, "A photo", loaded.Title)
+	assert.Equal(t, "", loaded.AuthorName)
+	assert.Equal(t, "Seen at the conference", loaded.Notes)
+	assert.ElementsMatch(t, []bookmarks.Keyword{"photo", "design"}, loaded.Keywords)
+	assert.Equal(t, bookmarks.EnrichmentPending, loaded.EnrichmentStatus)
+	assert.Equal(t, date(2018, 1, 1), loaded.AddedDate)
+	assert.Equal(t, 2, loaded.Version)
+	assert.NotNil(t, loaded.UpdatedAt)
+
+	// the host follows the URL
+	bs, _, err := repo.List(bookmarks.Filter{UserID: alice, Host: "flickr.com"})
+	must(t, err)
+	assert.Equal(t, []int{b.ID}, ids(bs))
+
+	// edits based on an outdated version are rejected
+	stale := *b
+	stale.Title = "Overwritten"
+	err = repo.Update(&stale)
+	if assert.IsType(t, &bookmarks.VersionConflictError{}, err) {
+		assert.Equal(t, 2, err.(*bookmarks.VersionConflictError).Version)
+	}
+
+	// so are the enrichments of the previous version: the edit wins
+	enriched := *b
+	enriched.Title = "Title of the old URL"
+	enriched.EnrichmentStatus = bookmarks.EnrichmentDone
+	must(t, repo.SaveEnrichment(&enriched))
+
+	loaded, err = repo.ByID(alice, b.ID)
+	must(t, err)
+	assert.Equal(t, "A photo", loaded.Title)
+	assert.Equal(t, bookmarks.EnrichmentPending, loaded.EnrichmentStatus)
+
+	// edits are validated
+	invalid := *loaded
+	invalid.URL = "not an URL"
+	assert.IsType(t, &bookmarks.ValidationError{}, repo.Update(&invalid))
+
+	// users cannot edit each other's bookmarks
+	other := *loaded
+	other.UserID = bob
+	assert.IsType(t, &bookmarks.NotFoundError{}, repo.Update(&other))
+}
+
+func testUpdateKeywords(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	b := Fixture(alice, "https://vimeo.com/1")
+	b.Keywords = []bookmarks.Keyword{"design", "video"}
+	b = mustInsert(t, repo, b)
+
+	must(t, repo.UpdateKeywords(alice, b.ID, []bookmarks.Keyword{"video", "music"}))
+
+	loaded, err := repo.ByID(alice, b.ID)
+	must(t, err)
+	assert.ElementsMatch(t, []bookmarks.Keyword{"video", "music"}, loaded.Keywords)
+	// it is an edit like any other
+	assert.Equal(t, 2, loaded.Version)
+	assert.NotNil(t, loaded.UpdatedAt)
+
+	must(t, repo.UpdateKeywords(alice, b.ID, []bookmarks.Keyword{}))
+
+	loaded, err = repo.ByID(alice, b.ID)
+	must(t, err)
+	assert.Empty(t, loaded.Keywords)
+
+	err = repo.UpdateKeywords(alice, 999999, []bookmarks.Keyword{"video"})
+	assert.IsType(t, &bookmarks.NotFoundError{}, err)
+}
+
+func testDelete(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	b := Fixture(alice, "https://vimeo.com/1")
+	b.Keywords = []bookmarks.Keyword{"design"}
+	b = mustInsert(t, repo, b)
+	kept := mustInsert(t, repo, Fixture(alice, "https://vimeo.com/2"))
+
+	must(t, repo.Delete(alice, b.ID))
+
+	loaded, err := repo.ByID(alice, b.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded)
+
+	bs, _, err := repo.List(bookmarks.Filter{UserID: alice})
+	must(t, err)
+	assert.Equal(t, []int{kept.ID}, ids(bs))
+
+	err = repo.Delete(alice, b.ID)
+	assert.IsType(t, &bookmarks.NotFoundError{}, err)
+}
+
+func testEnrichment(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	done := mustInsert(t, repo, Fixture(alice, "https://vimeo.com/1"))
+	assert.Equal(t, bookmarks.EnrichmentDone, done.EnrichmentStatus)
+
+	pending := []*bookmarks.Bookmark{}
+	for _, b := range []*bookmarks.Bookmark{
+		{UserID: alice, URL: "https://vimeo.com/2", Keywords: []bookmarks.Keyword{"video"}},
+		{UserID: bob, URL: "https://vimeo.com/3"},
+		{UserID: alice, URL: "https://vimeo.com/4"},
+	} {
+		b.EnrichmentStatus = bookmarks.EnrichmentPending
+		pending = append(pending, mustInsert(t, repo, b))
+	}
+
+	bs, err := repo.PendingEnrichments(10)
+	must(t, err)
+	assert.Equal(t, ids(pending), ids(bs))
+	assert.Equal(t, []bookmarks.Keyword{"video"}, bs[0].Keywords)
+
+	bs, err = repo.PendingEnrichments(2)
+	must(t, err)
+	assert.Equal(t, ids(pending[:2]), ids(bs))
+
+	enriched := *pending[0]
+	enriched.Title = "A video"
+	enriched.AuthorName = "Jane Doe"
+	enriched.Width = 640
+	enriched.Height = 360
+	enriched.Duration = 42
+	enriched.Provider = oembed.ProviderVimeo
+	enriched.Type = oembed.LinkTypeVideo
+	enriched.ProviderURL = "https://vimeo.com/"
+	enriched.AuthorURL = "https://vimeo.com/jane"
+	enriched.ThumbnailURL = "https://i.vimeocdn.com/video/2.jpg"
+	enriched.ThumbnailWidth = 295
+	enriched.ThumbnailHeight = 166
+	enriched.HTML = `<iframe src="https://player.vimeo.com/video/2"></iframe>`
+	enriched.CacheAge = 3600
+	enriched.HasThumbnail = true
+	enriched.PhotoURL = "https://i.vimeocdn.com/video/2_1280.jpg"
+	enriched.EnrichmentStatus = bookmarks.EnrichmentDone
+	// the URL and the keywords are not touched by enrichment
+	enriched.URL = "https://example.com"
+	enriched.Keywords = []bookmarks.Keyword{}
+	must(t, repo.SaveEnrichment(&enriched))
+
+	loaded, err := repo.ByID(alice, pending[0].ID)
+	must(t, err)
+	assert.Equal(t, "A video", loaded.Title)
+	assert.Equal(t, "Jane Doe", loaded.AuthorName)
+	assert.Equal(t, 640, loaded.Width)
+	assert.Equal(t, 360, loaded.Height)
+	assert.Equal(t, 42, loaded.Duration)
+	assert.Equal(t, oembed.ProviderVimeo, loaded.Provider)
+	assert.Equal(t, oembed.LinkTypeVideo, loaded.Type)
+	assert.Equal(t, "https://vimeo.com/", loaded.ProviderURL)
+	assert.Equal(t, "https://vimeo.com/jane", loaded.AuthorURL)
+	assert.Equal(t, "https://i.vimeocdn.com/video/2.jpg", loaded.ThumbnailURL)
+	assert.Equal(t, 295, loaded.ThumbnailWidth)
+	assert.Equal(t, 166, loaded.ThumbnailHeight)
+	assert.Equal(t, `<iframe src="https://player.vimeo.com/video/2"></iframe>`, loaded.HTML)
+	assert.Equal(t, 3600, loaded.CacheAge)
+	assert.True(t, loaded.HasThumbnail)
+	assert.Equal(t, "https://i.vimeocdn.com/video/2_1280.jpg", loaded.PhotoURL)
+	assert.Equal(t, bookmarks.EnrichmentDone, loaded.EnrichmentStatus)
+	assert.Equal(t, "https://vimeo.com/2", loaded.URL)
+	assert.Equal(t, []bookmarks.Keyword{"video"}, loaded.Keywords)
+
+	failed := *pending[1]
+	failed.EnrichmentStatus = bookmarks.EnrichmentFailed
+	failed.EnrichmentError = strings.Repeat("x", 300)
+	failed.ThumbnailURL = "https://example.com/" + strings.Repeat("x", 2000)
+	must(t, repo.SaveEnrichment(&failed))
+
+	loaded, err = repo.ByID(bob, pending[1].ID)
+	must(t, err)
+	assert.Equal(t, bookmarks.EnrichmentFailed, loaded.EnrichmentStatus)
+	assert.Equal(t, strings.Repeat("x", 255), loaded.EnrichmentError)
+	// truncated URLs would be broken
+	assert.Equal(t, "", loaded.ThumbnailURL)
+
+	bs, err = repo.PendingEnrichments(10)
+	must(t, err)
+	assert.Equal(t, ids(pending[2:]), ids(bs))
+
+	// bookmarks deleted in the meantime are ignored
+	must(t, repo.Delete(alice, pending[2].ID))
+	gone := *pending[2]
+	gone.EnrichmentStatus = bookmarks.EnrichmentDone
+	assert.NoError(t, repo.SaveEnrichment(&gone))
+}
+
+func testStaleBookmarks(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	old := Fixture(alice, "https://vimeo.com/1")
+	old.AddedDate = date(2018, 1, 1)
+	old = mustInsert(t, repo, old)
+
+	recent := Fixture(bob, "https://vimeo.com/2")
+	recent.AddedDate = date(2018, 3, 1)
+	recent = mustInsert(t, repo, recent)
+
+	refreshed := Fixture(alice, "https://vimeo.com/3")
+	refreshed.AddedDate = date(2017, 1, 1)
+	refreshed = mustInsert(t, repo, refreshed)
+	refreshed.LastRefreshedAt = date(2018, 2, 1)
+	refreshed.DeadLink = true
+	must(t, repo.SaveEnrichment(refreshed))
+
+	// pending bookmarks are left to the enrichment queue
+	pending := Fixture(alice, "https://vimeo.com/4")
+	pending.AddedDate = date(2017, 1, 1)
+	pending.EnrichmentStatus = bookmarks.EnrichmentPending
+	mustInsert(t, repo, pending)
+
+	// failing bookmarks are refreshed at their next_refresh_at, whatever their age
+	failing := Fixture(bob, "https://vimeo.com/5")
+	failing.AddedDate = date(2016, 1, 1)
+	failing = mustInsert(t, repo, failing)
+	failing.NextRefreshAt = date(2018, 5, 1)
+	failing.EnrichmentError = "503 Service Unavailable"
+	must(t, repo.SaveEnrichment(failing))
+
+	loaded, err := repo.ByID(alice, refreshed.ID)
+	must(t, err)
+	assert.True(t, loaded.DeadLink)
+	if assert.NotNil(t, loaded.LastRefreshedAt) {
+		assert.True(t, date(2018, 2, 1).Equal(*loaded.LastRefreshedAt))
+	}
+	assert.Nil(t, loaded.NextRefreshAt)
+
+	loaded, err = repo.ByID(bob, failing.ID)
+	must(t, err)
+	assert.Nil(t, loaded.LastRefreshedAt)
+	if assert.NotNil(t, loaded.NextRefreshAt) {
+		assert.True(t, date(2018, 5, 1).Equal(*loaded.NextRefreshAt))
+	}
+
+	bs, err := repo.StaleBookmarks(*date(2018, 6, 1), *date(2018, 4, 1), 10)
+	must(t, err)
+	assert.Equal(t, []int{old.ID, refreshed.ID, recent.ID}, ids(bs))
+
+	bs, err = repo.StaleBookmarks(*date(2018, 2, 15), *date(2018, 4, 1), 10)
+	must(t, err)
+	assert.Equal(t, []int{old.ID, refreshed.ID}, ids(bs))
+
+	bs, err = repo.StaleBookmarks(*date(2018, 6, 1), *date(2018, 4, 1), 1)
+	must(t, err)
+	assert.Equal(t, []int{old.ID}, ids(bs))
+
+	bs, err = repo.StaleBookmarks(*date(2018, 6, 1), *date(2018, 5, 1), 10)
+	must(t, err)
+	assert.Equal(t, []int{old.ID, refreshed.ID, recent.ID, failing.ID}, ids(bs))
+}
+
+func testDuplicates(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	b := mustInsert(t, repo, Fixture(alice, "https://vimeo.com/1?utm_source=twitter"))
+	assert.Equal(t, "https://vimeo.com/1", b.CanonicalURL)
+
+	// the same page
+	_, err := repo.Insert(Fixture(alice, "https://VIMEO.com/1/#comments"))
+	if assert.IsType(t, &bookmarks.DuplicateError{}, err) {
+		assert.Equal(t, b.ID, err.(*bookmarks.DuplicateError).ID)
+	}
+	// but not for someone else
+	mustInsert(t, repo, Fixture(bob, "https://vimeo.com/1"))
+
+	// URLs that cannot be canonicalized are never duplicates
+	mustInsert(t, repo, Fixture(alice, "ftp://example.com/file"))
+	mustInsert(t, repo, Fixture(alice, "ftp://example.com/file"))
+
+	// edits cannot create duplicates
+	other := mustInsert(t, repo, Fixture(alice, "https://vimeo.com/2"))
+	edited := *other
+	edited.URL = "https://vimeo.com/1"
+	if err := repo.Update(&edited); assert.IsType(t, &bookmarks.DuplicateError{}, err) {
+		assert.Equal(t, b.ID, err.(*bookmarks.DuplicateError).ID)
+	}
+	loaded, err := repo.ByID(alice, other.ID)
+	must(t, err)
+	assert.Equal(t, "https://vimeo.com/2", loaded.URL)
+	assert.Equal(t, 1, loaded.Version)
+
+	// the canonical URL of the provider replaces the normalized one
+	short := mustInsert(t, repo, Fixture(alice, "https://youtu.be/x"))
+	enriched := *short
+	enriched.CanonicalURL = "https://www.youtube.com/watch?v=x"
+	enriched.EnrichmentStatus = bookmarks.EnrichmentDone
+	must(t, repo.SaveEnrichment(&enriched))
+	loaded, err = repo.ByID(alice, short.ID)
+	must(t, err)
+	assert.Equal(t, "https://www.youtube.com/watch?v=x", loaded.CanonicalURL)
+
+	_, err = repo.Insert(Fixture(alice, "https://www.youtube.com/watch?v=x&utm_medium=email"))
+	if assert.IsType(t, &bookmarks.DuplicateError{}, err) {
+		assert.Equal(t, short.ID, err.(*bookmarks.DuplicateError).ID)
+	}
+
+	// unless another bookmark already has it. The enrichment is saved anyway
+	mobile := mustInsert(t, repo, Fixture(alice, "https://m.youtube.com/watch?v=x"))
+	enriched = *mobile
+	enriched.CanonicalURL = "https://www.youtube.com/watch?v=x"
+	enriched.Title = "A video"
+	must(t, repo.SaveEnrichment(&enriched))
+	loaded, err = repo.ByID(alice, mobile.ID)
+	must(t, err)
+	assert.Equal(t, "https://m.youtube.com/watch?v=x", loaded.CanonicalURL)
+	assert.Equal(t, "A video", loaded.Title)
+}
+
+func testKeywords(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	keywords := func(userID int) []bookmarks.KeywordUsage {
+		usages, err := repo.Keywords(userID)
+		must(t, err)
+		values := []bookmarks.KeywordUsage{}
+		for _, usage := range usages {
+			values = append(values, *usage)
+		}
+		return values
+	}
+	load := func(b *bookmarks.Bookmark) *bookmarks.Bookmark {
+		loaded, err := repo.ByID(b.UserID, b.ID)
+		must(t, err)
+		return loaded
+	}
+
+	b1 := Fixture(alice, "https://vimeo.com/1")
+	b1.Keywords = []bookmarks.Keyword{"design", "video"}
+	b1 = mustInsert(t, repo, b1)
+	b2 := Fixture(alice, "https://vimeo.com/2")
+	b2.Keywords = []bookmarks.Keyword{"video", "music"}
+	b2 = mustInsert(t, repo, b2)
+	b3 := mustInsert(t, repo, Fixture(alice, "https://vimeo.com/3"))
+	b4 := Fixture(bob, "https://vimeo.com/4")
+	b4.Keywords = []bookmarks.Keyword{"video", "jazz"}
+	b4 = mustInsert(t, repo, b4)
+
+	assert.Equal(t, []bookmarks.KeywordUsage{{Name: "design", Count: 1}, {Name: "music", Count: 1}, {Name: "video", Count: 2}}, keywords(alice))
+	assert.Equal(t, []bookmarks.KeywordUsage{{Name: "jazz", Count: 1}, {Name: "video", Count: 1}}, keywords(bob))
+
+	// rename
+	must(t, repo.RenameKeyword(alice, "VIDEO", "film"))
+	assert.ElementsMatch(t, []bookmarks.Keyword{"design", "film"}, load(b1).Keywords)
+	assert.ElementsMatch(t, []bookmarks.Keyword{"film", "music"}, load(b2).Keywords)
+	assert.Equal(t, 2, load(b1).Version)
+	assert.Equal(t, 1, load(b3).Version)
+	// other users keep their keywords
+	assert.ElementsMatch(t, []bookmarks.Keyword{"video", "jazz"}, load(b4).Keywords)
+	assert.Equal(t, 1, load(b4).Version)
+	bs, _, err := repo.List(bookmarks.Filter{UserID: alice, Keywords: []bookmarks.Keyword{"film"}})
+	must(t, err)
+	assert.ElementsMatch(t, []int{b1.ID, b2.ID}, ids(bs))
+
+	assert.IsType(t, &bookmarks.KeywordExistsError{}, repo.RenameKeyword(alice, "design", "music"))
+	assert.IsType(t, &bookmarks.KeywordNotFoundError{}, repo.RenameKeyword(alice, "jazz", "blues"))
+	assert.IsType(t, &bookmarks.ValidationError{}, repo.RenameKeyword(alice, "design", ""))
+	assert.IsType(t, &bookmarks.ValidationError{}, repo.RenameKeyword(alice, "design", bookmarks.Keyword(strings.Repeat("a", 51))))
+
+	// merge into an existing keyword
+	must(t, repo.MergeKeyword(alice, "music", "film"))
+	assert.ElementsMatch(t, []bookmarks.Keyword{"film"}, load(b2).Keywords)
+	// or a new one
+	must(t, repo.MergeKeyword(alice, "design", "art"))
+	assert.ElementsMatch(t, []bookmarks.Keyword{"art", "film"}, load(b1).Keywords)
+	assert.Equal(t, []bookmarks.KeywordUsage{{Name: "art", Count: 1}, {Name: "film", Count: 2}}, keywords(alice))
+	assert.IsType(t, &bookmarks.KeywordNotFoundError{}, repo.MergeKeyword(alice, "jazz", "film"))
+
+	// delete
+	must(t, repo.DeleteKeyword(alice, "film"))
+	assert.ElementsMatch(t, []bookmarks.Keyword{"art"}, load(b1).Keywords)
+	assert.Empty(t, load(b2).Keywords)
+	assert.Equal(t, []bookmarks.KeywordUsage{{Name: "art", Count: 1}}, keywords(alice))
+	assert.IsType(t, &bookmarks.KeywordNotFoundError{}, repo.DeleteKeyword(alice, "film"))
+
+	// keywords nobody has anymore are deleted, the others are kept
+	_, err = repo.DeleteOrphanKeywords()
+	must(t, err)
+	assert.Equal(t, []bookmarks.KeywordUsage{{Name: "art", Count: 1}}, keywords(alice))
+	assert.Equal(t, []bookmarks.KeywordUsage{{Name: "jazz", Count: 1}, {Name: "video", Count: 1}}, keywords(bob))
+
+	// deleted keywords can be used again, whatever their case
+	must(t, repo.UpdateKeywords(alice, b3.ID, []bookmarks.Keyword{"Design", "ART"}))
+	assert.Equal(t, []bookmarks.KeywordUsage{{Name: "art", Count: 2}, {Name: "design", Count: 1}}, keywords(alice))
+}
+
+func testKeywordNormalization(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	b := Fixture(alice, "https://vimeo.com/1")
+	b.Keywords = []bookmarks.Keyword{" Design", "design ", "DESIGN", "", "  ", " Video / Tutorials ", "cafe\u0301"}
+	b = mustInsert(t, repo, b)
+	assert.Equal(t, []bookmarks.Keyword{"design", "video/tutorials", "café"}, b.Keywords)
+
+	loaded, err := repo.ByID(alice, b.ID)
+	must(t, err)
+	assert.ElementsMatch(t, []bookmarks.Keyword{"design", "video/tutorials", "café"}, loaded.Keywords)
+
+	bs, _, err := repo.List(bookmarks.Filter{UserID: alice, Keywords: []bookmarks.Keyword{" CAFÉ "}})
+	must(t, err)
+	assert.Equal(t, []int{b.ID}, ids(bs))
+
+	must(t, repo.UpdateKeywords(alice, b.ID, []bookmarks.Keyword{"Music", "music", " / "}))
+	loaded, err = repo.ByID(alice, b.ID)
+	must(t, err)
+	assert.Equal(t, []bookmarks.Keyword{"music"}, loaded.Keywords)
+
+	loaded.Keywords = []bookmarks.Keyword{" Jazz "}
+	must(t, repo.Update(loaded))
+	loaded, err = repo.ByID(alice, b.ID)
+	must(t, err)
+	assert.Equal(t, []bookmarks.Keyword{"jazz"}, loaded.Keywords)
+
+	// the size of the column
+	long := bookmarks.Keyword(strings.Repeat("é", 51))
+	tooLong := Fixture(alice, "https://vimeo.com/2")
+	tooLong.Keywords = []bookmarks.Keyword{"design", long}
+	_, err = repo.Insert(tooLong)
+	if assert.IsType(t, &bookmarks.ValidationError{}, err) {
+		assert.Equal(t, "keywords[1]", err.(*bookmarks.ValidationError).Fields[0].Field)
+	}
+	assert.IsType(t, &bookmarks.ValidationError{}, repo.UpdateKeywords(alice, b.ID, []bookmarks.Keyword{long}))
+
+	tooLong.Keywords = []bookmarks.Keyword{long[:100]}
+	mustInsert(t, repo, tooLong)
+}
+
+func testKeywordHierarchy(t *testing.T, newRepo Factory) {
+	repo, alice, _ := newRepo(t)
+
+	insert := func(url string, keywords ...bookmarks.Keyword) int {
+		b := Fixture(alice, url)
+		b.Keywords = keywords
+		return mustInsert(t, repo, b).ID
+	}
+	tutorials := insert("https://vimeo.com/1", "video/tutorials")
+	video := insert("https://vimeo.com/2", "video")
+	videos := insert("https://vimeo.com/3", "videos")
+	golang := insert("https://vimeo.com/4", "video/tutorials/go", "music")
+	wildcard := insert("https://vimeo.com/5", "a_b/c", "100%")
+	insert("https://vimeo.com/6", "axb/c", "1000")
+
+	fixtures := []struct {
+		name     string
+		filter   bookmarks.Filter
+		expected []int
+	}{
+		{"parent", bookmarks.Filter{Keywords: []bookmarks.Keyword{"video"}}, []int{tutorials, video, golang}},
+		{"child", bookmarks.Filter{Keywords: []bookmarks.Keyword{"Video/Tutorials"}}, []int{tutorials, golang}},
+		{"leaf", bookmarks.Filter{Keywords: []bookmarks.Keyword{"video/tutorials/go"}}, []int{golang}},
+		{"prefix", bookmarks.Filter{Keywords: []bookmarks.Keyword{"vid"}}, []int{}},
+		{"any", bookmarks.Filter{Keywords: []bookmarks.Keyword{"videos", "music"}}, []int{videos, golang}},
+		{"all", bookmarks.Filter{Keywords: []bookmarks.Keyword{"video", "music"}, KeywordsMatch: bookmarks.MatchAll}, []int{golang}},
+		{"all with a child", bookmarks.Filter{Keywords: []bookmarks.Keyword{"video", "video/tutorials"}, KeywordsMatch: bookmarks.MatchAll}, []int{tutorials, golang}},
+		{"wildcards", bookmarks.Filter{Keywords: []bookmarks.Keyword{"a_b", "100%"}}, []int{wildcard}},
+	}
+
+	for _, f := range fixtures {
+		f.filter.UserID = alice
+		bs, count, err := repo.List(f.filter)
+		must(t, err, f.name)
+		assert.Equal(t, f.expected, ids(bs), f.name)
+		assert.Equal(t, len(f.expected), count, f.name)
+	}
+}
+
+func testSynonyms(t *testing.T, newRepo Factory) {
+	repo, alice, bob := newRepo(t)
+
+	synonyms := func(userID int) []bookmarks.Synonym {
+		synonyms, err := repo.Synonyms(userID)
+		must(t, err)
+		values := []bookmarks.Synonym{}
+		for _, s := range synonyms {
+			values = append(values, *s)
+		}
+		return values
+	}
+	load := func(b *bookmarks.Bookmark) *bookmarks.Bookmark {
+		loaded, err := repo.ByID(b.UserID, b.ID)
+		must(t, err)
+		return loaded
+	}
+
+	// bookmarks tagged before the synonym exists
+	b1 := Fixture(alice, "https://vimeo.com/1")
+	b1.Keywords = []bookmarks.Keyword{"js", "javascript", "web"}
+	b1 = mustInsert(t, repo, b1)
+
+	s, err := repo.AddSynonym(alice, " JS ", "JavaScript")
+	must(t, err)
+	assert.Equal(t, bookmarks.Synonym{Alias: "js", Keyword: "javascript"}, *s)
+	assert.ElementsMatch(t, []bookmarks.Keyword{"javascript", "web"}, load(b1).Keywords)
+	assert.Equal(t, 2, load(b1).Version)
+
+	// and after
+	b2 := Fixture(alice, "https://vimeo.com/2")
+	b2.Keywords = []bookmarks.Keyword{"JS", "es"}
+	b2 = mustInsert(t, repo, b2)
+	assert.Equal(t, []bookmarks.Keyword{"javascript", "es"}, b2.Keywords)
+
+	bs, _, err := repo.List(bookmarks.Filter{UserID: alice, Keywords: []bookmarks.Keyword{"js"}})
+	must(t, err)
+	assert.Equal(t, []int{b1.ID, b2.ID}, ids(bs))
+
+	// an alias of an alias joins its set
+	s, err = repo.AddSynonym(alice, "es", "js")
+	must(t, err)
+	assert.Equal(t, bookmarks.Synonym{Alias: "es", Keyword: "javascript"}, *s)
+	assert.Equal(t, []bookmarks.Keyword{"javascript"}, load(b2).Keywords)
+	assert.Equal(t, []bookmarks.Synonym{{Alias: "es", Keyword: "javascript"}, {Alias: "js", Keyword: "javascript"}}, synonyms(alice))
+
+	// the keyword of the set can change
+	_, err = repo.AddSynonym(alice, "javascript", "js")
+	must(t, err)
+	assert.Equal(t, []bookmarks.Synonym{{Alias: "es", Keyword: "js"}, {Alias: "javascript", Keyword: "js"}}, synonyms(alice))
+	assert.ElementsMatch(t, []bookmarks.Keyword{"js", "web"}, load(b1).Keywords)
+
+	// renamed keywords keep their aliases
+	must(t, repo.RenameKeyword(alice, "js", "ecmascript"))
+	assert.Equal(t, []bookmarks.Synonym{{Alias: "es", Keyword: "ecmascript"}, {Alias: "javascript", Keyword: "ecmascript"}}, synonyms(alice))
+	must(t, repo.UpdateKeywords(alice, b2.ID, []bookmarks.Keyword{"JavaScript"}))
+	assert.Equal(t, []bookmarks.Keyword{"ecmascript"}, load(b2).Keywords)
+
+	_, err = repo.AddSynonym(alice, "js", "JS")
+	assert.IsType(t, &bookmarks.ValidationError{}, err)
+	_, err = repo.AddSynonym(alice, "", "js")
+	assert.IsType(t, &bookmarks.ValidationError{}, err)
+
+	// synonyms are private
+	assert.Empty(t, synonyms(bob))
+	b3 := Fixture(bob, "https://vimeo.com/3")
+	b3.Keywords = []bookmarks.Keyword{"javascript"}
+	assert.Equal(t, []bookmarks.Keyword{"javascript"}, mustInsert(t, repo, b3).Keywords)
+	assert.IsType(t, &bookmarks.SynonymNotFoundError{}, repo.DeleteSynonym(bob, "es"))
+
+	must(t, repo.DeleteSynonym(alice, " ES "))
+	assert.Equal(t, []bookmarks.Synonym{{Alias: "javascript", Keyword: "ecmascript"}}, synonyms(alice))
+	assert.IsType(t, &bookmarks.SynonymNotFoundError{}, repo.DeleteSynonym(alice, "es"))
+	// the bookmarks are not changed
+	assert.Equal(t, []bookmarks.Keyword{"ecmascript"}, load(b2).Keywords)
+}
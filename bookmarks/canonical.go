@@ -0,0 +1,69 @@
+package bookmarks
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters added by marketing tools. They do not change the page
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+}
+
+// CanonicalURL normalizes an URL so that the different forms of a page can be detected as duplicates
+// The scheme and the host are lowercased, default ports, fragments, trailing slashes and
+// tracking parameters (utm_*, fbclid...) are removed and the other parameters are sorted
+// It returns an empty string if the URL is not an absolute http(s) URL or is too long to be stored
+func CanonicalURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	query := u.Query()
+	for name := range query {
+		if trackingParams[strings.ToLower(name)] || strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	// Encode sorts the parameters by name
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	canonical := u.String()
+	if len(canonical) > maxCanonicalURLLength {
+		return ""
+	}
+	return canonical
+}
+
+// maxCanonicalURLLength is the size of the canonical_url column
+const maxCanonicalURLLength = 255
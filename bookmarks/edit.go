@@ -0,0 +1,65 @@
+package bookmarks
+
+// Edit holds the changes of a bookmark made by its owner
+// nil properties are left untouched
+type Edit struct {
+	URL        *string
+	Title      *string
+	AuthorName *string
+	Notes      *string
+	// an empty slice removes all the keywords
+	Keywords []Keyword
+}
+
+// Apply applies the changes to a bookmark
+// If the URL changes, the oEmbed properties of the previous URL are cleared and the bookmark is
+// pending enrichment again. It returns true in this case so that the caller can enqueue it
+func (e Edit) Apply(b *Bookmark) bool {
+	urlChanged := e.URL != nil && *e.URL != b.URL
+	if urlChanged {
+		b.URL = *e.URL
+		ResetEnrichment(b)
+	}
+
+	// applied after the reset: the values of the user take precedence over the oEmbed ones
+	if e.Title != nil {
+		b.Title = *e.Title
+	}
+	if e.AuthorName != nil {
+		b.AuthorName = *e.AuthorName
+	}
+	if e.Notes != nil {
+		b.Notes = *e.Notes
+	}
+	if e.Keywords != nil {
+		b.Keywords = e.Keywords
+	}
+
+	return urlChanged
+}
+
+// ResetEnrichment clears the oEmbed properties of a bookmark and marks it as pending
+// Title and author name are cleared too since they usually come from oEmbed
+func ResetEnrichment(b *Bookmark) {
+	b.Title = ""
+	b.AuthorName = ""
+	b.Width = 0
+	b.Height = 0
+	b.Duration = 0
+	b.Provider = ""
+	b.Type = ""
+	b.ProviderURL = ""
+	b.AuthorURL = ""
+	b.ThumbnailURL = ""
+	b.ThumbnailWidth = 0
+	b.ThumbnailHeight = 0
+	b.PhotoURL = ""
+	b.HTML = ""
+	b.CacheAge = 0
+	b.HasThumbnail = false
+	b.LastRefreshedAt = nil
+	b.NextRefreshAt = nil
+	b.DeadLink = false
+	b.EnrichmentStatus = EnrichmentPending
+	b.EnrichmentError = ""
+}
@@ -0,0 +1,71 @@
+package bookmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/stretchr/testify/assert"
+)
+
+func enrichedFixture() *Bookmark {
+	refreshed := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	return &Bookmark{
+		URL:              "https://vimeo.com/1",
+		Title:            "A video",
+		AuthorName:       "Jane Doe",
+		Notes:            "To watch",
+		Width:            640,
+		Height:           360,
+		Provider:         oembed.ProviderVimeo,
+		Type:             oembed.LinkTypeVideo,
+		ThumbnailURL:     "https://i.vimeocdn.com/video/1.jpg",
+		HasThumbnail:     true,
+		LastRefreshedAt:  &refreshed,
+		EnrichmentStatus: EnrichmentDone,
+		Keywords:         []Keyword{"video"},
+	}
+}
+
+func TestEditApply(t *testing.T) {
+	title := "My video"
+	notes := ""
+	b := enrichedFixture()
+
+	assert.False(t, Edit{Title: &title, Notes: &notes}.Apply(b))
+	assert.Equal(t, "My video", b.Title)
+	assert.Equal(t, "", b.Notes)
+	// untouched
+	assert.Equal(t, "Jane Doe", b.AuthorName)
+	assert.Equal(t, []Keyword{"video"}, b.Keywords)
+	assert.Equal(t, EnrichmentDone, b.EnrichmentStatus)
+
+	assert.False(t, Edit{Keywords: []Keyword{}}.Apply(b))
+	assert.Empty(t, b.Keywords)
+
+	// the same URL is not a change
+	sameURL := "https://vimeo.com/1"
+	assert.False(t, Edit{URL: &sameURL}.Apply(b))
+	assert.True(t, b.HasThumbnail)
+}
+
+func TestEditApplyNewURL(t *testing.T) {
+	newURL := "https://www.flickr.com/photos/1"
+	title := "A photo"
+	b := enrichedFixture()
+
+	assert.True(t, Edit{URL: &newURL, Title: &title}.Apply(b))
+	assert.Equal(t, newURL, b.URL)
+	assert.Equal(t, "A photo", b.Title)
+	// the properties of the previous URL are gone
+	assert.Equal(t, "", b.AuthorName)
+	assert.Equal(t, 0, b.Width)
+	assert.Equal(t, oembed.Provider(""), b.Provider)
+	assert.Equal(t, "", b.ThumbnailURL)
+	assert.False(t, b.HasThumbnail)
+	assert.Nil(t, b.LastRefreshedAt)
+	assert.Equal(t, EnrichmentPending, b.EnrichmentStatus)
+	// the ones of the user are kept
+	assert.Equal(t, "To watch", b.Notes)
+	assert.Equal(t, []Keyword{"video"}, b.Keywords)
+}
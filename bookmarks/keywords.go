@@ -1,8 +1,10 @@
 package bookmarks
 
 import (
+	dbsql "database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -10,32 +12,84 @@ import (
 // Keyword represents a Keyword linked to a Bookmark
 type Keyword string
 
+// KeywordUsage is a keyword of a user and the number of bookmarks having it
+type KeywordUsage struct {
+	Name  Keyword `json:"name" db:"name"`
+	Count int     `json:"count" db:"count"`
+}
+
+// keywordName validates the new names of keywords. The size is the one of the keywords table
+type keywordName struct {
+	Name Keyword `json:"name" validate:"required,max=50"`
+}
+
+// keywordList validates the keywords of a bookmark, like Bookmark.Keywords
+type keywordList struct {
+	Keywords []Keyword `json:"keywords" validate:"dive,max=50"`
+}
+
 // keyword => db ID
 type keywordsMap map[Keyword]int
 
-func loadKeywords(db *sqlx.DB, id int) ([]Keyword, error) {
+// has returns true if the map has a keyword, whatever its case
+func (m keywordsMap) has(keyword Keyword) bool {
+	for kw := range m {
+		if strings.EqualFold(string(kw), string(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryer is implemented by both *sqlx.DB and *sqlx.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*dbsql.Rows, error)
+	Rebind(query string) string
+}
+
+// loadKeywords populates the keywords of a list of bookmarks using a single query
+func loadKeywords(db queryer, bookmarks []*Bookmark) error {
+	if len(bookmarks) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Bookmark, len(bookmarks))
+	ids := make([]int, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		b.Keywords = []Keyword{}
+		byID[b.ID] = b
+		ids = append(ids, b.ID)
+	}
+
 	sql := `
-SELECT kw.name
+SELECT bkw.bookmark_id, kw.name
 FROM bookmark_keywords bkw
 INNER JOIN keywords kw ON kw.id = bkw.keyword_id
-WHERE bkw.bookmark_id = ?
+WHERE bkw.bookmark_id IN (?)
 `
-	rows, err := db.Query(sql, id)
+	query, args, err := sqlx.In(sql, ids)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	rows, err := db.Query(db.Rebind(query), args...)
+	if err != nil {
+		return err
 	}
 	defer rows.Close()
 
-	keywords := []Keyword{}
 	for rows.Next() {
-		var kw string
-		if err = rows.Scan(&kw); err != nil {
-			return nil, err
+		var (
+			id int
+			kw string
+		)
+		if err = rows.Scan(&id, &kw); err != nil {
+			return err
 		}
-		keywords = append(keywords, Keyword(kw))
+		byID[id].Keywords = append(byID[id].Keywords, Keyword(kw))
 	}
 
-	return keywords, nil
+	return rows.Err()
 }
 
 func saveKeywords(tx *sqlx.Tx, bookmarkID int, keywords []Keyword) error {
@@ -44,6 +98,11 @@ func saveKeywords(tx *sqlx.Tx, bookmarkID int, keywords []Keyword) error {
 		return err
 	}
 
+	// keyword names are duplicated in the bookmarks table for full-text search
+	if err := saveKeywordNames(tx, bookmarkID, keywords); err != nil {
+		return err
+	}
+
 	if len(keywords) == 0 {
 		// nothing more to do
 		return nil
@@ -118,8 +177,9 @@ func getKeywordsMap(tx *sqlx.Tx, keywords []Keyword) (keywordsMap, error) {
 		kwmap[Keyword(name)] = id
 	}
 
+	// names are case insensitive in the database
 	for _, kw := range keywords {
-		if _, ok := kwmap[kw]; !ok {
+		if !kwmap.has(kw) {
 			kwmap[kw] = 0
 		}
 	}
@@ -160,8 +220,185 @@ func saveKwAssociations(tx *sqlx.Tx, bookmarkID int, kwIDs []int) error {
 	return err
 }
 
+// saveKeywordNames stores the keywords as a space separated list in the bookmarks table
+// MySQL can't use a full-text index spanning several tables so we have to denormalize
+func saveKeywordNames(tx *sqlx.Tx, bookmarkID int, keywords []Keyword) error {
+	names := make([]string, 0, len(keywords))
+	for _, kw := range keywords {
+		names = append(names, string(kw))
+	}
+
+	sql := `UPDATE bookmarks SET keyword_names = ? WHERE id = ?`
+	_, err := tx.Exec(sql, strings.Join(names, " "), bookmarkID)
+	return err
+}
+
 func deleteKwAssociations(tx *sqlx.Tx, bookmarkID int) error {
 	sql := `DELETE FROM bookmark_keywords WHERE bookmark_id = ?`
 	_, err := tx.Exec(sql, bookmarkID)
 	return err
 }
+
+func (rep *repository) Keywords(userID int) ([]*KeywordUsage, error) {
+	sql := `
+SELECT kw.name, COUNT(*) AS count
+FROM keywords kw
+INNER JOIN bookmark_keywords bkw ON bkw.keyword_id = kw.id
+INNER JOIN bookmarks b ON b.id = bkw.bookmark_id
+WHERE b.user_id = ?
+GROUP BY kw.id, kw.name
+ORDER BY kw.name
+`
+	usages := []*KeywordUsage{}
+	if err := rep.db.Select(&usages, sql, userID); err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+func (rep *repository) RenameKeyword(userID int, from, to Keyword) error {
+	to = NormalizeKeyword(to)
+	if err := validate(&keywordName{Name: to}); err != nil {
+		return err
+	}
+	return rep.replaceKeyword(userID, from, to, false)
+}
+
+func (rep *repository) MergeKeyword(userID int, from, into Keyword) error {
+	into = NormalizeKeyword(into)
+	if err := validate(&keywordName{Name: into}); err != nil {
+		return err
+	}
+	return rep.replaceKeyword(userID, from, into, true)
+}
+
+func (rep *repository) DeleteKeyword(userID int, name Keyword) error {
+	return rep.replaceKeyword(userID, name, "", false)
+}
+
+func (rep *repository) DeleteOrphanKeywords() (int, error) {
+	sql := `DELETE FROM keywords WHERE NOT EXISTS (
+    SELECT 1 FROM bookmark_keywords bkw WHERE bkw.keyword_id = keywords.id
+)`
+	res, err := rep.db.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+// replaceKeyword replaces a keyword by another one on all the bookmarks of a user
+// An empty replacement deletes the keyword. Unless merging, the user must not have the replacement yet
+// Keywords are shared by all the users, so the associations are changed, not the keywords
+func (rep *repository) replaceKeyword(userID int, from, to Keyword, merge bool) error {
+	tx, err := rep.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := rep.replaceKeywordTx(tx, userID, from, to, merge); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceKeywordTx replaces a keyword in a transaction. See replaceKeyword
+// The replacement must be normalized. Its synonyms are resolved
+func (rep *repository) replaceKeywordTx(tx *sqlx.Tx, userID int, from, to Keyword, merge bool) error {
+	from = NormalizeKeyword(from)
+	bookmarks, err := rep.bookmarksWithKeyword(tx, userID, from)
+	if err != nil {
+		return err
+	}
+	if len(bookmarks) == 0 {
+		return &KeywordNotFoundError{Name: from}
+	}
+
+	if to != "" {
+		synonyms, err := loadSynonyms(tx, userID)
+		if err != nil {
+			return err
+		}
+		to = synonyms.resolve(to)
+	}
+	if from == to {
+		return nil
+	}
+
+	if to != "" && !merge {
+		existing, err := rep.bookmarksWithKeyword(tx, userID, to)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return &KeywordExistsError{Name: to}
+		}
+	}
+
+	if err := loadKeywords(tx, bookmarks); err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		if err := saveKeywords(tx, b.ID, replaceKeyword(b.Keywords, from, to)); err != nil {
+			return err
+		}
+		ids = append(ids, b.ID)
+	}
+
+	// like any edit of the keywords
+	query, args, err := sqlx.In(`UPDATE bookmarks SET version = version + 1, updated_at = ? WHERE id IN (?)`, time.Now().UTC(), ids)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(tx.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	if to == "" {
+		// the synonyms still tell which keyword to use
+		return nil
+	}
+
+	// the aliases of the keyword follow it
+	sql := `UPDATE keyword_synonyms SET keyword = ? WHERE user_id = ? AND keyword = ?`
+	_, err = tx.Exec(sql, string(to), userID, string(from))
+	return err
+}
+
+// bookmarksWithKeyword returns the IDs of the bookmarks of a user having a keyword
+// and locks them until the end of the transaction
+func (rep *repository) bookmarksWithKeyword(tx *sqlx.Tx, userID int, keyword Keyword) ([]*Bookmark, error) {
+	sql := `
+SELECT b.id
+FROM bookmarks b
+INNER JOIN bookmark_keywords bkw ON bkw.bookmark_id = b.id
+INNER JOIN keywords kw ON kw.id = bkw.keyword_id
+WHERE b.user_id = ? AND kw.name = ?` + rep.dialect.forUpdate()
+
+	bookmarks := []*Bookmark{}
+	if err := tx.Select(&bookmarks, sql, userID, string(keyword)); err != nil {
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+// replaceKeyword replaces a keyword of a list. An empty replacement removes it
+// The replacement is not added twice if the list already has it
+func replaceKeyword(keywords []Keyword, from, to Keyword) []Keyword {
+	replaced := []Keyword{}
+	for _, kw := range keywords {
+		switch {
+		case !strings.EqualFold(string(kw), string(from)):
+			replaced = append(replaced, kw)
+		case to != "":
+			replaced = append(replaced, to)
+		}
+	}
+	return uniqueKeywords(replaced)
+}
@@ -0,0 +1,620 @@
+package bookmarks
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fchoquet/bookmarks/pager"
+)
+
+// NewMemoryRepository returns a Repository implementation storing bookmarks in memory
+// Everything is lost when the application stops. Useful for tests and demos
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		bookmarks: map[int]*Bookmark{},
+		synonyms:  map[int]synonymsMap{},
+	}
+}
+
+// memoryRepository mimics the SQL implementations: text comparisons are case
+// insensitive and search has no relevance score (most recent bookmarks first)
+// Bookmarks are copied in and out so that callers can't mutate the storage
+type memoryRepository struct {
+	mu        sync.RWMutex
+	lastID    int
+	bookmarks map[int]*Bookmark
+	// user ID => synonyms
+	synonyms map[int]synonymsMap
+}
+
+func (rep *memoryRepository) List(filter Filter) ([]*Bookmark, int, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	filter.Keywords = normalizeKeywords(filter.Keywords, rep.synonyms[filter.UserID])
+	matches := rep.find(filter)
+	sortBookmarks(matches, filter.Sort, filter.Order)
+
+	return paginate(matches, filter.Pager), len(matches), nil
+}
+
+func (rep *memoryRepository) Search(query string, filter Filter) ([]*Bookmark, int, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	terms := ParseSearch(query)
+	filter.Keywords = normalizeKeywords(filter.Keywords, rep.synonyms[filter.UserID])
+
+	matches := []*Bookmark{}
+	for _, b := range rep.find(filter) {
+		if matchSearch(b, terms) {
+			matches = append(matches, b)
+		}
+	}
+	sortBookmarks(matches, "", OrderDesc)
+
+	return paginate(matches, filter.Pager), len(matches), nil
+}
+
+func (rep *memoryRepository) ByID(userID, id int) (*Bookmark, error) {
+	bookmarks, _, err := rep.List(Filter{UserID: userID, ID: &id})
+	if err != nil || len(bookmarks) == 0 {
+		return nil, err
+	}
+
+	return bookmarks[0], nil
+}
+
+func (rep *memoryRepository) Insert(b *Bookmark) (*Bookmark, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	b.Keywords = normalizeKeywords(b.Keywords, rep.synonyms[b.UserID])
+	if err := validate(b); err != nil {
+		return nil, err
+	}
+
+	prepareInsert(b)
+
+	if err := rep.checkDuplicate(b); err != nil {
+		return nil, err
+	}
+
+	rep.lastID++
+	b.ID = rep.lastID
+	rep.bookmarks[b.ID] = copyBookmark(b)
+
+	return b, nil
+}
+
+func (rep *memoryRepository) Update(b *Bookmark) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	b.Keywords = normalizeKeywords(b.Keywords, rep.synonyms[b.UserID])
+	if err := validate(b); err != nil {
+		return err
+	}
+
+	stored, ok := rep.bookmarks[b.ID]
+	if !ok || stored.UserID != b.UserID {
+		return &NotFoundError{ID: b.ID}
+	}
+	if stored.Version != b.Version {
+		return &VersionConflictError{ID: b.ID, Version: stored.Version}
+	}
+
+	updatedAt := time.Now().UTC()
+	c := copyBookmark(truncateEnrichment(b))
+	c.CanonicalURL = stored.CanonicalURL
+	if c.URL != stored.URL {
+		c.CanonicalURL = CanonicalURL(c.URL)
+		if err := rep.checkDuplicate(c); err != nil {
+			return err
+		}
+	}
+	c.Host = hostOf(c.URL)
+	c.Version = b.Version + 1
+	c.UpdatedAt = &updatedAt
+	// not editable
+	c.AddedDate = stored.AddedDate
+	rep.bookmarks[b.ID] = c
+
+	b.Host = c.Host
+	b.CanonicalURL = c.CanonicalURL
+	b.Version = c.Version
+	b.UpdatedAt = c.UpdatedAt
+	return nil
+}
+
+func (rep *memoryRepository) UpdateKeywords(userID, id int, keywords []Keyword) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	keywords = normalizeKeywords(keywords, rep.synonyms[userID])
+	if err := validate(&keywordList{Keywords: keywords}); err != nil {
+		return err
+	}
+
+	b, ok := rep.bookmarks[id]
+	if !ok || b.UserID != userID {
+		return &NotFoundError{ID: id}
+	}
+
+	updatedAt := time.Now().UTC()
+	b.Keywords = keywords
+	b.Version++
+	b.UpdatedAt = &updatedAt
+	return nil
+}
+
+func (rep *memoryRepository) Keywords(userID int) ([]*KeywordUsage, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	bookmarks := []*Bookmark{}
+	for _, b := range rep.bookmarks {
+		if b.UserID == userID {
+			bookmarks = append(bookmarks, b)
+		}
+	}
+	// keywords are case insensitive. Like in the database, the oldest one gives its name
+	sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].ID < bookmarks[j].ID })
+
+	byName := map[string]*KeywordUsage{}
+	for _, b := range bookmarks {
+		for _, kw := range b.Keywords {
+			key := strings.ToLower(string(kw))
+			if _, ok := byName[key]; !ok {
+				byName[key] = &KeywordUsage{Name: kw}
+			}
+			byName[key].Count++
+		}
+	}
+
+	usages := make([]*KeywordUsage, 0, len(byName))
+	for _, usage := range byName {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return strings.ToLower(string(usages[i].Name)) < strings.ToLower(string(usages[j].Name))
+	})
+	return usages, nil
+}
+
+func (rep *memoryRepository) RenameKeyword(userID int, from, to Keyword) error {
+	to = NormalizeKeyword(to)
+	if err := validate(&keywordName{Name: to}); err != nil {
+		return err
+	}
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.replaceKeyword(userID, from, to, false)
+}
+
+func (rep *memoryRepository) MergeKeyword(userID int, from, into Keyword) error {
+	into = NormalizeKeyword(into)
+	if err := validate(&keywordName{Name: into}); err != nil {
+		return err
+	}
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.replaceKeyword(userID, from, into, true)
+}
+
+func (rep *memoryRepository) DeleteKeyword(userID int, name Keyword) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.replaceKeyword(userID, name, "", false)
+}
+
+// DeleteOrphanKeywords does nothing: keywords only exist on the bookmarks having them
+func (rep *memoryRepository) DeleteOrphanKeywords() (int, error) {
+	return 0, nil
+}
+
+// replaceKeyword follows the rules of the SQL implementation. The caller must hold the lock
+func (rep *memoryRepository) replaceKeyword(userID int, from, to Keyword, merge bool) error {
+	from = NormalizeKeyword(from)
+	bookmarks := rep.withKeyword(userID, from)
+	if len(bookmarks) == 0 {
+		return &KeywordNotFoundError{Name: from}
+	}
+
+	to = rep.synonyms[userID].resolve(to)
+	if from == to {
+		return nil
+	}
+	if to != "" && !merge && len(rep.withKeyword(userID, to)) > 0 {
+		return &KeywordExistsError{Name: to}
+	}
+
+	updatedAt := time.Now().UTC()
+	for _, b := range bookmarks {
+		b.Keywords = replaceKeyword(b.Keywords, from, to)
+		b.Version++
+		b.UpdatedAt = &updatedAt
+	}
+
+	if to != "" {
+		// the aliases of the keyword follow it
+		for alias, keyword := range rep.synonyms[userID] {
+			if keyword == from {
+				rep.synonyms[userID][alias] = to
+			}
+		}
+	}
+	return nil
+}
+
+func (rep *memoryRepository) Synonyms(userID int) ([]*Synonym, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	synonyms := []*Synonym{}
+	for alias, keyword := range rep.synonyms[userID] {
+		synonyms = append(synonyms, &Synonym{Alias: alias, Keyword: keyword})
+	}
+	sort.Slice(synonyms, func(i, j int) bool {
+		if synonyms[i].Keyword != synonyms[j].Keyword {
+			return synonyms[i].Keyword < synonyms[j].Keyword
+		}
+		return synonyms[i].Alias < synonyms[j].Alias
+	})
+	return synonyms, nil
+}
+
+// AddSynonym follows the rules of the SQL implementation
+func (rep *memoryRepository) AddSynonym(userID int, alias, keyword Keyword) (*Synonym, error) {
+	s, err := newSynonym(alias, keyword)
+	if err != nil {
+		return nil, err
+	}
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	synonyms, ok := rep.synonyms[userID]
+	if !ok {
+		synonyms = synonymsMap{}
+		rep.synonyms[userID] = synonyms
+	}
+
+	if target, ok := synonyms[s.Keyword]; ok {
+		if target == s.Alias {
+			delete(synonyms, s.Keyword)
+		} else {
+			s.Keyword = target
+		}
+	}
+	for a, kw := range synonyms {
+		if kw == s.Alias {
+			synonyms[a] = s.Keyword
+		}
+	}
+	synonyms[s.Alias] = s.Keyword
+
+	err = rep.replaceKeyword(userID, s.Alias, s.Keyword, true)
+	if _, ok := err.(*KeywordNotFoundError); ok {
+		return s, nil
+	}
+	return s, err
+}
+
+func (rep *memoryRepository) DeleteSynonym(userID int, alias Keyword) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	alias = NormalizeKeyword(alias)
+	if _, ok := rep.synonyms[userID][alias]; !ok {
+		return &SynonymNotFoundError{Alias: alias}
+	}
+	delete(rep.synonyms[userID], alias)
+	return nil
+}
+
+// withKeyword returns the bookmarks of a user having a keyword. The caller must hold the lock
+func (rep *memoryRepository) withKeyword(userID int, keyword Keyword) []*Bookmark {
+	bookmarks := []*Bookmark{}
+	for _, b := range rep.bookmarks {
+		if b.UserID == userID && hasKeyword(b, keyword) {
+			bookmarks = append(bookmarks, b)
+		}
+	}
+	return bookmarks
+}
+
+func (rep *memoryRepository) Delete(userID, id int) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	b, ok := rep.bookmarks[id]
+	if !ok || b.UserID != userID {
+		return &NotFoundError{ID: id}
+	}
+
+	delete(rep.bookmarks, id)
+	return nil
+}
+
+func (rep *memoryRepository) SaveEnrichment(b *Bookmark) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	stored, ok := rep.bookmarks[b.ID]
+	if !ok || stored.Version != b.Version {
+		return nil
+	}
+
+	b = truncateEnrichment(b)
+	stored.Title = b.Title
+	stored.AuthorName = b.AuthorName
+	stored.Width = b.Width
+	stored.Height = b.Height
+	stored.Duration = b.Duration
+	stored.Provider = b.Provider
+	stored.Type = b.Type
+	stored.EnrichmentStatus = b.EnrichmentStatus
+	stored.EnrichmentError = b.EnrichmentError
+	stored.LastRefreshedAt = b.LastRefreshedAt
+	stored.NextRefreshAt = b.NextRefreshAt
+	stored.DeadLink = b.DeadLink
+	stored.ProviderURL = b.ProviderURL
+	stored.AuthorURL = b.AuthorURL
+	stored.ThumbnailURL = b.ThumbnailURL
+	stored.ThumbnailWidth = b.ThumbnailWidth
+	stored.ThumbnailHeight = b.ThumbnailHeight
+	stored.HTML = b.HTML
+	stored.CacheAge = b.CacheAge
+	stored.HasThumbnail = b.HasThumbnail
+	stored.PhotoURL = b.PhotoURL
+
+	// the canonical URL of the provider is ignored if another bookmark already has it
+	if b.CanonicalURL != "" && rep.checkDuplicate(&Bookmark{ID: b.ID, UserID: stored.UserID, CanonicalURL: b.CanonicalURL}) == nil {
+		stored.CanonicalURL = b.CanonicalURL
+	}
+
+	return nil
+}
+
+// checkDuplicate returns a DuplicateError if another bookmark of the user has the same canonical URL
+// The caller must hold the lock
+func (rep *memoryRepository) checkDuplicate(b *Bookmark) error {
+	if b.CanonicalURL == "" {
+		return nil
+	}
+	for _, other := range rep.bookmarks {
+		if other.ID != b.ID && other.UserID == b.UserID && other.CanonicalURL == b.CanonicalURL {
+			return &DuplicateError{URL: b.URL, ID: other.ID}
+		}
+	}
+	return nil
+}
+
+func (rep *memoryRepository) PendingEnrichments(limit int) ([]*Bookmark, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	pending := []*Bookmark{}
+	for _, b := range rep.bookmarks {
+		if b.EnrichmentStatus == EnrichmentPending {
+			pending = append(pending, copyBookmark(b))
+		}
+	}
+	sortBookmarks(pending, "", OrderAsc)
+
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (rep *memoryRepository) StaleBookmarks(before, now time.Time, limit int) ([]*Bookmark, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	stale := []*Bookmark{}
+	for _, b := range rep.bookmarks {
+		if b.EnrichmentStatus == EnrichmentPending {
+			continue
+		}
+		due := refreshedAt(b).Before(before)
+		if b.NextRefreshAt != nil {
+			// the last refresh failed
+			due = !b.NextRefreshAt.After(now)
+		}
+		if due {
+			stale = append(stale, copyBookmark(b))
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		if !staleSince(stale[i]).Equal(staleSince(stale[j])) {
+			return staleSince(stale[i]).Before(staleSince(stale[j]))
+		}
+		return stale[i].ID < stale[j].ID
+	})
+
+	if len(stale) > limit {
+		stale = stale[:limit]
+	}
+	return stale, nil
+}
+
+// refreshedAt returns when the oEmbed properties of a bookmark were last fetched
+func refreshedAt(b *Bookmark) time.Time {
+	if b.LastRefreshedAt != nil {
+		return *b.LastRefreshedAt
+	}
+	return *b.AddedDate
+}
+
+// staleSince orders the stale bookmarks. Failing ones are ordered by their next refresh
+func staleSince(b *Bookmark) time.Time {
+	if b.NextRefreshAt != nil {
+		return *b.NextRefreshAt
+	}
+	return refreshedAt(b)
+}
+
+// find returns copies of the bookmarks matching the filter, in no particular order
+// The caller must hold the lock
+func (rep *memoryRepository) find(filter Filter) []*Bookmark {
+	matches := []*Bookmark{}
+	for _, b := range rep.bookmarks {
+		if matchFilter(b, filter) {
+			matches = append(matches, copyBookmark(b))
+		}
+	}
+	return matches
+}
+
+func matchFilter(b *Bookmark, filter Filter) bool {
+	switch {
+	case b.UserID != filter.UserID,
+		filter.ID != nil && b.ID != *filter.ID,
+		filter.URL != "" && b.URL != filter.URL,
+		filter.AuthorName != "" && !strings.EqualFold(b.AuthorName, filter.AuthorName),
+		filter.Provider != "" && !strings.EqualFold(string(b.Provider), string(filter.Provider)),
+		filter.Type != "" && !strings.EqualFold(string(b.Type), string(filter.Type)),
+		filter.Host != "" && b.Host != normalizeHost(filter.Host),
+		filter.AddedAfter != nil && b.AddedDate.Before(*filter.AddedAfter),
+		filter.AddedBefore != nil && !b.AddedDate.Before(*filter.AddedBefore):
+		return false
+	}
+
+	if len(filter.Keywords) == 0 {
+		return true
+	}
+
+	// keywords are normalized and unique
+	found := 0
+	for _, kw := range filter.Keywords {
+		if taggedWith(b, kw) {
+			found++
+		}
+	}
+
+	if filter.KeywordsMatch == MatchAll {
+		return found == len(filter.Keywords)
+	}
+	return found > 0
+}
+
+// taggedWith returns true if a bookmark has a keyword or one of its children
+func taggedWith(b *Bookmark, keyword Keyword) bool {
+	for _, kw := range b.Keywords {
+		if keyword.Includes(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasKeyword(b *Bookmark, keyword Keyword) bool {
+	for _, kw := range b.Keywords {
+		if strings.EqualFold(string(kw), string(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSearch returns true if the bookmark contains all the included terms
+// and none of the excluded ones
+func matchSearch(b *Bookmark, terms []SearchTerm) bool {
+	keywords := make([]string, 0, len(b.Keywords))
+	for _, kw := range b.Keywords {
+		keywords = append(keywords, string(kw))
+	}
+	document := strings.ToLower(strings.Join([]string{
+		b.Title, b.AuthorName, b.URL, strings.Join(keywords, " "),
+	}, " "))
+
+	included := false
+	for _, term := range terms {
+		found := strings.Contains(document, strings.ToLower(term.Text))
+		if found == term.Exclude {
+			return false
+		}
+		included = included || !term.Exclude
+	}
+
+	// excluding terms from nothing returns nothing
+	return included
+}
+
+func sortBookmarks(bookmarks []*Bookmark, field SortField, order SortOrder) {
+	less := func(a, b *Bookmark) bool {
+		switch field {
+		case SortByAddedDate:
+			if !a.AddedDate.Equal(*b.AddedDate) {
+				return a.AddedDate.Before(*b.AddedDate)
+			}
+		case SortByTitle:
+			if !strings.EqualFold(a.Title, b.Title) {
+				return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+			}
+		case SortByAuthor:
+			if !strings.EqualFold(a.AuthorName, b.AuthorName) {
+				return strings.ToLower(a.AuthorName) < strings.ToLower(b.AuthorName)
+			}
+		}
+		// id is a tie-breaker, like in SQL
+		return a.ID < b.ID
+	}
+
+	sort.Slice(bookmarks, func(i, j int) bool {
+		if order == OrderDesc {
+			return less(bookmarks[j], bookmarks[i])
+		}
+		return less(bookmarks[i], bookmarks[j])
+	})
+}
+
+func paginate(bookmarks []*Bookmark, p pager.Pager) []*Bookmark {
+	if p == nil || !p.Enabled() {
+		return bookmarks
+	}
+
+	if p.First() >= len(bookmarks) {
+		return []*Bookmark{}
+	}
+
+	last := p.First() + p.Limit()
+	if last > len(bookmarks) {
+		last = len(bookmarks)
+	}
+	return bookmarks[p.First():last]
+}
+
+// uniqueKeywords removes duplicates. Keywords are unique in the SQL implementations
+func uniqueKeywords(keywords []Keyword) []Keyword {
+	unique := []Keyword{}
+	for _, kw := range keywords {
+		found := false
+		for _, u := range unique {
+			if strings.EqualFold(string(u), string(kw)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unique = append(unique, kw)
+		}
+	}
+	return unique
+}
+
+func copyBookmark(b *Bookmark) *Bookmark {
+	c := *b
+	c.Keywords = append([]Keyword{}, b.Keywords...)
+	if b.AddedDate != nil {
+		addedDate := *b.AddedDate
+		c.AddedDate = &addedDate
+	}
+	return &c
+}
@@ -0,0 +1,14 @@
+package bookmarks_test
+
+import (
+	"testing"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/bookmarks/bookmarkstest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	bookmarkstest.Run(t, func(t *testing.T) (bookmarks.Repository, int, int) {
+		return bookmarks.NewMemoryRepository(), 1, 2
+	})
+}
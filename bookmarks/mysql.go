@@ -0,0 +1,61 @@
+package bookmarks
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDialect implements MySQL specific SQL
+// Search is backed by a FULLTEXT index. Keyword names are denormalized in the
+// bookmarks table since a full-text index can't span several tables
+type mysqlDialect struct{}
+
+func (mysqlDialect) forUpdate() string {
+	return ` FOR UPDATE`
+}
+
+// mysqlDuplicateEntry is the error number of unique index violations
+const mysqlDuplicateEntry = 1062
+
+func (mysqlDialect) isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+func (mysqlDialect) search(terms []SearchTerm, args map[string]interface{}) (string, string, bool) {
+	query := booleanQuery(terms)
+	if query == "" || !strings.Contains(query, "+") {
+		// excluding terms from nothing returns nothing
+		return "", "", false
+	}
+
+	match := `MATCH (title, author_name, url, keyword_names) AGAINST (:query IN BOOLEAN MODE)`
+	args["query"] = query
+
+	return match, match + ` DESC, id DESC`, true
+}
+
+// minSearchWordLength is the minimal length of indexed words
+// (innodb_ft_min_token_size). Shorter words never match so they are ignored
+const minSearchWordLength = 3
+
+// booleanQuery converts search terms to a MySQL boolean mode full-text query
+// All terms are required and words are prefix matched
+func booleanQuery(terms []SearchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		switch {
+		case term.Exclude && term.Phrase:
+			parts = append(parts, `-"`+term.Text+`"`)
+		case term.Exclude:
+			parts = append(parts, `-`+term.Text)
+		case term.Phrase:
+			parts = append(parts, `+"`+term.Text+`"`)
+		case len([]rune(term.Text)) >= minSearchWordLength:
+			parts = append(parts, `+`+term.Text+`*`)
+		}
+	}
+	return strings.Join(parts, " ")
+}
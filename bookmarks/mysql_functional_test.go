@@ -0,0 +1,43 @@
+//go:build functional
+
+package bookmarks_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/bookmarks/bookmarkstest"
+	"github.com/fchoquet/bookmarks/users"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Run with: TEST_MYSQL_DSN="root:test@tcp(127.0.0.1:3307)/bookmarks_test?parseTime=true" go test -tags functional ./bookmarks/
+// WARNING: all the tables of the test database are emptied
+func TestMySQLRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := sqlx.MustConnect("mysql", dsn)
+
+	bookmarkstest.Run(t, func(t *testing.T) (bookmarks.Repository, int, int) {
+		for _, table := range []string{"bookmark_keywords", "keywords", "bookmarks", "users"} {
+			db.MustExec(`DELETE FROM ` + table)
+		}
+
+		usersRepo := users.NewRepository(db)
+		alice, err := usersRepo.Register("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob, err := usersRepo.Register("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return bookmarks.NewRepository(db), alice.ID, bob.ID
+	})
+}
@@ -0,0 +1,14 @@
+package bookmarks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBooleanQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	terms := ParseSearch(`vimeo "design patterns" -tutorial -"bad movie" go`)
+	assert.Equal(`+vimeo* +"design patterns" -tutorial -"bad movie"`, booleanQuery(terms))
+}
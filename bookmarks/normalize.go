@@ -0,0 +1,64 @@
+package bookmarks
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// KeywordSeparator separates the levels of hierarchical keywords: video/tutorials
+// Filtering bookmarks by a keyword includes its children
+const KeywordSeparator = "/"
+
+// NormalizeKeyword returns the canonical form of a keyword, so that the different spellings
+// users type are stored once: the keyword is put in NFC form and case folded, fullwidth
+// characters are converted to ASCII, invisible characters are removed and the spaces around
+// the levels of hierarchical keywords are trimmed. "  Video / Tutorials " becomes video/tutorials
+// It returns an empty keyword if nothing is left. The length is not checked
+func NormalizeKeyword(kw Keyword) Keyword {
+	folded := []rune{}
+	for _, r := range norm.NFC.String(string(kw)) {
+		switch {
+		case unicode.IsSpace(r):
+			r = ' '
+		case unicode.In(r, unicode.Cc, unicode.Cf):
+			// zero width spaces, byte order marks...
+			continue
+		case r >= '\uFF01' && r <= '\uFF5E':
+			// fullwidth forms of ASCII characters
+			r -= 0xFEE0
+		}
+
+		folded = append(folded, unicode.ToLower(unicode.ToUpper(r)))
+	}
+
+	levels := []string{}
+	for _, level := range strings.Split(string(folded), KeywordSeparator) {
+		if level = strings.Join(strings.Fields(level), " "); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return Keyword(strings.Join(levels, KeywordSeparator))
+}
+
+// Includes returns true if a keyword is the other one or one of its ancestors
+// video includes video and video/tutorials but not videos
+func (kw Keyword) Includes(other Keyword) bool {
+	return kw == other || strings.HasPrefix(string(other), string(kw)+KeywordSeparator)
+}
+
+// normalizeKeywords normalizes keywords and resolves their synonyms
+// Empty keywords and duplicates are removed
+func normalizeKeywords(keywords []Keyword, synonyms synonymsMap) []Keyword {
+	normalized := []Keyword{}
+	seen := map[Keyword]bool{}
+	for _, kw := range keywords {
+		kw = synonyms.resolve(NormalizeKeyword(kw))
+		if kw != "" && !seen[kw] {
+			seen[kw] = true
+			normalized = append(normalized, kw)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,60 @@
+package bookmarks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeKeyword(t *testing.T) {
+	fixtures := map[Keyword]Keyword{
+		"design":                               "design",
+		"  Design ":                            "design",
+		"DESIGN":                               "design",
+		"web  design":                          "web design",
+		"web\tdesign\n":                        "web design",
+		"\uFF24\uFF45\uFF53\uFF49\uFF47\uFF4E": "design",
+		"de\u200Bsign":                         "design",
+		"\uFEFFdesign":                         "design",
+		"Caf\u00E9":                            "caf\u00E9",
+		"Cafe\u0301":                           "caf\u00E9",
+		"E\u0301COLE":                          "\u00E9cole",
+		"S\u030Ckoda":                          "\u0161koda",
+		"Video/Tutorials":                      "video/tutorials",
+		" Video / Tutorials ":                  "video/tutorials",
+		"/video//tutorials/":                   "video/tutorials",
+		"c++":                                  "c++",
+		"":                                     "",
+		"   ":                                  "",
+		" / ":                                  "",
+	}
+
+	for input, expected := range fixtures {
+		assert.Equal(t, expected, NormalizeKeyword(input), string(input))
+	}
+}
+
+func TestKeywordIncludes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Keyword("video").Includes("video"))
+	assert.True(Keyword("video").Includes("video/tutorials"))
+	assert.True(Keyword("video").Includes("video/tutorials/go"))
+	assert.True(Keyword("video/tutorials").Includes("video/tutorials/go"))
+	assert.False(Keyword("video").Includes("videos"))
+	assert.False(Keyword("video/tutorials").Includes("video"))
+	assert.False(Keyword("tutorials").Includes("video/tutorials"))
+}
+
+func TestNormalizeKeywords(t *testing.T) {
+	assert := assert.New(t)
+
+	synonyms := synonymsMap{"js": "javascript"}
+
+	assert.Equal(
+		[]Keyword{"javascript", "web"},
+		normalizeKeywords([]Keyword{"JS", "", "javascript", " Web", "web"}, synonyms),
+	)
+	assert.Equal([]Keyword{}, normalizeKeywords(nil, synonyms))
+	assert.Equal([]Keyword{"js"}, normalizeKeywords([]Keyword{"js"}, nil))
+}
@@ -0,0 +1,69 @@
+package bookmarks
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchTerm is a word or a quoted phrase of a search query
+type SearchTerm struct {
+	Text    string
+	Phrase  bool
+	Exclude bool
+}
+
+// ParseSearch splits a search query into terms
+// Quoted phrases are kept together and terms prefixed with - are excluded
+// ie: `vimeo "design patterns" -tutorial`
+func ParseSearch(q string) []SearchTerm {
+	terms := []SearchTerm{}
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		term := SearchTerm{}
+		if runes[i] == '-' {
+			term.Exclude = true
+			i++
+		}
+
+		start := i
+		if i < len(runes) && runes[i] == '"' {
+			term.Phrase = true
+			start++
+			// let's be tolerant with unbalanced quotes
+			for i = start; i < len(runes) && runes[i] != '"'; i++ {
+			}
+			term.Text = string(runes[start:i])
+			i++
+		} else {
+			for ; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+			}
+			term.Text = string(runes[start:i])
+		}
+
+		term.Text = strings.Join(strings.FieldsFunc(term.Text, isSearchSeparator), " ")
+		if term.Text == "" {
+			continue
+		}
+
+		// a word containing separators (e-mail) is actually a phrase
+		if strings.Contains(term.Text, " ") {
+			term.Phrase = true
+		}
+
+		terms = append(terms, term)
+	}
+
+	return terms
+}
+
+// isSearchSeparator returns true for white spaces and characters having a special meaning
+// in MySQL boolean full-text searches
+func isSearchSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`+-<>()~*"@`, r)
+}
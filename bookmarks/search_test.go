@@ -0,0 +1,47 @@
+package bookmarks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		input    string
+		expected []SearchTerm
+	}{
+		{"", []SearchTerm{}},
+		{"   ", []SearchTerm{}},
+		{
+			"vimeo design",
+			[]SearchTerm{{Text: "vimeo"}, {Text: "design"}},
+		},
+		{
+			`vimeo "design patterns" -tutorial`,
+			[]SearchTerm{
+				{Text: "vimeo"},
+				{Text: "design patterns", Phrase: true},
+				{Text: "tutorial", Exclude: true},
+			},
+		},
+		{
+			`-"bad  movie" e-mail`,
+			[]SearchTerm{
+				{Text: "bad movie", Phrase: true, Exclude: true},
+				{Text: "e mail", Phrase: true},
+			},
+		},
+		{
+			// unbalanced quotes and operators
+			`"unbalanced phrase +foo* - @`,
+			[]SearchTerm{{Text: "unbalanced phrase foo", Phrase: true}},
+		},
+	}
+
+	for _, f := range fixtures {
+		assert.Equal(f.expected, ParseSearch(f.input), f.input)
+	}
+}
@@ -0,0 +1,47 @@
+package bookmarks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqliteDialect implements SQLite specific SQL
+// Search is a simple LIKE on every term. There's no relevance score so the most
+// recent bookmarks come first. This is good enough for a single user database
+type sqliteDialect struct{}
+
+func (sqliteDialect) forUpdate() string {
+	// SQLite locks the whole database when writing
+	return ``
+}
+
+func (sqliteDialect) isDuplicate(err error) bool {
+	// the driver requires cgo, so let's not depend on its error type
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func (sqliteDialect) search(terms []SearchTerm, args map[string]interface{}) (string, string, bool) {
+	document := `(title || ' ' || author_name || ' ' || url || ' ' || keyword_names)`
+
+	conditions := []string{}
+	included := false
+	for i, term := range terms {
+		name := fmt.Sprintf("term_%d", i)
+		args[name] = "%" + escapeLike(term.Text) + "%"
+
+		if term.Exclude {
+			conditions = append(conditions, document+` NOT LIKE :`+name+` ESCAPE '!'`)
+			continue
+		}
+
+		included = true
+		conditions = append(conditions, document+` LIKE :`+name+` ESCAPE '!'`)
+	}
+
+	// excluding terms from nothing returns nothing
+	if !included {
+		return "", "", false
+	}
+
+	return `(` + strings.Join(conditions, ` AND `) + `)`, `id DESC`, true
+}
@@ -0,0 +1,43 @@
+//go:build sqlite
+
+package bookmarks_test
+
+import (
+	"testing"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/bookmarks/bookmarkstest"
+	"github.com/fchoquet/bookmarks/database"
+	"github.com/fchoquet/bookmarks/users"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Run with: go test -tags sqlite ./bookmarks/
+// (requires cgo)
+func TestSQLiteRepository(t *testing.T) {
+	bookmarkstest.Run(t, func(t *testing.T) (bookmarks.Repository, int, int) {
+		db := sqlx.MustConnect("sqlite3", "file::memory:?_foreign_keys=1")
+		// every connection would open a distinct in-memory database
+		db.SetMaxOpenConns(1)
+		migrator, err := database.NewMigrator(db, database.DriverSQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+
+		usersRepo := users.NewRepository(db)
+		alice, err := usersRepo.Register("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob, err := usersRepo.Register("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return bookmarks.NewSQLiteRepository(db), alice.ID, bob.ID
+	})
+}
@@ -0,0 +1,78 @@
+package bookmarks
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// KeywordSweeper periodically deletes the keywords no bookmark has anymore
+// Deleting, renaming and merging keywords or bookmarks leaves them behind
+type KeywordSweeper interface {
+	// Start starts sweeping periodically
+	Start()
+	// Stop waits for the current sweep and stops sweeping
+	Stop()
+}
+
+// DefaultSweepInterval is how often orphan keywords are deleted by default
+const DefaultSweepInterval = time.Hour
+
+type keywordSweeper struct {
+	repo     Repository
+	logger   log.FieldLogger
+	interval time.Duration
+
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewKeywordSweeper returns a sweeper deleting the orphan keywords of the repository every interval
+func NewKeywordSweeper(repo Repository, logger log.FieldLogger, interval time.Duration) KeywordSweeper {
+	return &keywordSweeper{
+		repo:     repo,
+		logger:   logger,
+		interval: interval,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start implements the KeywordSweeper interface
+func (s *keywordSweeper) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+				s.sweep()
+			}
+		}
+	}()
+}
+
+// Stop implements the KeywordSweeper interface
+func (s *keywordSweeper) Stop() {
+	s.stopOnce.Do(func() { close(s.quit) })
+	s.wg.Wait()
+}
+
+func (s *keywordSweeper) sweep() {
+	count, err := s.repo.DeleteOrphanKeywords()
+	if err != nil {
+		// the next sweep will try again
+		s.logger.WithError(err).Warning("could not delete orphan keywords")
+		return
+	}
+	if count > 0 {
+		s.logger.WithField("count", count).Info("orphan keywords deleted")
+	}
+}
@@ -0,0 +1,45 @@
+package bookmarks
+
+import (
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// sweptRepository counts the sweeps
+type sweptRepository struct {
+	Repository
+	sweeps int32
+}
+
+func (rep *sweptRepository) DeleteOrphanKeywords() (int, error) {
+	atomic.AddInt32(&rep.sweeps, 1)
+	return 1, nil
+}
+
+func TestKeywordSweeper(t *testing.T) {
+	repo := &sweptRepository{Repository: NewMemoryRepository()}
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	sweeper := NewKeywordSweeper(repo, logger, 5*time.Millisecond)
+	sweeper.Start()
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&repo.sweeps) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sweeper.Stop()
+	// stopping twice is harmless
+	sweeper.Stop()
+
+	sweeps := atomic.LoadInt32(&repo.sweeps)
+	assert.True(t, sweeps >= 2, "expected at least 2 sweeps - got %d", sweeps)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, sweeps, atomic.LoadInt32(&repo.sweeps), "no sweep after stopping")
+}
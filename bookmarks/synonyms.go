@@ -0,0 +1,155 @@
+package bookmarks
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// Synonym makes a keyword an alias of another one: js => javascript
+// Bookmarks are tagged with the keyword instead of its aliases, and filtering by an alias
+// filters by the keyword. Aliases are not chained: each one points to the keyword of its set
+type Synonym struct {
+	Alias   Keyword `json:"alias" db:"alias" validate:"required,max=50,nefield=Keyword"`
+	Keyword Keyword `json:"keyword" db:"keyword" validate:"required,max=50"`
+}
+
+// alias => keyword
+type synonymsMap map[Keyword]Keyword
+
+// resolve returns the keyword of an alias, or the keyword itself
+func (m synonymsMap) resolve(kw Keyword) Keyword {
+	if target, ok := m[kw]; ok {
+		return target
+	}
+	return kw
+}
+
+// newSynonym normalizes a synonym and validates it
+func newSynonym(alias, keyword Keyword) (*Synonym, error) {
+	s := &Synonym{Alias: NormalizeKeyword(alias), Keyword: NormalizeKeyword(keyword)}
+	if err := validate(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadSynonyms returns the synonyms of a user
+func loadSynonyms(db queryer, userID int) (synonymsMap, error) {
+	rows, err := db.Query(db.Rebind(`SELECT alias, keyword FROM keyword_synonyms WHERE user_id = ?`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	synonyms := synonymsMap{}
+	for rows.Next() {
+		var alias, keyword string
+		if err = rows.Scan(&alias, &keyword); err != nil {
+			return nil, err
+		}
+		synonyms[Keyword(alias)] = Keyword(keyword)
+	}
+
+	return synonyms, rows.Err()
+}
+
+// resolveKeywords normalizes the keywords of a user and resolves their synonyms
+func resolveKeywords(db queryer, userID int, keywords []Keyword) ([]Keyword, error) {
+	if len(keywords) == 0 {
+		return []Keyword{}, nil
+	}
+
+	synonyms, err := loadSynonyms(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeKeywords(keywords, synonyms), nil
+}
+
+func (rep *repository) Synonyms(userID int) ([]*Synonym, error) {
+	sql := `SELECT alias, keyword FROM keyword_synonyms WHERE user_id = ? ORDER BY keyword, alias`
+
+	synonyms := []*Synonym{}
+	if err := rep.db.Select(&synonyms, sql, userID); err != nil {
+		return nil, err
+	}
+	return synonyms, nil
+}
+
+func (rep *repository) AddSynonym(userID int, alias, keyword Keyword) (*Synonym, error) {
+	s, err := newSynonym(alias, keyword)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := rep.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rep.addSynonym(tx, userID, s); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return s, tx.Commit()
+}
+
+// addSynonym saves a synonym and merges the alias into the keyword on the bookmarks of the user
+func (rep *repository) addSynonym(tx *sqlx.Tx, userID int, s *Synonym) error {
+	synonyms, err := loadSynonyms(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if target, ok := synonyms[s.Keyword]; ok {
+		if target == s.Alias {
+			// the keyword of the set changes: js => javascript becomes javascript => js
+			if _, err := tx.Exec(`DELETE FROM keyword_synonyms WHERE user_id = ? AND alias = ?`, userID, string(s.Keyword)); err != nil {
+				return err
+			}
+		} else {
+			s.Keyword = target
+		}
+	}
+
+	// the other aliases of the set follow
+	sql := `UPDATE keyword_synonyms SET keyword = ? WHERE user_id = ? AND keyword = ?`
+	if _, err := tx.Exec(sql, string(s.Keyword), userID, string(s.Alias)); err != nil {
+		return err
+	}
+
+	// an alias can only have one keyword
+	if _, err := tx.Exec(`DELETE FROM keyword_synonyms WHERE user_id = ? AND alias = ?`, userID, string(s.Alias)); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO keyword_synonyms (user_id, alias, keyword) VALUES (?, ?, ?)`
+	if _, err := tx.Exec(sql, userID, string(s.Alias), string(s.Keyword)); err != nil {
+		return err
+	}
+
+	err = rep.replaceKeywordTx(tx, userID, s.Alias, s.Keyword, true)
+	if _, ok := err.(*KeywordNotFoundError); ok {
+		// no bookmark has the alias yet
+		return nil
+	}
+	return err
+}
+
+func (rep *repository) DeleteSynonym(userID int, alias Keyword) error {
+	alias = NormalizeKeyword(alias)
+
+	res, err := rep.db.Exec(`DELETE FROM keyword_synonyms WHERE user_id = ? AND alias = ?`, userID, string(alias))
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return &SynonymNotFoundError{Alias: alias}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package bookmarks
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// FieldError is a property of a bookmark that is not valid
+type FieldError struct {
+	// The JSON name of the property
+	Field string
+	// The validation rule that failed: required, max, url...
+	Rule string
+	// A message the user can read
+	Message string
+}
+
+// ValidationError is returned when a bookmark is not valid. It lists every invalid property
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error implements the Error interface
+func (err *ValidationError) Error() string {
+	msgs := []string{}
+	for _, field := range err.Fields {
+		msgs = append(msgs, field.Message)
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// structValidator caches the validation rules of the structs. It is safe for concurrent use
+var structValidator = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// errors are named after the JSON properties the clients know
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || name == "" {
+			name = field.Tag.Get("db")
+		}
+		return name
+	})
+	return v
+}
+
+// validate returns a ValidationError if a bookmark, or another struct, is not valid
+func validate(s interface{}) error {
+	err := structValidator.Struct(s)
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	validationErr := &ValidationError{}
+	for _, fieldErr := range errs {
+		validationErr.Fields = append(validationErr.Fields, FieldError{
+			Field:   fieldErr.Field(),
+			Rule:    fieldErr.Tag(),
+			Message: message(fieldErr),
+		})
+	}
+	return validationErr
+}
+
+// message describes a failed validation rule
+func message(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", err.Field())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters long", err.Field(), err.Param())
+	case "url":
+		return fmt.Sprintf("%s must be a valid URL", err.Field())
+	case "nefield":
+		return fmt.Sprintf("%s must be different from %s", err.Field(), strings.ToLower(err.Param()))
+	default:
+		return fmt.Sprintf("%s is not valid", err.Field())
+	}
+}
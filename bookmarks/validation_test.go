@@ -0,0 +1,32 @@
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, validate(&Bookmark{UserID: 1, URL: "https://vimeo.com/1"}))
+
+	err := validate(&Bookmark{
+		URL:   "not an URL",
+		Title: strings.Repeat("a", 101),
+	})
+	if !assert.IsType(t, &ValidationError{}, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, []FieldError{
+		{Field: "url", Rule: "url", Message: "url must be a valid URL"},
+		{Field: "title", Rule: "max", Message: "title must be at most 100 characters long"},
+		{Field: "user_id", Rule: "required", Message: "user_id is required"},
+	}, err.(*ValidationError).Fields)
+	assert.Equal(t, "url must be a valid URL, title must be at most 100 characters long, user_id is required", err.Error())
+
+	err = validate(&Bookmark{UserID: 1})
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Equal(t, []FieldError{{Field: "url", Rule: "required", Message: "url is required"}}, err.(*ValidationError).Fields)
+	}
+}
@@ -0,0 +1,334 @@
+// Package database manages the database schema
+// Migrations are embedded so that the binary is self-contained
+package database
+
+import (
+	gocontext "context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migration files are named NNNN_description.up.sql and NNNN_description.down.sql
+// and stored in a directory per driver (migrations/mysql, migrations/sqlite)
+// Statements must end with a semicolon at the end of a line
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Supported drivers
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// lockTimeout is how long we wait for another instance to finish migrating
+const lockTimeout = 60 * time.Second
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells if a migration has been applied
+type MigrationStatus struct {
+	Migration
+	// nil if pending
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sqlx.DB
+	driver     string
+	migrations []Migration
+}
+
+// NewMigrator returns a migrator using the embedded migrations of the driver
+func NewMigrator(db *sqlx.DB, driver string) (*Migrator, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		driver:     driver,
+		migrations: migrations,
+	}, nil
+}
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations found for driver %s", driver)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		matches := migrationFileName.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		// the regexp guarantees that this is a number
+		version, _ := strconv.Atoi(matches[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Status returns all the known migrations and tells which ones are applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.createTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies all the pending migrations and returns them
+// It is safe to call it from several instances at the same time
+func (m *Migrator) Up() ([]Migration, error) {
+	done := []Migration{}
+
+	err := m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(migration, migration.Up, true); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %s", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the last applied migration and returns it
+// returns nil if there is nothing to revert
+func (m *Migrator) Down() (*Migration, error) {
+	var reverted *Migration
+
+	err := m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(migration, migration.Down, false); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %s", migration.Version, migration.Name, err)
+			}
+			reverted = &migration
+			return nil
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// apply runs the statements of a migration and records it in schema_migrations
+// Note that MySQL commits DDL statements implicitly, so a failing migration
+// might be partially applied
+func (m *Migrator) apply(migration Migration, script string, up bool) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if up {
+		_, err = tx.Exec(
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			migration.Version, migration.Name, time.Now().UTC(),
+		)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a script on semicolons ending a line
+// Drivers do not execute several statements at once by default
+func splitStatements(script string) []string {
+	statements := []string{}
+	current := []string{}
+	for _, line := range strings.Split(script, "\n") {
+		current = append(current, line)
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if statement := strings.TrimSpace(strings.Join(current, "\n")); !isComment(statement) {
+				statements = append(statements, statement)
+			}
+			current = []string{}
+		}
+	}
+
+	if statement := strings.TrimSpace(strings.Join(current, "\n")); statement != "" && !isComment(statement) {
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
+
+// isComment returns true if every line of a statement is a comment
+func isComment(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Migrator) createTable() error {
+	_, err := m.db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version int NOT NULL PRIMARY KEY,
+    name varchar(255) NOT NULL,
+    applied_at datetime NOT NULL
+)`)
+	return err
+}
+
+// applied returns the applied migration versions with their application date
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	rows, err := m.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// withLock runs f while holding a lock preventing concurrent migrations
+// MySQL uses an advisory lock. SQLite databases are local files that are not
+// shared between replicas, and writes are serialized anyway
+func (m *Migrator) withLock(f func() error) error {
+	if err := m.createTable(); err != nil {
+		return err
+	}
+
+	if m.driver != DriverMySQL {
+		return f()
+	}
+
+	// advisory locks belong to a session so we must release it with the same connection
+	ctx := gocontext.Background()
+	conn, err := m.db.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, `SELECT GET_LOCK('bookmarks_schema_migrations', ?)`, int(lockTimeout.Seconds())).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("could not acquire the migrations lock within %s", lockTimeout)
+	}
+	defer conn.ExecContext(ctx, `SELECT RELEASE_LOCK('bookmarks_schema_migrations')`)
+
+	return f()
+}
@@ -0,0 +1,3 @@
+DROP TABLE `bookmark_keywords`;
+DROP TABLE `keywords`;
+DROP TABLE `bookmarks`;
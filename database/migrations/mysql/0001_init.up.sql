@@ -1,4 +1,6 @@
-CREATE TABLE `bookmarks` (
+-- The schema provisioned by database/schema.sql, before migrations existed
+-- IF NOT EXISTS allows adopting those databases: the tables are the same
+CREATE TABLE IF NOT EXISTS `bookmarks` (
   `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
   `url` varchar(255) NOT NULL,
   `title` varchar(100) NOT NULL,
@@ -11,7 +13,7 @@ CREATE TABLE `bookmarks` (
   UNIQUE KEY `id` (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
-CREATE TABLE `keywords` (
+CREATE TABLE IF NOT EXISTS `keywords` (
   `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
   `name` varchar(50) NOT NULL,
   PRIMARY KEY (`id`),
@@ -19,7 +21,7 @@ CREATE TABLE `keywords` (
   UNIQUE KEY `name` (`name`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
-CREATE TABLE `bookmark_keywords` (
+CREATE TABLE IF NOT EXISTS `bookmark_keywords` (
     `bookmark_id` int(10) unsigned NOT NULL,
     `keyword_id` int(10) unsigned NOT NULL,
     KEY `bookmark_keywords_bookmark_id` (`bookmark_id`),
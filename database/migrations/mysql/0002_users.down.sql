@@ -0,0 +1,5 @@
+ALTER TABLE `bookmarks`
+  DROP FOREIGN KEY `fk_bookmarks_user_id`,
+  DROP KEY `bookmarks_user_id`,
+  DROP COLUMN `user_id`;
+DROP TABLE `users`;
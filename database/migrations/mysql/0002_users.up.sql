@@ -0,0 +1,16 @@
+-- bookmarks belong to a user. Users are registered when the application starts
+CREATE TABLE `users` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+-- existing bookmarks were shared by all the users. They are given to the admin user
+INSERT INTO `users` (`name`) SELECT 'admin' FROM DUAL WHERE EXISTS (SELECT 1 FROM `bookmarks`);
+ALTER TABLE `bookmarks`
+  ADD COLUMN `user_id` int(10) unsigned NULL DEFAULT NULL AFTER `id`;
+UPDATE `bookmarks` SET `user_id` = (SELECT `id` FROM `users` WHERE `name` = 'admin');
+ALTER TABLE `bookmarks`
+  MODIFY COLUMN `user_id` int(10) unsigned NOT NULL,
+  ADD KEY `bookmarks_user_id` (`user_id`),
+  ADD CONSTRAINT `fk_bookmarks_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`);
@@ -0,0 +1,6 @@
+ALTER TABLE `bookmarks`
+  DROP KEY `bookmarks_user_id_host`,
+  DROP KEY `bookmarks_user_id_added_date`,
+  DROP COLUMN `provider_name`,
+  DROP COLUMN `link_type`,
+  DROP COLUMN `host`;
@@ -0,0 +1,13 @@
+-- bookmarks can be filtered by provider, type and site
+-- the provider and type of existing bookmarks are set when they are refreshed
+ALTER TABLE `bookmarks`
+  ADD COLUMN `provider_name` varchar(100) NOT NULL DEFAULT '',
+  ADD COLUMN `link_type` varchar(20) NOT NULL DEFAULT '',
+  ADD COLUMN `host` varchar(255) NOT NULL DEFAULT '',
+  ADD KEY `bookmarks_user_id_host` (`user_id`, `host`),
+  ADD KEY `bookmarks_user_id_added_date` (`user_id`, `added_date`);
+-- the host is lowercased and loses its www prefix, like in the application
+UPDATE `bookmarks` SET `host` = LOWER(
+  SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(`url`, '://', -1), '/', 1), '?', 1), '@', -1), ':', 1)
+);
+UPDATE `bookmarks` SET `host` = SUBSTRING(`host`, 5) WHERE `host` LIKE 'www.%';
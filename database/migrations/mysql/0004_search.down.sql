@@ -0,0 +1,3 @@
+ALTER TABLE `bookmarks`
+  DROP KEY `bookmarks_search`,
+  DROP COLUMN `keyword_names`;
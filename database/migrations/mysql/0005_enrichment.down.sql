@@ -0,0 +1,4 @@
+ALTER TABLE `bookmarks`
+  DROP KEY `bookmarks_enrichment_status`,
+  DROP COLUMN `enrichment_status`,
+  DROP COLUMN `enrichment_error`;
@@ -0,0 +1,5 @@
+-- oEmbed properties are fetched asynchronously. Existing bookmarks are complete
+ALTER TABLE `bookmarks`
+  ADD COLUMN `enrichment_status` varchar(20) NOT NULL DEFAULT 'done',
+  ADD COLUMN `enrichment_error` varchar(255) NOT NULL DEFAULT '',
+  ADD KEY `bookmarks_enrichment_status` (`enrichment_status`);
@@ -0,0 +1,4 @@
+ALTER TABLE `bookmarks`
+  DROP KEY `bookmarks_last_refreshed_at`,
+  DROP COLUMN `last_refreshed_at`,
+  DROP COLUMN `dead_link`;
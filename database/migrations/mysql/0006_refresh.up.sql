@@ -0,0 +1,5 @@
+-- oEmbed properties are refreshed periodically
+ALTER TABLE `bookmarks`
+  ADD COLUMN `last_refreshed_at` datetime NULL DEFAULT NULL,
+  ADD COLUMN `dead_link` tinyint(1) NOT NULL DEFAULT 0,
+  ADD KEY `bookmarks_last_refreshed_at` (`last_refreshed_at`);
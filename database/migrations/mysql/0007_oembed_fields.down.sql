@@ -0,0 +1,8 @@
+ALTER TABLE `bookmarks`
+  DROP COLUMN `provider_url`,
+  DROP COLUMN `author_url`,
+  DROP COLUMN `thumbnail_url`,
+  DROP COLUMN `thumbnail_width`,
+  DROP COLUMN `thumbnail_height`,
+  DROP COLUMN `html`,
+  DROP COLUMN `cache_age`;
@@ -0,0 +1,10 @@
+-- The rest of the oEmbed 1.0 properties
+-- TEXT columns cannot have a default value. Existing rows get an empty string
+ALTER TABLE `bookmarks`
+  ADD COLUMN `provider_url` varchar(2000) NOT NULL DEFAULT '',
+  ADD COLUMN `author_url` varchar(2000) NOT NULL DEFAULT '',
+  ADD COLUMN `thumbnail_url` varchar(2000) NOT NULL DEFAULT '',
+  ADD COLUMN `thumbnail_width` int(11) NOT NULL DEFAULT 0,
+  ADD COLUMN `thumbnail_height` int(11) NOT NULL DEFAULT 0,
+  ADD COLUMN `html` text NOT NULL,
+  ADD COLUMN `cache_age` int(11) NOT NULL DEFAULT 0;
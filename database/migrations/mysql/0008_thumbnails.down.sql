@@ -0,0 +1,2 @@
+ALTER TABLE `bookmarks`
+  DROP COLUMN `has_thumbnail`;
@@ -0,0 +1,3 @@
+-- thumbnails are downloaded and stored in a blob store
+ALTER TABLE `bookmarks`
+  ADD COLUMN `has_thumbnail` tinyint(1) NOT NULL DEFAULT 0;
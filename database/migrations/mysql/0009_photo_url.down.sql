@@ -0,0 +1,2 @@
+ALTER TABLE `bookmarks`
+  DROP COLUMN `photo_url`;
@@ -0,0 +1,3 @@
+-- the image of photo links, displayed by the bookmark page
+ALTER TABLE `bookmarks`
+  ADD COLUMN `photo_url` varchar(2000) NOT NULL DEFAULT '';
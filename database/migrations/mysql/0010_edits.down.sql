@@ -0,0 +1,4 @@
+ALTER TABLE `bookmarks`
+  DROP COLUMN `notes`,
+  DROP COLUMN `version`,
+  DROP COLUMN `updated_at`;
@@ -0,0 +1,7 @@
+-- bookmarks can be edited. The version is incremented by every edit
+-- so that concurrent edits do not overwrite each other
+-- TEXT columns cannot have a default value. Existing rows get an empty string
+ALTER TABLE `bookmarks`
+  ADD COLUMN `notes` text NOT NULL,
+  ADD COLUMN `version` int(11) NOT NULL DEFAULT 1,
+  ADD COLUMN `updated_at` datetime NULL DEFAULT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE `bookmarks`
+  DROP KEY `bookmarks_user_id_canonical_url`,
+  DROP COLUMN `canonical_url`;
@@ -0,0 +1,11 @@
+-- a user cannot bookmark the same page twice. NULL is for URLs that cannot be canonicalized
+ALTER TABLE `bookmarks`
+  ADD COLUMN `canonical_url` varchar(255) NULL DEFAULT NULL;
+-- existing duplicates keep a NULL canonical URL, the oldest bookmark wins
+-- the URLs are canonicalized when the bookmarks are refreshed
+UPDATE `bookmarks` SET `canonical_url` = `url`
+WHERE CHAR_LENGTH(`url`) <= 255 AND `id` IN (
+  SELECT `id` FROM (SELECT MIN(`id`) AS `id` FROM `bookmarks` GROUP BY `user_id`, `url`) AS `firsts`
+);
+ALTER TABLE `bookmarks`
+  ADD UNIQUE KEY `bookmarks_user_id_canonical_url` (`user_id`, `canonical_url`);
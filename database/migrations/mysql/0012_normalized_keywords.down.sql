@@ -0,0 +1,2 @@
+-- keywords stay normalized
+DROP TABLE `keyword_synonyms`;
@@ -0,0 +1,34 @@
+-- synonyms resolve the aliases of a user to keywords: js => javascript
+-- names are stored rather than IDs because orphan keywords are deleted
+CREATE TABLE `keyword_synonyms` (
+  `user_id` int(10) unsigned NOT NULL,
+  `alias` varchar(50) NOT NULL,
+  `keyword` varchar(50) NOT NULL,
+  PRIMARY KEY (`user_id`, `alias`),
+  KEY `keyword_synonyms_user_id_keyword` (`user_id`, `keyword`),
+  CONSTRAINT `fk_keyword_synonyms_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+-- keywords are normalized from now on. SQL can only trim and lowercase the existing ones,
+-- the other characters are normalized when the bookmarks are edited
+-- keywords with the same normalized name are merged into the oldest one
+UPDATE `bookmark_keywords` SET `keyword_id` = (
+  SELECT MIN(`k2`.`id`) FROM `keywords` `k1`
+  INNER JOIN `keywords` `k2` ON LOWER(TRIM(`k2`.`name`)) = LOWER(TRIM(`k1`.`name`))
+  WHERE `k1`.`id` = `bookmark_keywords`.`keyword_id`
+);
+-- bookmarks tagged with several of them keep one
+CREATE TABLE `bookmark_keywords_distinct` AS SELECT DISTINCT `bookmark_id`, `keyword_id` FROM `bookmark_keywords`;
+DELETE FROM `bookmark_keywords`;
+INSERT INTO `bookmark_keywords` (`bookmark_id`, `keyword_id`)
+SELECT `bookmark_id`, `keyword_id` FROM `bookmark_keywords_distinct`;
+DROP TABLE `bookmark_keywords_distinct`;
+-- empty keywords were saved by the web form
+DELETE FROM `bookmark_keywords` WHERE `keyword_id` IN (SELECT `id` FROM `keywords` WHERE TRIM(`name`) = '');
+DELETE FROM `keywords` WHERE `id` NOT IN (SELECT `keyword_id` FROM `bookmark_keywords`);
+UPDATE `keywords` SET `name` = LOWER(TRIM(`name`));
+UPDATE `bookmarks` SET `keyword_names` = COALESCE((
+  SELECT GROUP_CONCAT(`kw`.`name` SEPARATOR ' ')
+  FROM `bookmark_keywords` `bkw`
+  INNER JOIN `keywords` `kw` ON `kw`.`id` = `bkw`.`keyword_id`
+  WHERE `bkw`.`bookmark_id` = `bookmarks`.`id`
+), '');
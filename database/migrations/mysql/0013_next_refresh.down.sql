@@ -0,0 +1,3 @@
+ALTER TABLE `bookmarks`
+  DROP KEY `bookmarks_next_refresh_at`,
+  DROP COLUMN `next_refresh_at`;
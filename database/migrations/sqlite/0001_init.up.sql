@@ -0,0 +1,25 @@
+-- SQLite version of the MySQL schema
+-- Text columns used in filters are case insensitive, like in MySQL
+CREATE TABLE IF NOT EXISTS `bookmarks` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `url` varchar(255) NOT NULL,
+  `title` varchar(100) NOT NULL COLLATE NOCASE,
+  `author_name` varchar(100) NOT NULL COLLATE NOCASE,
+  `added_date` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `width` int(11) NOT NULL DEFAULT 0,
+  `height` int(11) NOT NULL DEFAULT 0,
+  `duration` int(11) NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS `keywords` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(50) NOT NULL UNIQUE COLLATE NOCASE
+);
+
+CREATE TABLE IF NOT EXISTS `bookmark_keywords` (
+  `bookmark_id` INTEGER NOT NULL REFERENCES `bookmarks` (`id`),
+  `keyword_id` INTEGER NOT NULL REFERENCES `keywords` (`id`)
+);
+
+CREATE INDEX IF NOT EXISTS `bookmark_keywords_bookmark_id` ON `bookmark_keywords` (`bookmark_id`);
+CREATE INDEX IF NOT EXISTS `bookmark_keywords_keyword_id` ON `bookmark_keywords` (`keyword_id`);
@@ -0,0 +1,3 @@
+DROP INDEX `bookmarks_user_id`;
+ALTER TABLE `bookmarks` DROP COLUMN `user_id`;
+DROP TABLE `users`;
@@ -0,0 +1,11 @@
+-- bookmarks belong to a user. Users are registered when the application starts
+CREATE TABLE `users` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(100) NOT NULL UNIQUE
+);
+-- existing bookmarks were shared by all the users. They are given to the admin user
+INSERT INTO `users` (`name`) SELECT 'admin' WHERE EXISTS (SELECT 1 FROM `bookmarks`);
+-- SQLite cannot add a NOT NULL column referencing another table. The owner is checked by the repository
+ALTER TABLE `bookmarks` ADD COLUMN `user_id` INTEGER NOT NULL DEFAULT 0;
+UPDATE `bookmarks` SET `user_id` = (SELECT `id` FROM `users` WHERE `name` = 'admin');
+CREATE INDEX `bookmarks_user_id` ON `bookmarks` (`user_id`);
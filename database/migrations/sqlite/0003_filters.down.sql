@@ -0,0 +1,5 @@
+DROP INDEX `bookmarks_user_id_host`;
+DROP INDEX `bookmarks_user_id_added_date`;
+ALTER TABLE `bookmarks` DROP COLUMN `provider_name`;
+ALTER TABLE `bookmarks` DROP COLUMN `link_type`;
+ALTER TABLE `bookmarks` DROP COLUMN `host`;
@@ -0,0 +1,8 @@
+-- bookmarks can be filtered by provider, type and site
+-- the provider and type of existing bookmarks are set when they are refreshed
+ALTER TABLE `bookmarks` ADD COLUMN `provider_name` varchar(100) NOT NULL DEFAULT '' COLLATE NOCASE;
+ALTER TABLE `bookmarks` ADD COLUMN `link_type` varchar(20) NOT NULL DEFAULT '' COLLATE NOCASE;
+ALTER TABLE `bookmarks` ADD COLUMN `host` varchar(255) NOT NULL DEFAULT '';
+CREATE INDEX `bookmarks_user_id_host` ON `bookmarks` (`user_id`, `host`);
+CREATE INDEX `bookmarks_user_id_added_date` ON `bookmarks` (`user_id`, `added_date`);
+-- SQLite has no function to parse URLs. It came with migrations so there are no bookmarks to update
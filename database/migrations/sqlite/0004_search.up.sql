@@ -0,0 +1,9 @@
+-- full-text search. The keywords are copied in the bookmark so that they can be searched
+-- SQLite searches with LIKE so there is no index
+ALTER TABLE `bookmarks` ADD COLUMN `keyword_names` varchar(2000) NOT NULL DEFAULT '';
+UPDATE `bookmarks` SET `keyword_names` = COALESCE((
+  SELECT GROUP_CONCAT(`kw`.`name`, ' ')
+  FROM `bookmark_keywords` `bkw`
+  INNER JOIN `keywords` `kw` ON `kw`.`id` = `bkw`.`keyword_id`
+  WHERE `bkw`.`bookmark_id` = `bookmarks`.`id`
+), '');
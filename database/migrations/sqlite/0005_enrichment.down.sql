@@ -0,0 +1,3 @@
+DROP INDEX `bookmarks_enrichment_status`;
+ALTER TABLE `bookmarks` DROP COLUMN `enrichment_status`;
+ALTER TABLE `bookmarks` DROP COLUMN `enrichment_error`;
@@ -0,0 +1,4 @@
+-- oEmbed properties are fetched asynchronously. Existing bookmarks are complete
+ALTER TABLE `bookmarks` ADD COLUMN `enrichment_status` varchar(20) NOT NULL DEFAULT 'done';
+ALTER TABLE `bookmarks` ADD COLUMN `enrichment_error` varchar(255) NOT NULL DEFAULT '';
+CREATE INDEX `bookmarks_enrichment_status` ON `bookmarks` (`enrichment_status`);
@@ -0,0 +1,3 @@
+DROP INDEX `bookmarks_last_refreshed_at`;
+ALTER TABLE `bookmarks` DROP COLUMN `last_refreshed_at`;
+ALTER TABLE `bookmarks` DROP COLUMN `dead_link`;
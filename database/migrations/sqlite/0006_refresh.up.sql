@@ -0,0 +1,4 @@
+-- oEmbed properties are refreshed periodically
+ALTER TABLE `bookmarks` ADD COLUMN `last_refreshed_at` datetime NULL DEFAULT NULL;
+ALTER TABLE `bookmarks` ADD COLUMN `dead_link` tinyint(1) NOT NULL DEFAULT 0;
+CREATE INDEX `bookmarks_last_refreshed_at` ON `bookmarks` (`last_refreshed_at`);
@@ -0,0 +1,7 @@
+ALTER TABLE `bookmarks` DROP COLUMN `provider_url`;
+ALTER TABLE `bookmarks` DROP COLUMN `author_url`;
+ALTER TABLE `bookmarks` DROP COLUMN `thumbnail_url`;
+ALTER TABLE `bookmarks` DROP COLUMN `thumbnail_width`;
+ALTER TABLE `bookmarks` DROP COLUMN `thumbnail_height`;
+ALTER TABLE `bookmarks` DROP COLUMN `html`;
+ALTER TABLE `bookmarks` DROP COLUMN `cache_age`;
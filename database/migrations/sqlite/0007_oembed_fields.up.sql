@@ -0,0 +1,8 @@
+-- The rest of the oEmbed 1.0 properties
+ALTER TABLE `bookmarks` ADD COLUMN `provider_url` varchar(2000) NOT NULL DEFAULT '';
+ALTER TABLE `bookmarks` ADD COLUMN `author_url` varchar(2000) NOT NULL DEFAULT '';
+ALTER TABLE `bookmarks` ADD COLUMN `thumbnail_url` varchar(2000) NOT NULL DEFAULT '';
+ALTER TABLE `bookmarks` ADD COLUMN `thumbnail_width` int NOT NULL DEFAULT 0;
+ALTER TABLE `bookmarks` ADD COLUMN `thumbnail_height` int NOT NULL DEFAULT 0;
+ALTER TABLE `bookmarks` ADD COLUMN `html` text NOT NULL DEFAULT '';
+ALTER TABLE `bookmarks` ADD COLUMN `cache_age` int NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE `bookmarks` DROP COLUMN `notes`;
+ALTER TABLE `bookmarks` DROP COLUMN `version`;
+ALTER TABLE `bookmarks` DROP COLUMN `updated_at`;
@@ -0,0 +1,5 @@
+-- bookmarks can be edited. The version is incremented by every edit
+-- so that concurrent edits do not overwrite each other
+ALTER TABLE `bookmarks` ADD COLUMN `notes` text NOT NULL DEFAULT '';
+ALTER TABLE `bookmarks` ADD COLUMN `version` int NOT NULL DEFAULT 1;
+ALTER TABLE `bookmarks` ADD COLUMN `updated_at` datetime NULL DEFAULT NULL;
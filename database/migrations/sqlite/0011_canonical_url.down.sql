@@ -0,0 +1,2 @@
+DROP INDEX `bookmarks_user_id_canonical_url`;
+ALTER TABLE `bookmarks` DROP COLUMN `canonical_url`;
@@ -0,0 +1,7 @@
+-- a user cannot bookmark the same page twice. NULL is for URLs that cannot be canonicalized
+ALTER TABLE `bookmarks` ADD COLUMN `canonical_url` varchar(255) NULL DEFAULT NULL;
+-- existing duplicates keep a NULL canonical URL, the oldest bookmark wins
+-- the URLs are canonicalized when the bookmarks are refreshed
+UPDATE `bookmarks` SET `canonical_url` = `url`
+WHERE LENGTH(`url`) <= 255 AND `id` IN (SELECT MIN(`id`) FROM `bookmarks` GROUP BY `user_id`, `url`);
+CREATE UNIQUE INDEX `bookmarks_user_id_canonical_url` ON `bookmarks` (`user_id`, `canonical_url`);
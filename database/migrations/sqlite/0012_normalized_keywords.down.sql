@@ -0,0 +1,3 @@
+-- keywords stay normalized
+DROP INDEX `keyword_synonyms_user_id_keyword`;
+DROP TABLE `keyword_synonyms`;
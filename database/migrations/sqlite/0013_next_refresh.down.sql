@@ -0,0 +1,2 @@
+DROP INDEX `bookmarks_next_refresh_at`;
+ALTER TABLE `bookmarks` DROP COLUMN `next_refresh_at`;
@@ -0,0 +1,4 @@
+-- bookmarks whose refresh failed are tried again at next_refresh_at instead of waiting
+-- for their properties to get stale. last_refreshed_at stays the date of the last success
+ALTER TABLE `bookmarks` ADD COLUMN `next_refresh_at` datetime NULL DEFAULT NULL;
+CREATE INDEX `bookmarks_next_refresh_at` ON `bookmarks` (`next_refresh_at`);
@@ -0,0 +1,150 @@
+//go:build sqlite
+
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run with: go test -tags sqlite ./database/
+// (requires cgo)
+func TestMigrateSQLite(t *testing.T) {
+	assert := assert.New(t)
+
+	db := sqlx.MustConnect("sqlite3", "file::memory:?_foreign_keys=1")
+	db.SetMaxOpenConns(1)
+
+	migrator, err := NewMigrator(db, DriverSQLite)
+	if !assert.Nil(err) {
+		return
+	}
+
+	applied, err := migrator.Up()
+	assert.Nil(err)
+	assert.Equal(len(migrator.migrations), len(applied))
+
+	// nothing left to do
+	applied, err = migrator.Up()
+	assert.Nil(err)
+	assert.Empty(applied)
+
+	statuses, err := migrator.Status()
+	assert.Nil(err)
+	for _, status := range statuses {
+		assert.NotNil(status.AppliedAt)
+	}
+
+	// revert everything
+	for i := len(migrator.migrations) - 1; i >= 0; i-- {
+		reverted, err := migrator.Down()
+		assert.Nil(err)
+		if assert.NotNil(reverted) {
+			assert.Equal(migrator.migrations[i].Version, reverted.Version)
+		}
+	}
+
+	reverted, err := migrator.Down()
+	assert.Nil(err)
+	assert.Nil(reverted)
+
+	// and apply again
+	applied, err = migrator.Up()
+	assert.Nil(err)
+	assert.Equal(len(migrator.migrations), len(applied))
+}
+
+func TestMigrateAdoptsBaselineSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	db := sqlx.MustConnect("sqlite3", "file::memory:?_foreign_keys=1")
+	db.SetMaxOpenConns(1)
+
+	// a database provisioned before migrations existed, with the tables of the first one
+	migrator, err := NewMigrator(db, DriverSQLite)
+	if !assert.Nil(err) {
+		return
+	}
+	for _, statement := range splitStatements(migrator.migrations[0].Up) {
+		db.MustExec(statement)
+	}
+	db.MustExec(`INSERT INTO bookmarks (id, url, title, author_name) VALUES (1, 'https://vimeo.com/1', 'a', 'a')`)
+	db.MustExec(`INSERT INTO keywords (id, name) VALUES (1, 'music'), (2, 'live')`)
+	db.MustExec(`INSERT INTO bookmark_keywords (bookmark_id, keyword_id) VALUES (1, 1), (1, 2)`)
+
+	applied, err := migrator.Up()
+	assert.Nil(err)
+	assert.Equal(len(migrator.migrations), len(applied))
+
+	// the existing bookmarks are given to the admin user
+	var owner string
+	assert.Nil(db.Get(&owner, `SELECT u.name FROM bookmarks b INNER JOIN users u ON u.id = b.user_id WHERE b.id = 1`))
+	assert.Equal("admin", owner)
+
+	var names string
+	assert.Nil(db.Get(&names, `SELECT keyword_names FROM bookmarks WHERE id = 1`))
+	assert.ElementsMatch([]string{"music", "live"}, strings.Fields(names))
+
+	// no admin user without bookmarks to give
+	db = sqlx.MustConnect("sqlite3", "file::memory:?_foreign_keys=1")
+	db.SetMaxOpenConns(1)
+	migrator, _ = NewMigrator(db, DriverSQLite)
+	_, err = migrator.Up()
+	assert.Nil(err)
+
+	var count int
+	assert.Nil(db.Get(&count, `SELECT COUNT(*) FROM users`))
+	assert.Equal(0, count)
+}
+
+func TestMigrateNormalizedKeywords(t *testing.T) {
+	assert := assert.New(t)
+
+	db := sqlx.MustConnect("sqlite3", "file::memory:?_foreign_keys=1")
+	db.SetMaxOpenConns(1)
+
+	migrator, err := NewMigrator(db, DriverSQLite)
+	if !assert.Nil(err) {
+		return
+	}
+
+	// keywords saved before they were normalized
+	_, err = migrator.Up()
+	assert.Nil(err)
+	for {
+		migration, err := migrator.Down()
+		if !assert.Nil(err) || migration.Version == 12 {
+			break
+		}
+	}
+
+	db.MustExec(`INSERT INTO users (id, name) VALUES (1, 'john')`)
+	db.MustExec(`INSERT INTO bookmarks (id, user_id, url, title, author_name, keyword_names) VALUES
+(1, 1, 'https://vimeo.com/1', 'a', 'a', 'Design  design'),
+(2, 1, 'https://vimeo.com/2', 'b', 'b', 'Go')`)
+	db.MustExec(`INSERT INTO keywords (id, name) VALUES (1, 'Design'), (2, ' design'), (3, ''), (4, 'Go'), (5, 'orphan')`)
+	db.MustExec(`INSERT INTO bookmark_keywords (bookmark_id, keyword_id) VALUES (1, 1), (1, 2), (1, 3), (2, 2), (2, 4)`)
+
+	_, err = migrator.Up()
+	assert.Nil(err)
+
+	var keywords []string
+	assert.Nil(db.Select(&keywords, `SELECT name FROM keywords ORDER BY id`))
+	assert.Equal([]string{"design", "go"}, keywords)
+
+	var associations []string
+	assert.Nil(db.Select(&associations, `
+SELECT bkw.bookmark_id || ':' || kw.name FROM bookmark_keywords bkw
+INNER JOIN keywords kw ON kw.id = bkw.keyword_id
+ORDER BY bkw.bookmark_id, kw.name`))
+	assert.Equal([]string{"1:design", "2:design", "2:go"}, associations)
+
+	var names []string
+	assert.Nil(db.Select(&names, `SELECT keyword_names FROM bookmarks ORDER BY id`))
+	assert.Equal("design", names[0])
+	assert.ElementsMatch([]string{"design", "go"}, strings.Fields(names[1]))
+}
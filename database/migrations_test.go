@@ -0,0 +1,51 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	mysql, err := loadMigrations(DriverMySQL)
+	assert.Nil(err)
+
+	sqlite, err := loadMigrations(DriverSQLite)
+	assert.Nil(err)
+
+	// every driver must have the same migrations
+	if assert.Equal(len(mysql), len(sqlite)) {
+		for i := range mysql {
+			assert.Equal(i+1, mysql[i].Version)
+			assert.Equal(mysql[i].Version, sqlite[i].Version)
+			assert.Equal(mysql[i].Name, sqlite[i].Name)
+		}
+	}
+
+	_, err = loadMigrations("oracle")
+	assert.NotNil(err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	assert := assert.New(t)
+
+	script := `
+-- a comment
+CREATE TABLE foo (
+  id int NOT NULL
+);
+
+-- another comment
+INSERT INTO foo VALUES (1);
+INSERT INTO foo VALUES (2);
+UPDATE foo SET id = 3`
+
+	assert.Equal([]string{
+		"-- a comment\nCREATE TABLE foo (\n  id int NOT NULL\n);",
+		"-- another comment\nINSERT INTO foo VALUES (1);",
+		"INSERT INTO foo VALUES (2);",
+		"UPDATE foo SET id = 3",
+	}, splitStatements(script))
+}
@@ -0,0 +1,277 @@
+// Package enrichment fetches oEmbed properties of bookmarks in the background
+// so that creating a bookmark does not depend on the availability of providers
+package enrichment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/thumbnails"
+	log "github.com/sirupsen/logrus"
+)
+
+// Queue enriches bookmarks asynchronously
+type Queue interface {
+	// Enqueue schedules the enrichment of a pending bookmark. It never blocks
+	// Returns false if the queue is full. The bookmark is still picked up by the next sweep
+	Enqueue(b *bookmarks.Bookmark) bool
+	// Start starts the workers and the periodic sweep of pending bookmarks
+	Start()
+	// Stop waits for the running jobs to finish or for the context to be done
+	// Running fetches are cancelled when the context is done
+	// Scheduled retries are abandoned. Bookmarks stay pending until the next start
+	Stop(ctx context.Context) error
+}
+
+// Options configures the queue
+type Options struct {
+	// Workers is the number of concurrent fetches
+	Workers int
+	// QueueSize is the number of bookmarks waiting for a worker
+	QueueSize int
+	// MaxAttempts is the number of fetches before giving up on a bookmark
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles at each attempt
+	Backoff time.Duration
+	// SweepInterval is how often pending bookmarks are loaded from the repository
+	// It catches bookmarks created while the queue was full or the app was down
+	SweepInterval time.Duration
+}
+
+// DefaultOptions are sensible options for production
+var DefaultOptions = Options{
+	Workers:       4,
+	QueueSize:     1000,
+	MaxAttempts:   5,
+	Backoff:       2 * time.Second,
+	SweepInterval: time.Minute,
+}
+
+type job struct {
+	bookmark *bookmarks.Bookmark
+	attempt  int
+}
+
+type queue struct {
+	repo    bookmarks.Repository
+	fetcher oembed.Fetcher
+	thumbs  thumbnails.Store
+	logger  log.FieldLogger
+	opts    Options
+
+	jobs     chan job
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	// ctx is the context of the fetches. It is cancelled when stopping takes too long
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// bookmarks queued, being fetched or waiting for a retry
+	inflight map[int]bool
+	retries  map[int]*time.Timer
+}
+
+// NewQueue returns a queue backed by a pool of workers
+// Thumbnails of enriched bookmarks are captured by the same workers
+func NewQueue(repo bookmarks.Repository, fetcher oembed.Fetcher, thumbs thumbnails.Store, logger log.FieldLogger, opts Options) Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &queue{
+		repo:     repo,
+		fetcher:  fetcher,
+		thumbs:   thumbs,
+		logger:   logger,
+		opts:     opts,
+		jobs:     make(chan job, opts.QueueSize),
+		quit:     make(chan struct{}),
+		inflight: map[int]bool{},
+		retries:  map[int]*time.Timer{},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Enqueue implements the Queue interface
+func (q *queue) Enqueue(b *bookmarks.Bookmark) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.inflight[b.ID] {
+		return true
+	}
+
+	// workers modify the bookmark
+	c := *b
+	if !q.push(job{bookmark: &c, attempt: 1}) {
+		return false
+	}
+	q.inflight[b.ID] = true
+	return true
+}
+
+// push adds a job to the channel without blocking. Must be called with the lock held
+func (q *queue) push(j job) bool {
+	select {
+	case <-q.quit:
+		return false
+	default:
+	}
+
+	select {
+	case q.jobs <- j:
+		return true
+	default:
+		q.logger.WithField("bookmark_id", j.bookmark.ID).Warning("enrichment queue is full")
+		return false
+	}
+}
+
+// Start implements the Queue interface
+func (q *queue) Start() {
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	q.wg.Add(1)
+	go q.sweepPeriodically()
+}
+
+// Stop implements the Queue interface
+func (q *queue) Stop(ctx context.Context) error {
+	q.stopOnce.Do(func() {
+		q.mu.Lock()
+		close(q.quit)
+		for _, timer := range q.retries {
+			timer.Stop()
+		}
+		q.mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+func (q *queue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.quit:
+			return
+		case j := <-q.jobs:
+			q.process(j)
+		}
+	}
+}
+
+func (q *queue) sweepPeriodically() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.opts.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		q.sweep()
+		select {
+		case <-q.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep enqueues the pending bookmarks that are not already in the queue
+func (q *queue) sweep() {
+	pending, err := q.repo.PendingEnrichments(q.opts.QueueSize)
+	if err != nil {
+		q.logger.WithError(err).Error("could not load pending enrichments")
+		return
+	}
+
+	for _, b := range pending {
+		if !q.Enqueue(b) {
+			return
+		}
+	}
+}
+
+func (q *queue) process(j job) {
+	b := j.bookmark
+	logger := q.logger.WithField("bookmark_id", b.ID).WithField("url", b.URL).WithField("attempt", j.attempt)
+
+	link, err := q.fetcher.Fetch(q.ctx, b.URL)
+	switch {
+	case err != nil && q.ctx.Err() != nil:
+		// the queue is stopping. The bookmark stays pending until the next start
+		logger.Info("enrichment cancelled")
+		q.release(b.ID)
+		return
+	case err == nil:
+		now := time.Now()
+		b = bookmarks.FromOembed(b, link)
+		b.EnrichmentStatus = bookmarks.EnrichmentDone
+		b.EnrichmentError = ""
+		b.LastRefreshedAt = &now
+		updateThumbnail(q.ctx, q.thumbs, b, logger)
+	case !oembed.IsRetryable(err) || j.attempt >= q.opts.MaxAttempts:
+		logger.WithError(err).Warning("enrichment failed")
+		b.EnrichmentStatus = bookmarks.EnrichmentFailed
+		b.EnrichmentError = err.Error()
+	default:
+		logger.WithError(err).Info("enrichment will be retried")
+		q.retry(j, err)
+		return
+	}
+
+	if err := q.repo.SaveEnrichment(b); err != nil {
+		// the bookmark is still pending so the sweep will try again
+		logger.WithError(err).Error("could not save enrichment")
+	}
+	q.release(b.ID)
+}
+
+// retry schedules the next attempt with an exponential backoff
+// Rate limited providers are not called again before they allow it
+func (q *queue) retry(j job, err error) {
+	delay := q.opts.Backoff << uint(j.attempt-1)
+	if rateLimit, ok := err.(*oembed.RateLimitError); ok && rateLimit.RetryAfter > delay {
+		delay = rateLimit.RetryAfter
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := j.bookmark.ID
+	q.retries[id] = time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		delete(q.retries, id)
+		if !q.push(job{bookmark: j.bookmark, attempt: j.attempt + 1}) {
+			// the sweep will try again
+			delete(q.inflight, id)
+		}
+	})
+}
+
+func (q *queue) release(id int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+}
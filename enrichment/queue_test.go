@@ -0,0 +1,269 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/blobs"
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/thumbnails"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFetcher fails a number of times per URL before succeeding
+// URLs that are not found or have an error always fail
+type fakeFetcher struct {
+	mu         sync.Mutex
+	failures   map[string]int
+	notFound   map[string]bool
+	errs       map[string]error
+	thumbnails map[string]string
+	calls      map[string]int
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, rawURL string) (*oembed.Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[rawURL]++
+	if f.notFound[rawURL] {
+		return nil, &oembed.NotFoundError{}
+	}
+	if err := f.errs[rawURL]; err != nil {
+		return nil, err
+	}
+	if f.calls[rawURL] <= f.failures[rawURL] {
+		return nil, errors.New("provider returned a 503 status code")
+	}
+
+	return &oembed.Link{
+		Title:      "Title of " + rawURL,
+		AuthorName: "John Doe",
+		Provider:   oembed.ProviderVimeo,
+		Type:       oembed.LinkTypeVideo,
+		Width:      640,
+		Height:     360,
+		// a nil map is fine
+		ThumbnailURL: f.thumbnails[rawURL],
+	}, nil
+}
+
+func (f *fakeFetcher) callsTo(rawURL string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[rawURL]
+}
+
+func testQueue(failures map[string]int) (bookmarks.Repository, *fakeFetcher, Queue) {
+	repo := bookmarks.NewMemoryRepository()
+	fetcher := &fakeFetcher{failures: failures, notFound: map[string]bool{}, calls: map[string]int{}}
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	q := NewQueue(repo, fetcher, testThumbnails(), logger, Options{
+		Workers:       2,
+		QueueSize:     10,
+		MaxAttempts:   3,
+		Backoff:       time.Millisecond,
+		SweepInterval: 10 * time.Millisecond,
+	})
+	return repo, fetcher, q
+}
+
+func testThumbnails() thumbnails.Store {
+	// thumbnails are served by an httptest.Server, on the loopback interface
+	opts := thumbnails.DefaultOptions
+	opts.Client = http.DefaultClient
+	return thumbnails.NewStore(blobs.NewMemoryStore(), opts)
+}
+
+func insertPending(t *testing.T, repo bookmarks.Repository, url string) *bookmarks.Bookmark {
+	return insert(t, repo, &bookmarks.Bookmark{
+		UserID:           1,
+		URL:              url,
+		Keywords:         []bookmarks.Keyword{},
+		EnrichmentStatus: bookmarks.EnrichmentPending,
+	})
+}
+
+func insert(t *testing.T, repo bookmarks.Repository, b *bookmarks.Bookmark) *bookmarks.Bookmark {
+	b, err := repo.Insert(b)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return b
+}
+
+// waitForStatus polls the repository until the bookmark reaches the status
+func waitForStatus(t *testing.T, repo bookmarks.Repository, id int, status bookmarks.EnrichmentStatus) *bookmarks.Bookmark {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b, err := repo.ByID(1, id)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		if b.EnrichmentStatus == status {
+			return b
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bookmark %d is %s, expected %s", id, b.EnrichmentStatus, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueueEnrichesBookmarks(t *testing.T) {
+	repo, fetcher, q := testQueue(map[string]int{"https://vimeo.com/2": 2})
+	q.Start()
+	defer q.Stop(context.Background())
+
+	first := insertPending(t, repo, "https://vimeo.com/1")
+	second := insertPending(t, repo, "https://vimeo.com/2")
+	assert.True(t, q.Enqueue(first))
+	assert.True(t, q.Enqueue(second))
+
+	b := waitForStatus(t, repo, first.ID, bookmarks.EnrichmentDone)
+	assert.Equal(t, "Title of https://vimeo.com/1", b.Title)
+	assert.Equal(t, "John Doe", b.AuthorName)
+	assert.Equal(t, 640, b.Width)
+	assert.Equal(t, oembed.ProviderVimeo, b.Provider)
+	assert.NotNil(t, b.LastRefreshedAt)
+
+	// transient errors are retried
+	b = waitForStatus(t, repo, second.ID, bookmarks.EnrichmentDone)
+	assert.Equal(t, "Title of https://vimeo.com/2", b.Title)
+	assert.Equal(t, 3, fetcher.callsTo("https://vimeo.com/2"))
+}
+
+func TestQueueCapturesThumbnails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/thumbnail.png" {
+			http.NotFound(w, r)
+			return
+		}
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 640, 360)))
+	}))
+	defer server.Close()
+
+	repo, fetcher, q := testQueue(map[string]int{})
+	fetcher.thumbnails = map[string]string{
+		"https://vimeo.com/1": server.URL + "/thumbnail.png",
+		"https://vimeo.com/2": server.URL + "/missing.png",
+	}
+	q.Start()
+	defer q.Stop(context.Background())
+
+	first := insertPending(t, repo, "https://vimeo.com/1")
+	second := insertPending(t, repo, "https://vimeo.com/2")
+	q.Enqueue(first)
+	q.Enqueue(second)
+
+	b := waitForStatus(t, repo, first.ID, bookmarks.EnrichmentDone)
+	assert.True(t, b.HasThumbnail)
+
+	// a broken thumbnail does not make the enrichment fail
+	b = waitForStatus(t, repo, second.ID, bookmarks.EnrichmentDone)
+	assert.False(t, b.HasThumbnail)
+	assert.Equal(t, server.URL+"/missing.png", b.ThumbnailURL)
+}
+
+func TestQueueGivesUp(t *testing.T) {
+	repo, fetcher, q := testQueue(map[string]int{"https://vimeo.com/1": 10})
+	q.Start()
+	defer q.Stop(context.Background())
+
+	b := insertPending(t, repo, "https://vimeo.com/1")
+	q.Enqueue(b)
+
+	b = waitForStatus(t, repo, b.ID, bookmarks.EnrichmentFailed)
+	assert.Equal(t, "provider returned a 503 status code", b.EnrichmentError)
+	assert.Equal(t, "", b.Title)
+	assert.Equal(t, 3, fetcher.callsTo("https://vimeo.com/1"))
+}
+
+func TestQueueDoesNotRetryPermanentErrors(t *testing.T) {
+	repo, fetcher, q := testQueue(map[string]int{})
+	fetcher.errs = map[string]error{"https://vimeo.com/1": &oembed.UnauthorizedError{StatusCode: 403}}
+	q.Start()
+	defer q.Stop(context.Background())
+
+	b := insertPending(t, repo, "https://vimeo.com/1")
+	q.Enqueue(b)
+
+	b = waitForStatus(t, repo, b.ID, bookmarks.EnrichmentFailed)
+	assert.Contains(t, b.EnrichmentError, "private")
+	assert.Equal(t, 1, fetcher.callsTo("https://vimeo.com/1"))
+}
+
+func TestQueueSweepsPendingBookmarks(t *testing.T) {
+	repo, _, q := testQueue(map[string]int{})
+
+	// created before the queue starts, like after a restart
+	b := insertPending(t, repo, "https://vimeo.com/1")
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	waitForStatus(t, repo, b.ID, bookmarks.EnrichmentDone)
+}
+
+func TestQueueStop(t *testing.T) {
+	_, _, q := testQueue(map[string]int{})
+	q.Start()
+
+	assert.NoError(t, q.Stop(context.Background()))
+	// stopping twice is harmless
+	assert.NoError(t, q.Stop(context.Background()))
+	assert.False(t, q.Enqueue(&bookmarks.Bookmark{ID: 1}))
+}
+
+// blockingFetcher blocks until the context is done
+type blockingFetcher struct {
+	started chan struct{}
+}
+
+func (f *blockingFetcher) Fetch(ctx context.Context, rawURL string) (*oembed.Link, error) {
+	close(f.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestQueueStopCancelsFetches(t *testing.T) {
+	repo := bookmarks.NewMemoryRepository()
+	fetcher := &blockingFetcher{started: make(chan struct{})}
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	q := NewQueue(repo, fetcher, testThumbnails(), logger, Options{
+		Workers:       1,
+		QueueSize:     10,
+		MaxAttempts:   3,
+		Backoff:       time.Millisecond,
+		SweepInterval: time.Hour,
+	})
+	q.Start()
+
+	b := insertPending(t, repo, "https://vimeo.com/1")
+	q.Enqueue(b)
+	<-fetcher.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.Stop(ctx))
+
+	// the worker gives up right away and the bookmark stays pending
+	assert.NoError(t, q.Stop(context.Background()))
+	b, _ = repo.ByID(1, b.ID)
+	assert.Equal(t, bookmarks.EnrichmentPending, b.EnrichmentStatus)
+}
@@ -0,0 +1,207 @@
+package enrichment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	"github.com/fchoquet/bookmarks/thumbnails"
+	log "github.com/sirupsen/logrus"
+)
+
+// Refresher keeps the oEmbed properties of bookmarks up to date
+// Providers might change the title of a link or remove it
+type Refresher interface {
+	// Refresh fetches the oEmbed properties of a bookmark and saves them
+	// Links unknown to the provider are flagged as dead. Other errors are saved with the
+	// bookmark and returned: bookmarks failing with a transient error are refreshed again
+	// after RetryDelay, the others after MaxAge. The fetch is abandoned, and the bookmark
+	// left untouched, when the context is done
+	Refresh(ctx context.Context, b *bookmarks.Bookmark) (*bookmarks.Bookmark, error)
+	// Start starts refreshing stale bookmarks periodically
+	Start()
+	// Stop waits for the current batch to stop or for the context to be done
+	// The running fetch is cancelled when the context is done
+	Stop(ctx context.Context) error
+}
+
+// RefreshOptions configures the refresher
+type RefreshOptions struct {
+	// MaxAge is how long oEmbed properties are considered fresh
+	MaxAge time.Duration
+	// Interval is how often stale bookmarks are looked for
+	Interval time.Duration
+	// BatchSize is the maximum number of bookmarks refreshed per interval
+	// It limits the load on providers
+	BatchSize int
+	// RetryDelay is how long bookmarks failing with a transient error wait before being
+	// refreshed again
+	RetryDelay time.Duration
+}
+
+// DefaultRefreshOptions are sensible options for production
+var DefaultRefreshOptions = RefreshOptions{
+	MaxAge:     7 * 24 * time.Hour,
+	Interval:   time.Hour,
+	BatchSize:  100,
+	RetryDelay: 24 * time.Hour,
+}
+
+type refresher struct {
+	repo    bookmarks.Repository
+	fetcher oembed.Fetcher
+	thumbs  thumbnails.Store
+	logger  log.FieldLogger
+	opts    RefreshOptions
+
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	// ctx is the context of the periodic refreshes. It is cancelled when stopping takes too long
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRefresher returns a refresher
+// Thumbnails are captured again when their URL changes
+func NewRefresher(repo bookmarks.Repository, fetcher oembed.Fetcher, thumbs thumbnails.Store, logger log.FieldLogger, opts RefreshOptions) Refresher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &refresher{
+		repo:    repo,
+		fetcher: fetcher,
+		thumbs:  thumbs,
+		logger:  logger,
+		opts:    opts,
+		quit:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Refresh implements the Refresher interface
+func (r *refresher) Refresh(ctx context.Context, b *bookmarks.Bookmark) (*bookmarks.Bookmark, error) {
+	// we modify the bookmark
+	c := *b
+	b = &c
+
+	link, err := r.fetcher.Fetch(ctx, b.URL)
+	// how long a failing bookmark waits before being tried again. 0 if the refresh succeeded
+	var retryIn time.Duration
+	switch {
+	case err == nil:
+		previousThumbnail := b.ThumbnailURL
+		b = bookmarks.RefreshFromOembed(b, link)
+		b.DeadLink = false
+		b.EnrichmentStatus = bookmarks.EnrichmentDone
+		b.EnrichmentError = ""
+		if b.ThumbnailURL != previousThumbnail || !b.HasThumbnail {
+			updateThumbnail(ctx, r.thumbs, b, r.logger.WithField("bookmark_id", b.ID))
+		}
+	case ctx.Err() != nil:
+		return nil, err
+	case oembed.IsRetryable(err):
+		b.EnrichmentError = err.Error()
+		retryIn = r.opts.RetryDelay
+	default:
+		switch err.(type) {
+		case *oembed.NotFoundError:
+			b.DeadLink = true
+			err = nil
+		case *oembed.UnknownProviderError:
+			// nothing to refresh. The properties are kept
+			err = nil
+		default:
+			// the provider will most likely answer the same until the properties get stale
+			b.EnrichmentError = err.Error()
+			retryIn = r.opts.MaxAge
+		}
+	}
+
+	now := time.Now()
+	if err == nil {
+		b.LastRefreshedAt = &now
+		b.NextRefreshAt = nil
+	} else {
+		// scheduling the next try keeps failing bookmarks out of the next batches
+		next := now.Add(retryIn)
+		b.NextRefreshAt = &next
+	}
+
+	if err := r.repo.SaveEnrichment(b); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Start implements the Refresher interface
+func (r *refresher) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			r.refreshStale()
+			select {
+			case <-r.quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop implements the Refresher interface
+func (r *refresher) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		return ctx.Err()
+	}
+}
+
+// refreshStale refreshes a batch of stale bookmarks, one at a time to be gentle with providers
+// Failing bookmarks are saved with their error, so that they do not fill the next batches
+func (r *refresher) refreshStale() {
+	now := time.Now()
+	stale, err := r.repo.StaleBookmarks(now.Add(-r.opts.MaxAge), now, r.opts.BatchSize)
+	if err != nil {
+		r.logger.WithError(err).Error("could not load stale bookmarks")
+		return
+	}
+
+	for _, b := range stale {
+		select {
+		case <-r.quit:
+			return
+		default:
+		}
+
+		refreshed, err := r.Refresh(r.ctx, b)
+		logger := r.logger.WithField("bookmark_id", b.ID).WithField("url", b.URL)
+		switch {
+		case err != nil:
+			logger.WithError(err).Warning("refresh failed")
+		case refreshed.DeadLink && !b.DeadLink:
+			logger.Info("dead link detected")
+		}
+	}
+}
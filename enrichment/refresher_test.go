@@ -0,0 +1,175 @@
+package enrichment
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/oembed"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRefresher(fetcher *fakeFetcher) (bookmarks.Repository, Refresher) {
+	repo := bookmarks.NewMemoryRepository()
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	r := NewRefresher(repo, fetcher, testThumbnails(), logger, RefreshOptions{
+		MaxAge:     24 * time.Hour,
+		Interval:   10 * time.Millisecond,
+		BatchSize:  10,
+		RetryDelay: time.Hour,
+	})
+	return repo, r
+}
+
+func oldBookmark(url string) *bookmarks.Bookmark {
+	added := time.Now().Add(-48 * time.Hour)
+	return &bookmarks.Bookmark{
+		UserID:     1,
+		URL:        url,
+		Title:      "Old title",
+		AuthorName: "Old author",
+		AddedDate:  &added,
+		Keywords:   []bookmarks.Keyword{},
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	fetcher := &fakeFetcher{
+		failures: map[string]int{"https://vimeo.com/2": 1},
+		notFound: map[string]bool{"https://vimeo.com/3": true},
+		errs:     map[string]error{"https://example.com/4": &oembed.UnknownProviderError{URL: "https://example.com/4"}},
+		calls:    map[string]int{},
+	}
+	repo, r := testRefresher(fetcher)
+
+	b := insert(t, repo, oldBookmark("https://vimeo.com/1"))
+	b, err := r.Refresh(context.Background(), b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Title of https://vimeo.com/1", b.Title)
+
+	loaded, _ := repo.ByID(1, b.ID)
+	assert.Equal(t, "Title of https://vimeo.com/1", loaded.Title)
+	assert.Equal(t, "John Doe", loaded.AuthorName)
+	assert.False(t, loaded.DeadLink)
+	assert.NotNil(t, loaded.LastRefreshedAt)
+	assert.Nil(t, loaded.NextRefreshAt)
+
+	// transient errors keep the properties. The bookmark is refreshed again after RetryDelay
+	b = insert(t, repo, oldBookmark("https://vimeo.com/2"))
+	_, err = r.Refresh(context.Background(), b)
+	assert.Error(t, err)
+	loaded, _ = repo.ByID(1, b.ID)
+	assert.Equal(t, "Old title", loaded.Title)
+	assert.Equal(t, err.Error(), loaded.EnrichmentError)
+	assert.Nil(t, loaded.LastRefreshedAt)
+	if assert.NotNil(t, loaded.NextRefreshAt) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *loaded.NextRefreshAt, time.Minute)
+	}
+
+	b = insert(t, repo, oldBookmark("https://vimeo.com/3"))
+	b, err = r.Refresh(context.Background(), b)
+	assert.NoError(t, err)
+	assert.True(t, b.DeadLink)
+	loaded, _ = repo.ByID(1, b.ID)
+	assert.True(t, loaded.DeadLink)
+	assert.Equal(t, "Old title", loaded.Title)
+	assert.NotNil(t, loaded.LastRefreshedAt)
+
+	// URLs without provider keep their properties
+	b = insert(t, repo, oldBookmark("https://example.com/4"))
+	_, err = r.Refresh(context.Background(), b)
+	assert.NoError(t, err)
+	loaded, _ = repo.ByID(1, b.ID)
+	assert.False(t, loaded.DeadLink)
+	assert.Equal(t, "Old title", loaded.Title)
+	assert.NotNil(t, loaded.LastRefreshedAt)
+
+	// other errors are saved and the bookmark is refreshed again after MaxAge
+	fetcher.errs["https://vimeo.com/5"] = &oembed.UnauthorizedError{StatusCode: 403}
+	b = insert(t, repo, oldBookmark("https://vimeo.com/5"))
+	_, err = r.Refresh(context.Background(), b)
+	assert.Error(t, err)
+	loaded, _ = repo.ByID(1, b.ID)
+	assert.Equal(t, "Old title", loaded.Title)
+	assert.Equal(t, err.Error(), loaded.EnrichmentError)
+	assert.Nil(t, loaded.LastRefreshedAt)
+	if assert.NotNil(t, loaded.NextRefreshAt) {
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), *loaded.NextRefreshAt, time.Minute)
+	}
+
+	// cancelled fetches do not change the bookmark
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fetcher.errs["https://vimeo.com/6"] = context.Canceled
+	b = insert(t, repo, oldBookmark("https://vimeo.com/6"))
+	_, err = r.Refresh(ctx, b)
+	assert.Error(t, err)
+	loaded, _ = repo.ByID(1, b.ID)
+	assert.Empty(t, loaded.EnrichmentError)
+	assert.Nil(t, loaded.LastRefreshedAt)
+}
+
+func TestRefresherRefreshesStaleBookmarks(t *testing.T) {
+	fetcher := &fakeFetcher{failures: map[string]int{}, notFound: map[string]bool{}, calls: map[string]int{}}
+	repo, r := testRefresher(fetcher)
+
+	stale := insert(t, repo, oldBookmark("https://vimeo.com/1"))
+	fresh := insert(t, repo, &bookmarks.Bookmark{UserID: 1, URL: "https://vimeo.com/2", Keywords: []bookmarks.Keyword{}})
+
+	r.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for fetcher.callsTo("https://vimeo.com/1") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, r.Stop(context.Background()))
+
+	loaded, _ := repo.ByID(1, stale.ID)
+	assert.Equal(t, "Title of https://vimeo.com/1", loaded.Title)
+	assert.Equal(t, 1, fetcher.callsTo("https://vimeo.com/1"))
+
+	loaded, _ = repo.ByID(1, fresh.ID)
+	assert.Nil(t, loaded.LastRefreshedAt)
+	assert.Equal(t, 0, fetcher.callsTo("https://vimeo.com/2"))
+}
+
+func TestRefresherIsNotStarvedByFailingBookmarks(t *testing.T) {
+	fetcher := &fakeFetcher{failures: map[string]int{}, notFound: map[string]bool{}, errs: map[string]error{}, calls: map[string]int{}}
+	repo, r := testRefresher(fetcher)
+
+	// more failing bookmarks than a batch, all staler than the healthy one
+	for i := 0; i < 12; i++ {
+		url := fmt.Sprintf("https://vimeo.com/failing/%d", i)
+		if i%2 == 0 {
+			fetcher.failures[url] = 1000
+		} else {
+			fetcher.errs[url] = &oembed.UnauthorizedError{StatusCode: 403}
+		}
+		insert(t, repo, oldBookmark(url))
+	}
+	healthy := oldBookmark("https://vimeo.com/healthy")
+	added := time.Now().Add(-30 * time.Hour)
+	healthy.AddedDate = &added
+	healthy = insert(t, repo, healthy)
+
+	r.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for fetcher.callsTo("https://vimeo.com/healthy") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, r.Stop(context.Background()))
+
+	loaded, _ := repo.ByID(1, healthy.ID)
+	assert.Equal(t, "Title of https://vimeo.com/healthy", loaded.Title)
+
+	// the failing bookmarks were tried once
+	for i := 0; i < 12; i++ {
+		assert.Equal(t, 1, fetcher.callsTo(fmt.Sprintf("https://vimeo.com/failing/%d", i)))
+	}
+}
@@ -0,0 +1,31 @@
+package enrichment
+
+import (
+	"context"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/thumbnails"
+	log "github.com/sirupsen/logrus"
+)
+
+// updateThumbnail stores a copy of the thumbnail of a bookmark, or deletes it if the bookmark
+// has no thumbnail anymore. A thumbnail that cannot be downloaded does not make the enrichment
+// fail. The previous copy, if any, is kept
+func updateThumbnail(ctx context.Context, thumbs thumbnails.Store, b *bookmarks.Bookmark, logger log.FieldLogger) {
+	if b.ThumbnailURL == "" {
+		if b.HasThumbnail {
+			if err := thumbs.Delete(b.ID); err != nil {
+				logger.WithError(err).Warning("could not delete thumbnail")
+				return
+			}
+		}
+		b.HasThumbnail = false
+		return
+	}
+
+	if err := thumbs.Capture(ctx, b.ID, b.ThumbnailURL); err != nil {
+		logger.WithError(err).WithField("thumbnail_url", b.ThumbnailURL).Warning("could not capture thumbnail")
+		return
+	}
+	b.HasThumbnail = true
+}
@@ -0,0 +1,137 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+)
+
+// atomEncoder writes an Atom 1.0 feed. Entries are identified by the bookmarked URL
+// which is unique in a collection
+type atomEncoder struct {
+	w    io.Writer
+	feed Feed
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	XMLName    xml.Name       `xml:"entry"`
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Author     *atomPerson    `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+}
+
+func (e *atomEncoder) begin() error {
+	if _, err := io.WriteString(e.w, xml.Header+`<feed xmlns="http://www.w3.org/2005/Atom">`+"\n"); err != nil {
+		return err
+	}
+
+	// the feed element stays open while the entries are written
+	// so its children are encoded one by one
+	enc := xml.NewEncoder(e.w)
+	enc.Indent("    ", "    ")
+	for _, field := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"title", e.feed.Title},
+		{"id", e.feed.URL},
+		{"updated", atomDate(e.feed.Updated)},
+		// entries without an author inherit the one of the feed
+		{"author", atomPerson{Name: e.feed.Author}},
+		{"link", atomLink{Href: e.feed.URL, Rel: "self"}},
+	} {
+		if err := enc.EncodeElement(field.value, xml.StartElement{Name: xml.Name{Local: field.name}}); err != nil {
+			return err
+		}
+	}
+
+	return enc.Flush()
+}
+
+func (e *atomEncoder) encode(b *bookmarks.Bookmark) error {
+	title := b.Title
+	if title == "" {
+		title = b.URL
+	}
+
+	entry := atomEntry{
+		ID:      b.URL,
+		Title:   title,
+		Updated: atomDate(e.feed.Updated),
+		Links:   []atomLink{{Href: b.URL, Rel: "alternate"}},
+		Summary: summary(b),
+	}
+	if b.AddedDate != nil {
+		entry.Published = atomDate(*b.AddedDate)
+		entry.Updated = entry.Published
+	}
+	if b.LastRefreshedAt != nil {
+		entry.Updated = atomDate(*b.LastRefreshedAt)
+	}
+	if b.AuthorName != "" {
+		entry.Author = &atomPerson{Name: b.AuthorName, URI: b.AuthorURL}
+	}
+	if b.ThumbnailURL != "" {
+		entry.Links = append(entry.Links, atomLink{Href: b.ThumbnailURL, Rel: "enclosure"})
+	}
+	for _, kw := range b.Keywords {
+		entry.Categories = append(entry.Categories, atomCategory{Term: string(kw)})
+	}
+
+	if _, err := io.WriteString(e.w, "\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(e.w)
+	enc.Indent("    ", "    ")
+	return enc.Encode(entry)
+}
+
+func (e *atomEncoder) end() error {
+	_, err := io.WriteString(e.w, "\n</feed>\n")
+	return err
+}
+
+// summary describes the link with its oEmbed properties. ie: "video on Vimeo, 640 * 360, 120 seconds"
+func summary(b *bookmarks.Bookmark) string {
+	parts := []string{}
+	if b.Type != "" && b.Provider != "" {
+		parts = append(parts, fmt.Sprintf("%s on %s", b.Type, b.Provider))
+	} else if b.Provider != "" {
+		parts = append(parts, string(b.Provider))
+	}
+	if b.Width > 0 && b.Height > 0 {
+		parts = append(parts, fmt.Sprintf("%d * %d", b.Width, b.Height))
+	}
+	if b.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("%d seconds", b.Duration))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func atomDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,56 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+)
+
+// csvHeader lists the exported columns. Keywords are comma separated
+var csvHeader = []string{
+	"url", "title", "author_name", "added_date", "keywords",
+	"provider", "type", "provider_url", "author_url", "thumbnail_url", "photo_url",
+	"width", "height", "duration", "dead_link",
+}
+
+// csvEncoder writes one line per bookmark, with a header
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) begin() error {
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvEncoder) encode(b *bookmarks.Bookmark) error {
+	added := ""
+	if b.AddedDate != nil {
+		added = b.AddedDate.UTC().Format(time.RFC3339)
+	}
+
+	return e.w.Write([]string{
+		b.URL, b.Title, b.AuthorName, added, joinKeywords(b.Keywords),
+		string(b.Provider), string(b.Type), b.ProviderURL, b.AuthorURL, b.ThumbnailURL, b.PhotoURL,
+		optionalInt(b.Width), optionalInt(b.Height), optionalInt(b.Duration), strconv.FormatBool(b.DeadLink),
+	})
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// optionalInt leaves the unknown dimensions empty
+func optionalInt(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,129 @@
+// Package exporter writes bookmarks to files that browsers and other services can import
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/pager"
+)
+
+// Format is a format of bookmarks export
+type Format string
+
+// Supported formats
+const (
+	// FormatHTML is the Netscape bookmark file imported by browsers and most services
+	FormatHTML Format = "html"
+	// FormatJSON is the representation of the API
+	FormatJSON Format = "json"
+	// FormatCSV has one line per bookmark, with a header
+	FormatCSV Format = "csv"
+	// FormatAtom is a feed readers can subscribe to
+	FormatAtom Format = "atom"
+)
+
+// Valid returns true if the format is a supported one
+func (f Format) Valid() bool {
+	_, ok := contentTypes[f]
+	return ok
+}
+
+var contentTypes = map[Format]string{
+	FormatHTML: "text/html; charset=utf-8",
+	FormatJSON: "application/json; charset=utf-8",
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatAtom: "application/atom+xml; charset=utf-8",
+}
+
+// ContentType returns the media type of the format
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// Extension returns the file extension of the format, without the dot
+func (f Format) Extension() string {
+	if f == FormatAtom {
+		return "xml"
+	}
+	return string(f)
+}
+
+// batchSize is the number of bookmarks loaded at once
+// Collections are written batch by batch so they are never fully loaded in memory
+const batchSize = 100
+
+// Source returns a page of the bookmarks to export and the total number of bookmarks
+// It is usually bookmarks.Repository.List with a bound filter
+type Source func(p pager.Pager) ([]*bookmarks.Bookmark, int, error)
+
+// Feed describes the exported collection. Only the Atom format uses it
+type Feed struct {
+	Title string
+	// Absolute URL of the export. It identifies the feed
+	URL    string
+	Author string
+	// Updated defaults to now
+	Updated time.Time
+}
+
+// encoder writes bookmarks in a given format
+type encoder interface {
+	begin() error
+	encode(b *bookmarks.Bookmark) error
+	end() error
+}
+
+// Export writes all the bookmarks of the source to w
+// Nothing is written if the first batch cannot be loaded, so the caller can still report the error
+// Bookmarks inserted or deleted during the export might be missed
+func Export(w io.Writer, format Format, feed Feed, source Source) error {
+	if feed.Updated.IsZero() {
+		feed.Updated = time.Now()
+	}
+
+	var enc encoder
+	switch format {
+	case FormatHTML:
+		enc = &htmlEncoder{w: w}
+	case FormatJSON:
+		enc = &jsonEncoder{w: w}
+	case FormatCSV:
+		enc = newCSVEncoder(w)
+	case FormatAtom:
+		enc = &atomEncoder{w: w, feed: feed}
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	bs, count, err := source(pager.New(1, batchSize))
+	if err != nil {
+		return err
+	}
+
+	if err := enc.begin(); err != nil {
+		return err
+	}
+
+	for page := 1; ; page++ {
+		if page > 1 {
+			if bs, _, err = source(pager.New(page, batchSize)); err != nil {
+				return err
+			}
+		}
+
+		for _, b := range bs {
+			if err := enc.encode(b); err != nil {
+				return err
+			}
+		}
+
+		if len(bs) < batchSize || page*batchSize >= count {
+			break
+		}
+	}
+
+	return enc.end()
+}
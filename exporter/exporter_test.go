@@ -0,0 +1,176 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/importer"
+	"github.com/fchoquet/bookmarks/pager"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(seconds int64) *time.Time {
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
+
+var fixtures = []*bookmarks.Bookmark{
+	{
+		URL:          "https://vimeo.com/1?a=1&b=2",
+		Title:        "A <video>",
+		AuthorName:   "Bob",
+		AddedDate:    date(1520000000),
+		Provider:     "Vimeo",
+		Type:         "video",
+		Width:        640,
+		Height:       360,
+		ThumbnailURL: "https://i.vimeocdn.com/1.jpg",
+		Keywords:     []bookmarks.Keyword{"go", "web dev"},
+	},
+	{
+		URL:      "https://example.com/",
+		Keywords: []bookmarks.Keyword{},
+	},
+}
+
+// sliceSource paginates bookmarks and records the requested pages
+type sliceSource struct {
+	bookmarks []*bookmarks.Bookmark
+	pages     []int
+}
+
+func (s *sliceSource) list(p pager.Pager) ([]*bookmarks.Bookmark, int, error) {
+	s.pages = append(s.pages, p.Page())
+	page := []*bookmarks.Bookmark{}
+	for i, b := range s.bookmarks {
+		if p.IsVisible(i) {
+			page = append(page, b)
+		}
+	}
+	return page, len(s.bookmarks), nil
+}
+
+func export(t *testing.T, format Format, bs []*bookmarks.Bookmark) []byte {
+	var buf bytes.Buffer
+	source := &sliceSource{bookmarks: bs}
+	if !assert.NoError(t, Export(&buf, format, Feed{Title: "Bookmarks", URL: "http://localhost/bookmarks/export"}, source.list)) {
+		t.FailNow()
+	}
+	return buf.Bytes()
+}
+
+func TestExportHTMLCanBeImported(t *testing.T) {
+	entries, err := importer.Parse(export(t, FormatHTML, fixtures), "")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, []importer.Entry{
+		{
+			URL:       "https://vimeo.com/1?a=1&b=2",
+			Title:     "A <video>",
+			AddedDate: date(1520000000),
+			Keywords:  []bookmarks.Keyword{"go", "web dev"},
+		},
+		{
+			URL:      "https://example.com/",
+			Title:    "https://example.com/",
+			Keywords: []bookmarks.Keyword{},
+		},
+	}, entries)
+}
+
+func TestExportJSON(t *testing.T) {
+	var bs []*bookmarks.Bookmark
+	if assert.NoError(t, json.Unmarshal(export(t, FormatJSON, fixtures), &bs)) {
+		assert.Equal(t, fixtures, bs)
+	}
+
+	assert.Equal(t, "[]\n", string(export(t, FormatJSON, nil)))
+}
+
+func TestExportCSV(t *testing.T) {
+	lines, err := csv.NewReader(bytes.NewReader(export(t, FormatCSV, fixtures))).ReadAll()
+	if !assert.NoError(t, err) || !assert.Len(t, lines, 3) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, csvHeader, lines[0])
+	assert.Equal(t, []string{
+		"https://vimeo.com/1?a=1&b=2", "A <video>", "Bob", "2018-03-02T14:13:20Z", "go,web dev",
+		"Vimeo", "video", "", "", "https://i.vimeocdn.com/1.jpg", "",
+		"640", "360", "", "false",
+	}, lines[1])
+}
+
+func TestExportAtom(t *testing.T) {
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Entries []struct {
+			ID         string `xml:"id"`
+			Title      string `xml:"title"`
+			Published  string `xml:"published"`
+			Summary    string `xml:"summary"`
+			Categories []struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+		} `xml:"entry"`
+	}
+	if !assert.NoError(t, xml.Unmarshal(export(t, FormatAtom, fixtures), &feed)) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "http://localhost/bookmarks/export", feed.ID)
+	if assert.Len(t, feed.Entries, 2) {
+		entry := feed.Entries[0]
+		assert.Equal(t, "https://vimeo.com/1?a=1&b=2", entry.ID)
+		assert.Equal(t, "A <video>", entry.Title)
+		assert.Equal(t, "2018-03-02T14:13:20Z", entry.Published)
+		assert.Equal(t, "video on Vimeo, 640 * 360", entry.Summary)
+		assert.Len(t, entry.Categories, 2)
+
+		// the URL is the title of untitled bookmarks
+		assert.Equal(t, "https://example.com/", feed.Entries[1].Title)
+	}
+}
+
+func TestExportReadsBatches(t *testing.T) {
+	bs := []*bookmarks.Bookmark{}
+	for i := 0; i < 2*batchSize+1; i++ {
+		bs = append(bs, &bookmarks.Bookmark{URL: fmt.Sprintf("https://example.com/%d", i), Keywords: []bookmarks.Keyword{}})
+	}
+
+	source := &sliceSource{bookmarks: bs}
+	var buf bytes.Buffer
+	if !assert.NoError(t, Export(&buf, FormatCSV, Feed{}, source.list)) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, []int{1, 2, 3}, source.pages)
+	lines, err := csv.NewReader(&buf).ReadAll()
+	if assert.NoError(t, err) {
+		assert.Len(t, lines, len(bs)+1)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	failing := func(p pager.Pager) ([]*bookmarks.Bookmark, int, error) {
+		return nil, 0, errors.New("database is down")
+	}
+
+	var buf bytes.Buffer
+	assert.Error(t, Export(&buf, FormatHTML, Feed{}, failing))
+	assert.Empty(t, buf.String(), "nothing must be written if the first batch fails")
+
+	source := &sliceSource{bookmarks: fixtures}
+	assert.Error(t, Export(&buf, "xml", Feed{}, source.list))
+	assert.Empty(t, source.pages)
+}
@@ -0,0 +1,66 @@
+package exporter
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+)
+
+// htmlEncoder writes the Netscape bookmark file format
+// Keywords are written in the TAGS attribute, as most services do
+type htmlEncoder struct {
+	w io.Writer
+}
+
+const htmlHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`
+
+func (e *htmlEncoder) begin() error {
+	_, err := io.WriteString(e.w, htmlHeader)
+	return err
+}
+
+func (e *htmlEncoder) encode(b *bookmarks.Bookmark) error {
+	attrs := fmt.Sprintf(`HREF="%s"`, html.EscapeString(b.URL))
+	if b.AddedDate != nil {
+		attrs += fmt.Sprintf(` ADD_DATE="%d"`, b.AddedDate.Unix())
+	}
+	if b.LastRefreshedAt != nil {
+		attrs += fmt.Sprintf(` LAST_MODIFIED="%d"`, b.LastRefreshedAt.Unix())
+	}
+	if len(b.Keywords) > 0 {
+		attrs += fmt.Sprintf(` TAGS="%s"`, html.EscapeString(joinKeywords(b.Keywords)))
+	}
+
+	title := b.Title
+	if title == "" {
+		title = b.URL
+	}
+
+	_, err := fmt.Fprintf(e.w, "    <DT><A %s>%s</A>\n", attrs, html.EscapeString(title))
+	return err
+}
+
+func (e *htmlEncoder) end() error {
+	_, err := io.WriteString(e.w, "</DL><p>\n")
+	return err
+}
+
+// joinKeywords returns comma separated keywords
+func joinKeywords(keywords []bookmarks.Keyword) string {
+	names := make([]string, 0, len(keywords))
+	for _, kw := range keywords {
+		names = append(names, string(kw))
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+)
+
+// jsonEncoder writes an array of bookmarks, as returned by the API
+// Bookmarks are marshalled one by one so that the array is never fully in memory
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonEncoder) encode(b *bookmarks.Bookmark) error {
+	j, err := json.MarshalIndent(b, "    ", "    ")
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n    "
+	if e.count == 0 {
+		separator = "\n    "
+	}
+	e.count++
+
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(j)
+	return err
+}
+
+func (e *jsonEncoder) end() error {
+	closing := "\n]\n"
+	if e.count == 0 {
+		closing = "]\n"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
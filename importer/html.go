@@ -0,0 +1,200 @@
+package importer
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// parseHTML reads the Netscape bookmark file format, exported by browsers, and the
+// Pocket export, which is a flat list of links using the same attributes
+// Folders (an <H3> followed by a <DL> list) become keywords of the bookmarks they contain,
+// as well as the comma separated TAGS attribute
+// This is not a full HTML parser. Browsers do not even close the <DT> and <p> tags
+func parseHTML(page string) []Entry {
+	entries := []Entry{}
+	lower := asciiLower(page)
+
+	// folders of the open <DL> lists. Lists without a heading have an empty name
+	folders := []string{}
+	// heading of the next <DL> list
+	heading := ""
+
+	for i := 0; i < len(page); {
+		lt := strings.IndexByte(page[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+
+		if strings.HasPrefix(page[i:], "<!--") {
+			end := strings.Index(page[i:], "-->")
+			if end < 0 {
+				break
+			}
+			i += end + len("-->")
+			continue
+		}
+
+		name, closing, attrs, next := parseTag(page, i)
+		i = next
+
+		switch {
+		case name == "dl" && !closing:
+			folders = append(folders, heading)
+			heading = ""
+		case name == "dl" && closing:
+			if len(folders) > 0 {
+				folders = folders[:len(folders)-1]
+			}
+		case name == "h3" && !closing:
+			text, next := textUntil(page, lower, i, "</h3")
+			i = next
+			heading = text
+			// the toolbar or the "other bookmarks" of browsers are not topics
+			if _, ok := attrs["personal_toolbar_folder"]; ok {
+				heading = ""
+			}
+			if _, ok := attrs["unfiled_bookmarks_folder"]; ok {
+				heading = ""
+			}
+		case name == "a" && !closing:
+			text, next := textUntil(page, lower, i, "</a")
+			i = next
+			entries = append(entries, htmlEntry(attrs, text, folders))
+		}
+	}
+
+	return entries
+}
+
+// htmlEntry builds the entry of a link
+func htmlEntry(attrs map[string]string, title string, folders []string) Entry {
+	names := append([]string{}, folders...)
+	names = append(names, strings.Split(attrs["tags"], ",")...)
+
+	// browsers use add_date, Pocket uses time_added
+	added := attrs["add_date"]
+	if added == "" {
+		added = attrs["time_added"]
+	}
+	seconds, _ := strconv.ParseInt(strings.TrimSpace(added), 10, 64)
+
+	return Entry{
+		URL:       strings.TrimSpace(attrs["href"]),
+		Title:     title,
+		AddedDate: unixTime(seconds),
+		Keywords:  keywords(names),
+	}
+}
+
+// textUntil returns the text preceding a closing tag, unescaped and with collapsed spaces
+// It also returns the position of the closing tag
+func textUntil(page, lower string, start int, closing string) (string, int) {
+	end := strings.Index(lower[start:], closing)
+	if end < 0 {
+		end = len(page) - start
+	}
+	text := html.UnescapeString(page[start : start+end])
+	return strings.Join(strings.Fields(text), " "), start + end
+}
+
+// parseTag parses the tag starting at page[start]
+// It returns its lowercased name, whether it is a closing tag, its attributes with lowercased
+// names and the position following the tag. Doctypes and others have no name
+func parseTag(page string, start int) (string, bool, map[string]string, int) {
+	i := start + 1
+	closing := i < len(page) && page[i] == '/'
+	if closing {
+		i++
+	}
+
+	if i >= len(page) || !isASCIILetter(page[i]) {
+		end := strings.IndexByte(page[i:], '>')
+		if end < 0 {
+			return "", false, nil, len(page)
+		}
+		return "", false, nil, i + end + 1
+	}
+
+	nameStart := i
+	for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '>' && page[i] != '/' {
+		i++
+	}
+	name := asciiLower(page[nameStart:i])
+
+	attrs := map[string]string{}
+	for i < len(page) {
+		for i < len(page) && (isHTMLSpace(page[i]) || page[i] == '/') {
+			i++
+		}
+		if i >= len(page) {
+			break
+		}
+		if page[i] == '>' {
+			return name, closing, attrs, i + 1
+		}
+
+		attrStart := i
+		for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '=' && page[i] != '>' && page[i] != '/' {
+			i++
+		}
+		attr := asciiLower(page[attrStart:i])
+
+		for i < len(page) && isHTMLSpace(page[i]) {
+			i++
+		}
+		if i >= len(page) || page[i] != '=' {
+			if _, ok := attrs[attr]; !ok {
+				attrs[attr] = ""
+			}
+			continue
+		}
+		i++
+		for i < len(page) && isHTMLSpace(page[i]) {
+			i++
+		}
+
+		var value string
+		if i < len(page) && (page[i] == '"' || page[i] == '\'') {
+			quote := page[i]
+			end := strings.IndexByte(page[i+1:], quote)
+			if end < 0 {
+				return name, closing, attrs, len(page)
+			}
+			value = page[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			valueStart := i
+			for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '>' {
+				i++
+			}
+			value = page[valueStart:i]
+		}
+
+		if _, ok := attrs[attr]; !ok {
+			attrs[attr] = html.UnescapeString(value)
+		}
+	}
+
+	return name, closing, attrs, len(page)
+}
+
+// asciiLower lowercases ASCII letters only so that positions are preserved
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,213 @@
+// Package importer creates bookmarks from the exports of browsers and other services
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/fchoquet/bookmarks/enrichment"
+)
+
+// Format is a format of bookmarks export
+type Format string
+
+// Supported formats
+const (
+	// FormatNetscape is the HTML format exported by browsers and most services
+	FormatNetscape Format = "netscape"
+	// FormatPocket is the HTML export of Pocket. It is a simplified Netscape format
+	FormatPocket Format = "pocket"
+	// FormatPinboard is the JSON export of Pinboard
+	FormatPinboard Format = "pinboard"
+)
+
+// Valid returns true if the format is a supported one
+func (f Format) Valid() bool {
+	return f == FormatNetscape || f == FormatPocket || f == FormatPinboard
+}
+
+// Entry is a bookmark read from an export
+type Entry struct {
+	URL   string
+	Title string
+	// nil if the export does not tell
+	AddedDate *time.Time
+	// Tags and folders
+	Keywords []bookmarks.Keyword
+}
+
+// DetectFormat guesses the format of an export. It returns an empty format if it is not supported
+func DetectFormat(data []byte) Format {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		return FormatPinboard
+	case bytes.Contains(data, []byte("<title>Pocket Export</title>")):
+		return FormatPocket
+	case bytes.Contains(bytes.ToUpper(data), []byte("NETSCAPE-BOOKMARK-FILE")):
+		return FormatNetscape
+	}
+	return ""
+}
+
+// Parse reads the entries of an export
+// The format is detected if it is empty
+func Parse(data []byte, format Format) ([]Entry, error) {
+	if format == "" {
+		format = DetectFormat(data)
+	}
+
+	switch format {
+	case FormatNetscape, FormatPocket:
+		return parseHTML(string(data)), nil
+	case FormatPinboard:
+		return parsePinboard(data)
+	case "":
+		return nil, fmt.Errorf("unknown format. Supported formats are %s, %s and %s", FormatNetscape, FormatPocket, FormatPinboard)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// Status tells what happened to an entry
+type Status string
+
+// Entry statuses
+const (
+	StatusCreated Status = "created"
+	StatusSkipped Status = "skipped"
+	StatusFailed  Status = "failed"
+)
+
+// Result is the outcome of the import of an entry
+type Result struct {
+	URL    string `json:"url"`
+	Title  string `json:"title,omitempty"`
+	Status Status `json:"status"`
+	// The created bookmark, or the existing one for skipped entries
+	BookmarkID int    `json:"bookmark_id,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Report lists the results of an import, in the order of the entries
+type Report struct {
+	Created int      `json:"created"`
+	Skipped int      `json:"skipped"`
+	Failed  int      `json:"failed"`
+	Results []Result `json:"results"`
+}
+
+func (r *Report) add(result Result) {
+	switch result.Status {
+	case StatusCreated:
+		r.Created++
+	case StatusSkipped:
+		r.Skipped++
+	case StatusFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// Import creates the bookmarks of a user from the entries of an export
+// URLs already bookmarked by the user are skipped, as well as duplicates in the export
+// Entries are independent: a failure does not stop the import
+// New bookmarks are enriched in the background, like the ones created one by one
+func Import(repo bookmarks.Repository, queue enrichment.Queue, userID int, entries []Entry) *Report {
+	report := &Report{Results: []Result{}}
+	created := map[int]bool{}
+
+	for _, entry := range entries {
+		result := Result{URL: entry.URL, Title: entry.Title}
+
+		if !isWebURL(entry.URL) {
+			result.Status, result.Reason = StatusFailed, "only http and https URLs can be bookmarked"
+			report.add(result)
+			continue
+		}
+
+		result = create(repo, queue, userID, entry, result)
+		switch {
+		case result.Status == StatusCreated:
+			created[result.BookmarkID] = true
+		case result.Status == StatusSkipped && created[result.BookmarkID]:
+			result.Reason = "duplicate in the export"
+		}
+		report.add(result)
+	}
+
+	return report
+}
+
+// create inserts the bookmark of an entry and schedules its enrichment
+func create(repo bookmarks.Repository, queue enrichment.Queue, userID int, entry Entry, result Result) Result {
+	b, err := repo.Insert(&bookmarks.Bookmark{
+		UserID:           userID,
+		URL:              entry.URL,
+		Title:            truncate(entry.Title, 100),
+		AddedDate:        entry.AddedDate,
+		Keywords:         entry.Keywords,
+		EnrichmentStatus: bookmarks.EnrichmentPending,
+	})
+	switch err := err.(type) {
+	case nil:
+	case *bookmarks.DuplicateError:
+		result.Status, result.BookmarkID, result.Reason = StatusSkipped, err.ID, "already bookmarked"
+		return result
+	case *bookmarks.ValidationError:
+		result.Status, result.Reason = StatusFailed, err.Error()
+		return result
+	default:
+		result.Status, result.Reason = StatusFailed, err.Error()
+		return result
+	}
+
+	// if the queue is full the bookmark is picked up by the next sweep
+	queue.Enqueue(b)
+
+	result.Status, result.BookmarkID = StatusCreated, b.ID
+	return result
+}
+
+// keywords converts tags and folders to keywords
+// Blank ones and duplicates are dropped. Long ones are truncated to fit in the database
+func keywords(names []string) []bookmarks.Keyword {
+	kws := []bookmarks.Keyword{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = truncate(strings.Join(strings.Fields(name), " "), 50)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		kws = append(kws, bookmarks.Keyword(name))
+	}
+	return kws
+}
+
+// isWebURL tells if an URL can be bookmarked. Exports contain bookmarklets, browser pages...
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// unixTime converts a timestamp in seconds. It returns nil if it is missing or invalid
+func unixTime(seconds int64) *time.Time {
+	if seconds <= 0 {
+		return nil
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
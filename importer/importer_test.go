@@ -0,0 +1,231 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/bookmarks"
+	"github.com/stretchr/testify/assert"
+)
+
+const netscapeExport = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file. -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1500000000" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://vimeo.com/1" ADD_DATE="1520000000" TAGS="design,video">A  video &amp; more</A>
+        <DT><H3>Music</H3>
+        <DL><p>
+            <DT><A HREF="https://www.youtube.com/watch?v=1">A song</A>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+    <DT><A HREF="https://flickr.com/photos/1" ADD_DATE="not a date">A photo</A>
+</DL><p>`
+
+const pocketExport = `<!DOCTYPE html>
+<html>
+	<head><title>Pocket Export</title></head>
+	<body>
+		<h1>Unread</h1>
+		<ul>
+			<li><a href="https://example.com/article" time_added="1520000000" tags="reading,go">An article</a></li>
+		</ul>
+		<h1>Read Archive</h1>
+		<ul>
+			<li><a href="https://example.com/old" time_added="1500000000" tags="">An old one</a></li>
+		</ul>
+	</body>
+</html>`
+
+const pinboardExport = `[
+	{"href": "https://vimeo.com/1", "description": "A video", "extended": "", "time": "2018-03-02T14:00:00Z", "tags": "design video"},
+	{"href": "https://example.com/", "description": "", "time": "", "tags": ""}
+]`
+
+func date(seconds int64) *time.Time {
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
+
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, FormatNetscape, DetectFormat([]byte(netscapeExport)))
+	assert.Equal(t, FormatPocket, DetectFormat([]byte(pocketExport)))
+	assert.Equal(t, FormatPinboard, DetectFormat([]byte(pinboardExport)))
+	assert.Equal(t, Format(""), DetectFormat([]byte("url,title")))
+}
+
+func TestParseNetscape(t *testing.T) {
+	entries, err := Parse([]byte(netscapeExport), "")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, []Entry{
+		{
+			URL:       "https://vimeo.com/1",
+			Title:     "A video & more",
+			AddedDate: date(1520000000),
+			Keywords:  []bookmarks.Keyword{"design", "video"},
+		},
+		{
+			URL:      "https://www.youtube.com/watch?v=1",
+			Title:    "A song",
+			Keywords: []bookmarks.Keyword{"Music"},
+		},
+		{
+			URL:      "javascript:alert(1)",
+			Title:    "Bookmarklet",
+			Keywords: []bookmarks.Keyword{},
+		},
+		{
+			URL:      "https://flickr.com/photos/1",
+			Title:    "A photo",
+			Keywords: []bookmarks.Keyword{},
+		},
+	}, entries)
+}
+
+func TestParsePocket(t *testing.T) {
+	entries, err := Parse([]byte(pocketExport), FormatPocket)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, []Entry{
+		{
+			URL:       "https://example.com/article",
+			Title:     "An article",
+			AddedDate: date(1520000000),
+			Keywords:  []bookmarks.Keyword{"reading", "go"},
+		},
+		{
+			URL:       "https://example.com/old",
+			Title:     "An old one",
+			AddedDate: date(1500000000),
+			Keywords:  []bookmarks.Keyword{},
+		},
+	}, entries)
+}
+
+func TestParsePinboard(t *testing.T) {
+	entries, err := Parse([]byte(pinboardExport), FormatPinboard)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, []Entry{
+		{
+			URL:       "https://vimeo.com/1",
+			Title:     "A video",
+			AddedDate: date(1519999200),
+			Keywords:  []bookmarks.Keyword{"design", "video"},
+		},
+		{
+			URL:      "https://example.com/",
+			Keywords: []bookmarks.Keyword{},
+		},
+	}, entries)
+
+	_, err = Parse([]byte(`[{"href": `), FormatPinboard)
+	assert.Error(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte("url,title"), "")
+	assert.Error(t, err)
+
+	_, err = Parse([]byte(netscapeExport), "csv")
+	assert.Error(t, err)
+}
+
+func TestParseHTMLToleratesBrokenMarkup(t *testing.T) {
+	for _, page := range []string{
+		``,
+		`<`,
+		`<DL><p><DT><A HREF="https://vimeo.com/1`,
+		`<DL><p><DT><A HREF=https://vimeo.com/1>no end`,
+		`</DL></DL><H3>no end`,
+		`<!-- unclosed comment`,
+	} {
+		assert.NotPanics(t, func() { parseHTML(page) }, page)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	long := "a very long keyword that does not fit in the database column"
+	assert.Equal(t,
+		[]bookmarks.Keyword{"go", "web dev", bookmarks.Keyword(long[:50])},
+		keywords([]string{" go ", "", "Go", "web   dev", long}),
+	)
+}
+
+// fakeQueue records the enqueued bookmarks
+type fakeQueue struct {
+	enqueued []int
+}
+
+func (q *fakeQueue) Enqueue(b *bookmarks.Bookmark) bool {
+	q.enqueued = append(q.enqueued, b.ID)
+	return true
+}
+
+func (q *fakeQueue) Start() {}
+
+func (q *fakeQueue) Stop(ctx context.Context) error { return nil }
+
+func TestImport(t *testing.T) {
+	repo := bookmarks.NewMemoryRepository()
+	queue := &fakeQueue{}
+
+	existing, err := repo.Insert(&bookmarks.Bookmark{UserID: 1, URL: "https://vimeo.com/1", Keywords: []bookmarks.Keyword{}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// other users' bookmarks are not duplicates
+	_, err = repo.Insert(&bookmarks.Bookmark{UserID: 2, URL: "https://vimeo.com/2", Keywords: []bookmarks.Keyword{}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	report := Import(repo, queue, 1, []Entry{
+		{URL: "https://vimeo.com/1", Title: "Already there"},
+		{URL: "https://vimeo.com/2", Title: "A video", AddedDate: date(1520000000), Keywords: []bookmarks.Keyword{"video"}},
+		{URL: "https://VIMEO.com/2/?utm_source=twitter", Title: "Twice in the export"},
+		{URL: "javascript:alert(1)"},
+		{URL: "https://example.com/" + strings.Repeat("a", 300)},
+	})
+
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 2, report.Failed)
+	if !assert.Len(t, report.Results, 5) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, StatusSkipped, report.Results[0].Status)
+	assert.Equal(t, existing.ID, report.Results[0].BookmarkID)
+	assert.Equal(t, "already bookmarked", report.Results[0].Reason)
+
+	created := report.Results[1]
+	assert.Equal(t, StatusCreated, created.Status)
+	assert.Equal(t, StatusSkipped, report.Results[2].Status)
+	assert.Equal(t, created.BookmarkID, report.Results[2].BookmarkID)
+	assert.Equal(t, "duplicate in the export", report.Results[2].Reason)
+	assert.Equal(t, StatusFailed, report.Results[3].Status)
+	assert.Equal(t, StatusFailed, report.Results[4].Status)
+
+	b, err := repo.ByID(1, created.BookmarkID)
+	if assert.NoError(t, err) && assert.NotNil(t, b) {
+		assert.Equal(t, "A video", b.Title)
+		assert.Equal(t, date(1520000000), b.AddedDate)
+		assert.Equal(t, []bookmarks.Keyword{"video"}, b.Keywords)
+		assert.Equal(t, bookmarks.EnrichmentPending, b.EnrichmentStatus)
+	}
+	assert.Equal(t, []int{created.BookmarkID}, queue.enqueued)
+}
@@ -0,0 +1,41 @@
+package importer
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// pinboardPost is a bookmark of the Pinboard JSON export
+type pinboardPost struct {
+	Href string `json:"href"`
+	// Pinboard calls the title a description
+	Description string `json:"description"`
+	Time        string `json:"time"`
+	// space separated
+	Tags string `json:"tags"`
+}
+
+// parsePinboard reads the JSON export of Pinboard
+func parsePinboard(data []byte) ([]Entry, error) {
+	var posts []pinboardPost
+	if err := json.Unmarshal(data, &posts); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(posts))
+	for _, post := range posts {
+		entry := Entry{
+			URL:      strings.TrimSpace(post.Href),
+			Title:    strings.TrimSpace(post.Description),
+			Keywords: keywords(strings.Fields(post.Tags)),
+		}
+		if added, err := time.Parse(time.RFC3339, post.Time); err == nil {
+			added = added.UTC()
+			entry.AddedDate = &added
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/fchoquet/bookmarks/app"
 	_ "github.com/go-sql-driver/mysql"
@@ -13,17 +16,91 @@ func main() {
 		panic(err)
 	}
 
+	customProviders, err := app.LoadCustomProviders(os.Getenv("OEMBED_CUSTOM_PROVIDERS"))
+	if err != nil {
+		panic(err)
+	}
+
 	// no env vars should be accessed outside of the main function
-	app.Start(app.Configuration{
+	cfg := app.Configuration{
 		LogLevel:       os.Getenv("LOG_LEVEL"),
 		BasicAuthUsers: users,
+		StorageDriver:  os.Getenv("STORAGE_DRIVER"),
 		DBConfig: app.DatabaseConfig{
 			User:     os.Getenv("DB_USER"),
 			Password: os.Getenv("DB_PASSWORD"),
 			Host:     os.Getenv("DB_HOST"),
 			Database: os.Getenv("DB_NAME"),
 		},
+		SQLitePath:    os.Getenv("SQLITE_PATH"),
+		BlobsDir:      os.Getenv("BLOBS_DIR"),
+		RefreshMaxAge: durationEnv("REFRESH_MAX_AGE"),
+		Oembed: app.OembedConfig{
+			ProvidersSource:          os.Getenv("OEMBED_PROVIDERS"),
+			ProvidersCachePath:       os.Getenv("OEMBED_PROVIDERS_CACHE"),
+			ProvidersRefreshInterval: durationEnv("OEMBED_PROVIDERS_REFRESH"),
+			CustomProviders:          customProviders,
+			CacheSize:                intEnv("OEMBED_CACHE_SIZE"),
+			PersistCache:             os.Getenv("OEMBED_CACHE_PERSIST") == "true",
+			RateLimit:                floatEnv("OEMBED_RATE_LIMIT"),
+			RateBurst:                intEnv("OEMBED_RATE_BURST"),
+		},
+		AdminUsers:            app.ParseNames(os.Getenv("ADMIN_USERS")),
 		CSRFSecret:            []byte("sMKZudrjHxnN6fHLsJKFUMBeC7rnZ2Kd"),
 		DisableCSRFProtection: os.Getenv("ENV") == "DEV",
-	})
+	}
+
+	// bookmarks migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(cfg, os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	app.Start(cfg)
+}
+
+// durationEnv parses an env var formatted as a Go duration (90s, 12h...)
+// Returns zero if not set
+func durationEnv(name string) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		panic(fmt.Errorf("invalid %s: %s", name, err))
+	}
+	return d
+}
+
+// intEnv parses an integer env var. Returns zero if not set
+func intEnv(name string) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0
+	}
+
+	i, err := strconv.Atoi(raw)
+	if err != nil {
+		panic(fmt.Errorf("invalid %s: %s", name, err))
+	}
+	return i
+}
+
+// floatEnv parses a decimal env var. Returns zero if not set
+func floatEnv(name string) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		panic(fmt.Errorf("invalid %s: %s", name, err))
+	}
+	return f
 }
@@ -0,0 +1,242 @@
+package oembed
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/fchoquet/bookmarks/blobs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Cache stores oEmbed responses by URL until they expire
+type Cache interface {
+	// Get returns the link of an URL. false if it is not cached or expired
+	Get(rawURL string) (*Link, bool)
+	// Set caches the link of an URL. Nothing is cached if the ttl is not positive
+	Set(rawURL string, link *Link, ttl time.Duration)
+}
+
+// cacheEntry is what is cached, in memory or in the persistent store
+type cacheEntry struct {
+	URL       string    `json:"url"`
+	Link      *Link     `json:"link"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e *cacheEntry) expired() bool {
+	return !time.Now().Before(e.ExpiresAt)
+}
+
+// lruCache keeps the most recently used links in memory
+// Other links are loaded from the persistent store, if any, so that they survive restarts
+type lruCache struct {
+	size   int
+	store  blobs.Store
+	logger log.FieldLogger
+
+	mu sync.Mutex
+	// most recently used first. Values are *cacheEntry
+	entries *list.List
+	byURL   map[string]*list.Element
+}
+
+// NewCache returns an in-memory LRU cache holding up to size links
+// store is optional. When set, links are written to it too and read from it on cache misses
+func NewCache(size int, store blobs.Store, logger log.FieldLogger) Cache {
+	return &lruCache{
+		size:    size,
+		store:   store,
+		logger:  logger,
+		entries: list.New(),
+		byURL:   map[string]*list.Element{},
+	}
+}
+
+// Get implements the Cache interface
+func (c *lruCache) Get(rawURL string) (*Link, bool) {
+	c.mu.Lock()
+	if elt, ok := c.byURL[rawURL]; ok {
+		entry := elt.Value.(*cacheEntry)
+		if entry.expired() {
+			c.remove(elt)
+			c.mu.Unlock()
+			c.deletePersisted(rawURL)
+			return nil, false
+		}
+
+		c.entries.MoveToFront(elt)
+		c.mu.Unlock()
+		return copyLink(entry.Link), true
+	}
+	c.mu.Unlock()
+
+	entry := c.loadPersisted(rawURL)
+	if entry == nil {
+		return nil, false
+	}
+	if entry.expired() {
+		c.deletePersisted(rawURL)
+		return nil, false
+	}
+
+	c.mu.Lock()
+	c.add(entry)
+	c.mu.Unlock()
+	return copyLink(entry.Link), true
+}
+
+// Set implements the Cache interface
+func (c *lruCache) Set(rawURL string, link *Link, ttl time.Duration) {
+	if ttl <= 0 || link == nil {
+		return
+	}
+
+	entry := &cacheEntry{URL: rawURL, Link: copyLink(link), ExpiresAt: time.Now().Add(ttl)}
+
+	c.mu.Lock()
+	c.add(entry)
+	c.mu.Unlock()
+
+	c.persist(entry)
+}
+
+// add adds an entry and evicts the least recently used ones. Must be called with the lock held
+// Evicted entries stay in the persistent store
+func (c *lruCache) add(entry *cacheEntry) {
+	if elt, ok := c.byURL[entry.URL]; ok {
+		c.remove(elt)
+	}
+	c.byURL[entry.URL] = c.entries.PushFront(entry)
+
+	for c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+	}
+}
+
+// remove removes an entry from memory. Must be called with the lock held
+func (c *lruCache) remove(elt *list.Element) {
+	c.entries.Remove(elt)
+	delete(c.byURL, elt.Value.(*cacheEntry).URL)
+}
+
+// persistedKey is the key of an URL in the persistent store. URLs cannot be used as is
+func persistedKey(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return "oembed-cache/" + hex.EncodeToString(sum[:]) + ".json"
+}
+
+// The persistent store is a best effort. Its errors are logged but do not make the fetch fail
+
+func (c *lruCache) persist(entry *cacheEntry) {
+	if c.store == nil {
+		return
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		c.logger.WithError(err).Warning("could not encode oEmbed cache entry")
+		return
+	}
+
+	if err := c.store.Put(persistedKey(entry.URL), bytes.NewReader(raw)); err != nil {
+		c.logger.WithError(err).Warning("could not persist oEmbed cache entry")
+	}
+}
+
+func (c *lruCache) loadPersisted(rawURL string) *cacheEntry {
+	if c.store == nil {
+		return nil
+	}
+
+	blob, err := c.store.Get(persistedKey(rawURL))
+	if err != nil {
+		if _, ok := err.(*blobs.NotFoundError); !ok {
+			c.logger.WithError(err).Warning("could not read oEmbed cache entry")
+		}
+		return nil
+	}
+	defer blob.Close()
+
+	var entry cacheEntry
+	if err := json.NewDecoder(blob).Decode(&entry); err != nil || entry.Link == nil || entry.URL != rawURL {
+		// corrupted, or an incredibly unlikely hash collision
+		return nil
+	}
+	return &entry
+}
+
+func (c *lruCache) deletePersisted(rawURL string) {
+	if c.store == nil {
+		return
+	}
+
+	if err := c.store.Delete(persistedKey(rawURL)); err != nil {
+		c.logger.WithError(err).Warning("could not delete oEmbed cache entry")
+	}
+}
+
+// copyLink returns a copy of a link so that callers cannot modify the cached one
+func copyLink(link *Link) *Link {
+	c := *link
+	return &c
+}
+
+// CacheOptions configures how long links are cached
+type CacheOptions struct {
+	// DefaultTTL is used when the provider does not return a cache_age
+	DefaultTTL time.Duration
+	// MaxTTL caps the cache_age of providers. Properties must be refreshed at some point
+	MaxTTL time.Duration
+}
+
+// DefaultCacheOptions are sensible options for production
+var DefaultCacheOptions = CacheOptions{
+	DefaultTTL: time.Hour,
+	MaxTTL:     24 * time.Hour,
+}
+
+// cachingFetcher serves links from a cache before calling the wrapped fetcher
+type cachingFetcher struct {
+	fetcher Fetcher
+	cache   Cache
+	opts    CacheOptions
+}
+
+// NewCachingFetcher returns a fetcher caching the links returned by another one
+// Links are cached for the cache_age returned by the provider. Errors are not cached
+func NewCachingFetcher(fetcher Fetcher, cache Cache, opts CacheOptions) Fetcher {
+	return &cachingFetcher{fetcher: fetcher, cache: cache, opts: opts}
+}
+
+// Fetch implements the Fetcher interface
+func (f *cachingFetcher) Fetch(ctx context.Context, rawURL string) (*Link, error) {
+	if link, ok := f.cache.Get(rawURL); ok {
+		return link, nil
+	}
+
+	link, err := f.fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	f.cache.Set(rawURL, link, f.ttl(link))
+	return link, nil
+}
+
+// ttl returns how long a link can be cached
+func (f *cachingFetcher) ttl(link *Link) time.Duration {
+	ttl := f.opts.DefaultTTL
+	if link.CacheAge > 0 {
+		ttl = time.Duration(link.CacheAge) * time.Second
+	}
+	if f.opts.MaxTTL > 0 && ttl > f.opts.MaxTTL {
+		ttl = f.opts.MaxTTL
+	}
+	return ttl
+}
@@ -0,0 +1,128 @@
+package oembed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/bookmarks/blobs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(2, nil, testLogger())
+
+	c.Set("https://vimeo.com/1", &Link{Title: "1"}, time.Hour)
+	c.Set("https://vimeo.com/2", &Link{Title: "2"}, time.Hour)
+	// 1 becomes the most recently used
+	_, ok := c.Get("https://vimeo.com/1")
+	assert.True(t, ok)
+	c.Set("https://vimeo.com/3", &Link{Title: "3"}, time.Hour)
+
+	_, ok = c.Get("https://vimeo.com/2")
+	assert.False(t, ok)
+	link, ok := c.Get("https://vimeo.com/1")
+	if assert.True(t, ok) {
+		assert.Equal(t, "1", link.Title)
+	}
+	_, ok = c.Get("https://vimeo.com/3")
+	assert.True(t, ok)
+}
+
+func TestCacheExpiration(t *testing.T) {
+	c := NewCache(10, nil, testLogger())
+
+	c.Set("https://vimeo.com/1", &Link{Title: "1"}, 10*time.Millisecond)
+	c.Set("https://vimeo.com/2", &Link{Title: "2"}, 0)
+
+	_, ok := c.Get("https://vimeo.com/1")
+	assert.True(t, ok)
+	_, ok = c.Get("https://vimeo.com/2")
+	assert.False(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = c.Get("https://vimeo.com/1")
+	assert.False(t, ok)
+}
+
+func TestCacheReturnsCopies(t *testing.T) {
+	c := NewCache(10, nil, testLogger())
+
+	link := &Link{Title: "1"}
+	c.Set("https://vimeo.com/1", link, time.Hour)
+	link.Title = "modified"
+
+	cached, _ := c.Get("https://vimeo.com/1")
+	assert.Equal(t, "1", cached.Title)
+	cached.Title = "modified"
+
+	cached, _ = c.Get("https://vimeo.com/1")
+	assert.Equal(t, "1", cached.Title)
+}
+
+func TestCachePersistentStore(t *testing.T) {
+	store := blobs.NewMemoryStore()
+
+	c := NewCache(1, store, testLogger())
+	c.Set("https://vimeo.com/1", &Link{Title: "1", Width: 640, CacheAge: 3600}, time.Hour)
+	c.Set("https://vimeo.com/2", &Link{Title: "2"}, 10*time.Millisecond)
+
+	// evicted from memory but still in the store
+	link, ok := c.Get("https://vimeo.com/1")
+	if assert.True(t, ok) {
+		assert.Equal(t, &Link{Title: "1", Width: 640, CacheAge: 3600}, link)
+	}
+
+	// like after a restart
+	c = NewCache(1, store, testLogger())
+	_, ok = c.Get("https://vimeo.com/1")
+	assert.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = c.Get("https://vimeo.com/2")
+	assert.False(t, ok)
+	// expired entries are deleted
+	_, err := store.Get(persistedKey("https://vimeo.com/2"))
+	assert.IsType(t, &blobs.NotFoundError{}, err)
+}
+
+// countingFetcher returns the same link or error for every URL and counts the calls
+type countingFetcher struct {
+	link  *Link
+	err   error
+	calls map[string]int
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, rawURL string) (*Link, error) {
+	f.calls[rawURL]++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.link, nil
+}
+
+func TestCachingFetcher(t *testing.T) {
+	stub := &countingFetcher{link: &Link{Title: "1"}, calls: map[string]int{}}
+	f := NewCachingFetcher(stub, NewCache(10, nil, testLogger()), CacheOptions{DefaultTTL: time.Hour, MaxTTL: 24 * time.Hour})
+
+	for i := 0; i < 2; i++ {
+		link, err := f.Fetch(context.Background(), "https://vimeo.com/1")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", link.Title)
+	}
+	assert.Equal(t, 1, stub.calls["https://vimeo.com/1"])
+
+	// errors are not cached
+	stub.err = errors.New("provider returned a 503 status code")
+	for i := 0; i < 2; i++ {
+		_, err := f.Fetch(context.Background(), "https://vimeo.com/4")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, stub.calls["https://vimeo.com/4"])
+
+	cf := f.(*cachingFetcher)
+	assert.Equal(t, time.Hour, cf.ttl(&Link{}))
+	assert.Equal(t, time.Second, cf.ttl(&Link{CacheAge: 1}))
+	assert.Equal(t, 24*time.Hour, cf.ttl(&Link{CacheAge: 1000000}))
+}
@@ -0,0 +1,37 @@
+package oembed
+
+import "context"
+
+// chainFetcher tries several fetchers in order
+type chainFetcher struct {
+	fetchers []Fetcher
+}
+
+// NewChainFetcher returns a fetcher trying each fetcher in order until one knows the URL
+// Other errors stop the chain, including a provider saying the content does not exist. The next fetcher would most likely give worse results
+// than the failing one, so it's better to retry later
+func NewChainFetcher(fetchers ...Fetcher) Fetcher {
+	return &chainFetcher{fetchers: fetchers}
+}
+
+// Fetch implements the Fetcher interface
+func (f *chainFetcher) Fetch(ctx context.Context, rawURL string) (*Link, error) {
+	var err error = &UnknownProviderError{URL: rawURL}
+
+	for _, fetcher := range f.fetchers {
+		var link *Link
+		link, err = fetcher.Fetch(ctx, rawURL)
+		if !isUnknownURL(err) {
+			return link, err
+		}
+	}
+
+	return nil, err
+}
+
+// isUnknownURL tells if a fetcher does not know an URL, so that another one can be tried
+// A NotFoundError is an answer: the page of a deleted video should not be used instead
+func isUnknownURL(err error) bool {
+	_, ok := err.(*UnknownProviderError)
+	return ok
+}
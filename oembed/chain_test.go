@@ -0,0 +1,50 @@
+package oembed
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubFetcher struct {
+	link *Link
+	err  error
+}
+
+func (f stubFetcher) Fetch(ctx context.Context, rawURL string) (*Link, error) {
+	return f.link, f.err
+}
+
+func TestChainFetcher(t *testing.T) {
+	notFound := stubFetcher{err: &NotFoundError{}}
+	unknown := stubFetcher{err: &UnknownProviderError{URL: "https://example.com"}}
+	failing := stubFetcher{err: errors.New("provider returned a 500 status code")}
+	first := stubFetcher{link: &Link{Title: "first"}}
+	second := stubFetcher{link: &Link{Title: "second"}}
+
+	link, err := NewChainFetcher(first, second).Fetch(context.Background(), "https://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "first", link.Title)
+
+	link, err = NewChainFetcher(unknown, second).Fetch(context.Background(), "https://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", link.Title)
+
+	// other errors stop the chain
+	_, err = NewChainFetcher(failing, second).Fetch(context.Background(), "https://example.com")
+	assert.Equal(t, failing.err, err)
+
+	_, err = NewChainFetcher(notFound, second).Fetch(context.Background(), "https://example.com")
+	assert.Equal(t, notFound.err, err)
+
+	_, err = NewChainFetcher(unknown, notFound).Fetch(context.Background(), "https://example.com")
+	assert.IsType(t, &NotFoundError{}, err)
+
+	_, err = NewChainFetcher(unknown, unknown).Fetch(context.Background(), "https://example.com")
+	assert.IsType(t, &UnknownProviderError{}, err)
+
+	_, err = NewChainFetcher().Fetch(context.Background(), "https://example.com")
+	assert.IsType(t, &UnknownProviderError{}, err)
+}
@@ -0,0 +1,46 @@
+package oembed
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CustomProvider is a provider declared by the operator, like an internal video portal
+// that is not part of the public registry
+type CustomProvider struct {
+	Name string `json:"name"`
+	// Schemes are the supported URLs. Wildcards are allowed (https://videos.example.com/watch/*)
+	Schemes []string `json:"schemes"`
+	// Endpoint is the URL of the oEmbed API
+	Endpoint string `json:"endpoint"`
+	// AuthHeader is sent as the Authorization header of API calls. Optional
+	AuthHeader string `json:"auth_header,omitempty"`
+}
+
+// customProviderSet validates custom providers and converts them to a provider set
+func customProviderSet(custom []CustomProvider) (*providerSet, error) {
+	definitions := make([]ProviderDefinition, 0, len(custom))
+	for i, p := range custom {
+		switch {
+		case p.Name == "":
+			return nil, fmt.Errorf("custom provider #%d: name is required", i+1)
+		case p.Endpoint == "":
+			return nil, fmt.Errorf("custom provider %s: endpoint is required", p.Name)
+		case len(p.Schemes) == 0:
+			// the library would match the whole site of the endpoint, which is never what we want
+			return nil, fmt.Errorf("custom provider %s: at least one scheme is required", p.Name)
+		}
+
+		definitions = append(definitions, ProviderDefinition{
+			Name:      p.Name,
+			Endpoints: []EndpointDefinition{{URL: p.Endpoint, Schemes: p.Schemes}},
+		})
+	}
+
+	raw, err := json.Marshal(definitions)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseProviders(raw)
+}
@@ -0,0 +1,87 @@
+package oembed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testProvider returns an oEmbed API returning its name as title
+// It records the Authorization header of the last call
+func testProvider(name string, authorization *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorization = r.Header.Get("Authorization")
+		fmt.Fprintf(w, `{"type": "video", "title": %q, "url": %q}`, name, r.URL.Query().Get("url"))
+	}))
+}
+
+func TestFetcherWithCustomProviders(t *testing.T) {
+	var publicAuth, customAuth string
+	public := testProvider("public", &publicAuth)
+	defer public.Close()
+	custom := testProvider("custom", &customAuth)
+	defer custom.Close()
+
+	source := filepath.Join(t.TempDir(), "providers.json")
+	writeFile(t, source, fmt.Sprintf(`[
+		{"provider_name": "Public", "endpoints": [{"schemes": ["https://videos.example.com/*", "https://vimeo.com/*"], "url": %q}]}
+	]`, public.URL))
+	reg, err := NewRegistry(RegistryOptions{Source: source}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	f, err := NewFetcher(reg, []CustomProvider{{
+		Name:       "Internal",
+		Schemes:    []string{"https://videos.example.com/*"},
+		Endpoint:   custom.URL,
+		AuthHeader: "Bearer secret",
+	}}, noRateLimit, testLogger(), DefaultFetcherOptions)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// custom providers take precedence
+	link, err := f.Fetch(context.Background(), "https://videos.example.com/watch?v=1&t=2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "custom", link.Title)
+		assert.Equal(t, "https://videos.example.com/watch?v=1&t=2", link.URL)
+	}
+	assert.Equal(t, "Bearer secret", customAuth)
+
+	// other URLs still use the registry, without the custom auth header
+	link, err = f.Fetch(context.Background(), "https://vimeo.com/123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "public", link.Title)
+	}
+	assert.Equal(t, "", publicAuth)
+
+	_, err = f.Fetch(context.Background(), "https://unknown.example.com/123")
+	assert.IsType(t, &UnknownProviderError{}, err)
+}
+
+func TestFetcherRejectsInvalidCustomProviders(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "providers.json")
+	writeFile(t, source, testProviders)
+	reg, err := NewRegistry(RegistryOptions{Source: source}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	invalid := []CustomProvider{
+		{Schemes: []string{"https://videos.example.com/*"}, Endpoint: "https://videos.example.com/oembed"},
+		{Name: "Internal", Schemes: []string{"https://videos.example.com/*"}},
+		{Name: "Internal", Endpoint: "https://videos.example.com/oembed"},
+		{Name: "Internal", Schemes: []string{"https://videos.example.com/(*"}, Endpoint: "https://videos.example.com/oembed"},
+	}
+
+	for _, p := range invalid {
+		_, err := NewFetcher(reg, []CustomProvider{p}, noRateLimit, testLogger(), DefaultFetcherOptions)
+		assert.Error(t, err, "%+v", p)
+	}
+}
@@ -0,0 +1,200 @@
+package oembed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fchoquet/bookmarks/safehttp"
+)
+
+// Errors returned by fetchers tell whether trying again later could help
+// Unknown errors are considered as retryable
+
+// retryable is implemented by the errors of this package
+type retryable interface {
+	Retryable() bool
+}
+
+// IsRetryable tells if a fetch failing with err might succeed later
+func IsRetryable(err error) bool {
+	if r, ok := err.(retryable); ok {
+		return r.Retryable()
+	}
+	return true
+}
+
+// UnknownProviderError is returned when no provider supports an URL
+type UnknownProviderError struct {
+	URL    string
+	Reason string
+}
+
+// Error implements the Error interface
+func (err *UnknownProviderError) Error() string {
+	if err.Reason != "" {
+		return fmt.Sprintf("no oEmbed provider supports %s: %s", err.URL, err.Reason)
+	}
+	return fmt.Sprintf("no oEmbed provider supports %s", err.URL)
+}
+
+// Retryable implements the retryable interface
+func (err *UnknownProviderError) Retryable() bool {
+	return false
+}
+
+// NotFoundError is retured when the provider does not know an URL (404 or 410)
+type NotFoundError struct {
+	err error
+}
+
+// Error implements the Error interface
+func (err *NotFoundError) Error() string {
+	if err.err == nil {
+		return "URL not found"
+	}
+	return err.err.Error()
+}
+
+// Retryable implements the retryable interface
+func (err *NotFoundError) Retryable() bool {
+	return false
+}
+
+// UnauthorizedError is returned when the provider refuses to describe an URL (401 or 403)
+// This is usually private content
+type UnauthorizedError struct {
+	StatusCode int
+}
+
+// Error implements the Error interface
+func (err *UnauthorizedError) Error() string {
+	return fmt.Sprintf("provider returned a %d status code: the content is private", err.StatusCode)
+}
+
+// Retryable implements the retryable interface
+func (err *UnauthorizedError) Retryable() bool {
+	return false
+}
+
+// FormatNotImplementedError is returned when the provider supports neither JSON nor XML (501)
+type FormatNotImplementedError struct{}
+
+// Error implements the Error interface
+func (err *FormatNotImplementedError) Error() string {
+	return "provider returned a 501 status code: format not implemented"
+}
+
+// Retryable implements the retryable interface
+func (err *FormatNotImplementedError) Retryable() bool {
+	return false
+}
+
+// TimeoutError is returned when the provider takes too long to answer
+type TimeoutError struct {
+	URL string
+}
+
+// Error implements the Error interface
+func (err *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout while calling %s", err.URL)
+}
+
+// Retryable implements the retryable interface
+func (err *TimeoutError) Retryable() bool {
+	return true
+}
+
+// MalformedResponseError is returned when the response of the provider cannot be parsed
+type MalformedResponseError struct {
+	err error
+}
+
+// Error implements the Error interface
+func (err *MalformedResponseError) Error() string {
+	return fmt.Sprintf("malformed oEmbed response: %s", err.err)
+}
+
+// Retryable implements the retryable interface
+// Providers do not fix their responses overnight
+func (err *MalformedResponseError) Retryable() bool {
+	return false
+}
+
+// ProviderError is returned when the provider cannot be reached or fails
+// StatusCode is zero if no response was received
+type ProviderError struct {
+	StatusCode int
+	err        error
+}
+
+// Error implements the Error interface
+func (err *ProviderError) Error() string {
+	if err.StatusCode == 0 {
+		return fmt.Sprintf("provider unreachable: %s", err.err)
+	}
+	return fmt.Sprintf("provider returned a %d status code", err.StatusCode)
+}
+
+// Retryable implements the retryable interface
+// Server errors are usually transient. Client errors are not
+func (err *ProviderError) Retryable() bool {
+	return err.StatusCode == 0 || err.StatusCode >= 500
+}
+
+// transportError converts the error of an HTTP call
+// The error of the context is returned as is when it is done, so that callers can tell
+// a cancellation from a failure of the provider
+func transportError(ctx context.Context, rawURL string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return &TimeoutError{URL: rawURL}
+	}
+	// pages on the private network are not bookmarks we can describe
+	var forbidden *safehttp.ForbiddenAddressError
+	if errors.As(err, &forbidden) {
+		return &UnknownProviderError{URL: rawURL, Reason: forbidden.Error()}
+	}
+	return &ProviderError{err: err}
+}
+
+// statusError converts an unsuccessful status code. It returns nil for successful ones
+func statusError(res *http.Response, provider string) error {
+	switch code := res.StatusCode; {
+	case code < 300:
+		return nil
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return &NotFoundError{}
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &UnauthorizedError{StatusCode: code}
+	case code == http.StatusNotImplemented:
+		return &FormatNotImplementedError{}
+	case code == http.StatusTooManyRequests:
+		return &RateLimitError{Provider: provider, RetryAfter: retryAfter(res.Header.Get("Retry-After"))}
+	default:
+		return &ProviderError{StatusCode: code}
+	}
+}
+
+// defaultRetryAfter is used when a provider does not tell when to call it again
+const defaultRetryAfter = time.Minute
+
+// retryAfter parses a Retry-After header: either a number of seconds or a date
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
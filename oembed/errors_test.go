@@ -0,0 +1,104 @@
+package oembed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusError(t *testing.T) {
+	fixtures := []struct {
+		code      int
+		expected  error
+		retryable bool
+	}{
+		{200, nil, false},
+		{404, &NotFoundError{}, false},
+		{410, &NotFoundError{}, false},
+		{401, &UnauthorizedError{StatusCode: 401}, false},
+		{403, &UnauthorizedError{StatusCode: 403}, false},
+		{501, &FormatNotImplementedError{}, false},
+		{429, &RateLimitError{Provider: "Vimeo", RetryAfter: 2 * time.Second}, true},
+		{400, &ProviderError{StatusCode: 400}, false},
+		{503, &ProviderError{StatusCode: 503}, true},
+	}
+
+	for _, fixture := range fixtures {
+		res := &http.Response{StatusCode: fixture.code, Header: http.Header{"Retry-After": []string{"2"}}}
+		err := statusError(res, "Vimeo")
+		assert.Equal(t, fixture.expected, err, "%d", fixture.code)
+		if err != nil {
+			assert.Equal(t, fixture.retryable, IsRetryable(err), "%d", fixture.code)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, retryAfter("120"))
+	assert.Equal(t, defaultRetryAfter, retryAfter(""))
+	assert.Equal(t, defaultRetryAfter, retryAfter("soon"))
+	assert.Equal(t, time.Duration(0), retryAfter("Mon, 02 Jan 2006 15:04:05 GMT"))
+
+	d := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Hour, d, float64(2*time.Second))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(errors.New("unknown")))
+	assert.True(t, IsRetryable(&TimeoutError{URL: "https://vimeo.com/1"}))
+	assert.True(t, IsRetryable(&ProviderError{err: errors.New("connection refused")}))
+	assert.False(t, IsRetryable(&UnknownProviderError{URL: "https://example.com"}))
+	assert.False(t, IsRetryable(&MalformedResponseError{err: errors.New("unexpected EOF")}))
+}
+
+func TestFetcherErrors(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("url") {
+		case "https://videos.example.com/private":
+			w.WriteHeader(http.StatusForbidden)
+		case "https://videos.example.com/busy":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "https://videos.example.com/malformed":
+			fmt.Fprint(w, `{"type": "video", "title":`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer provider.Close()
+
+	source := filepath.Join(t.TempDir(), "providers.json")
+	writeFile(t, source, fmt.Sprintf(`[
+		{"provider_name": "Example", "endpoints": [{"schemes": ["https://videos.example.com/*"], "url": %q}]}
+	]`, provider.URL))
+	reg, err := NewRegistry(RegistryOptions{Source: source}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	f, err := NewFetcher(reg, nil, noRateLimit, testLogger(), DefaultFetcherOptions)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, err = f.Fetch(context.Background(), "https://videos.example.com/private")
+	assert.Equal(t, &UnauthorizedError{StatusCode: 403}, err)
+
+	_, err = f.Fetch(context.Background(), "https://videos.example.com/busy")
+	assert.Equal(t, &RateLimitError{Provider: "Example", RetryAfter: 30 * time.Second}, err)
+
+	_, err = f.Fetch(context.Background(), "https://videos.example.com/malformed")
+	assert.IsType(t, &MalformedResponseError{}, err)
+
+	_, err = f.Fetch(context.Background(), "https://videos.example.com/deleted")
+	assert.IsType(t, &NotFoundError{}, err)
+
+	_, err = f.Fetch(context.Background(), "https://unknown.example.com/1")
+	assert.IsType(t, &UnknownProviderError{}, err)
+}
@@ -0,0 +1,430 @@
+package oembed
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fchoquet/bookmarks/safehttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxPageSize is the number of bytes read from a page. Metadata are in the head anyway
+const maxPageSize = 1 << 20
+
+// pageClient is the default client of the HTML fetcher. Unlike providers, pages are at
+// URLs supplied by users so private addresses are refused
+var pageClient = safehttp.NewClient(10 * time.Second)
+
+// htmlFetcher extracts properties from the metadata of a page
+// It is a fallback for sites that are not oEmbed providers (blogs, news...)
+type htmlFetcher struct {
+	limiter RateLimiter
+	client  *http.Client
+	logger  log.FieldLogger
+}
+
+// NewHTMLFetcher returns a fetcher reading the page itself instead of an oEmbed API
+// It uses the oEmbed discovery links of the page when there are some, then OpenGraph and
+// Twitter Card metadata, then the title of the page
+// Sites are not providers so calls are rate limited by host
+func NewHTMLFetcher(limiter RateLimiter, logger log.FieldLogger, opts FetcherOptions) Fetcher {
+	client := opts.Client
+	if client == nil {
+		client = pageClient
+	}
+	return &htmlFetcher{limiter: limiter, client: client, logger: logger}
+}
+
+// Fetch implements the Fetcher interface
+func (f *htmlFetcher) Fetch(ctx context.Context, rawURL string) (*Link, error) {
+	pageURL, err := safehttp.CheckURL(rawURL)
+	if err != nil {
+		return nil, &UnknownProviderError{URL: rawURL, Reason: "not a web page"}
+	}
+
+	if err := f.limiter.Wait(ctx, pageURL.Host); err != nil {
+		return nil, err
+	}
+
+	f.logger.WithField("url", rawURL).Info("fetching page...")
+
+	page, finalURL, err := f.fetchPage(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := parseHTMLMeta(page)
+	link := meta.link()
+	if thumbnail, err := finalURL.Parse(link.ThumbnailURL); err == nil && link.ThumbnailURL != "" {
+		link.ThumbnailURL = thumbnail.String()
+	}
+	if webPage, err := finalURL.Parse(link.WebPage); err == nil && link.WebPage != "" {
+		link.WebPage = webPage.String()
+	}
+
+	if meta.oembedURL != "" {
+		discovered, err := f.discover(ctx, finalURL, meta.oembedURL)
+		if err == nil {
+			return mergeLinks(discovered, link), nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// the page metadata are still better than nothing
+		f.logger.WithError(err).WithField("url", meta.oembedURL).Warning("oEmbed discovery failed")
+	}
+
+	return link, nil
+}
+
+// discover calls the oEmbed endpoint advertised by a page
+func (f *htmlFetcher) discover(ctx context.Context, pageURL *url.URL, href string) (*Link, error) {
+	endpoint, err := pageURL.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := safehttp.CheckURL(endpoint.String()); err != nil {
+		return nil, err
+	}
+
+	if err := f.limiter.Wait(ctx, endpoint.Host); err != nil {
+		return nil, err
+	}
+
+	body, contentType, err := apiCall(ctx, f.client, endpoint.Host, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLink(body, contentType)
+}
+
+// fetchPage downloads an HTML page. It returns the URL of the page after redirects
+func (f *htmlFetcher) fetchPage(ctx context.Context, rawURL string) (string, *url.URL, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return "", nil, transportError(ctx, rawURL, err)
+	}
+	defer res.Body.Close()
+
+	if err := statusError(res, req.URL.Host); err != nil {
+		return "", nil, err
+	}
+
+	// PDFs, images... have no metadata that we can read
+	if contentType := res.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+			return "", nil, &UnknownProviderError{URL: rawURL, Reason: fmt.Sprintf("unsupported content type %s", contentType)}
+		}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxPageSize))
+	if err != nil {
+		return "", nil, transportError(ctx, rawURL, err)
+	}
+
+	return string(body), res.Request.URL, nil
+}
+
+// mergeLinks completes a link with the properties of another one
+func mergeLinks(link, fallback *Link) *Link {
+	if link.Type == "" {
+		link.Type = fallback.Type
+	}
+	if link.Provider == "" {
+		link.Provider = fallback.Provider
+	}
+	if link.Title == "" {
+		link.Title = fallback.Title
+	}
+	if link.AuthorName == "" {
+		link.AuthorName = fallback.AuthorName
+	}
+	if link.Width == 0 {
+		link.Width = fallback.Width
+	}
+	if link.Height == 0 {
+		link.Height = fallback.Height
+	}
+	if link.Duration == 0 {
+		link.Duration = fallback.Duration
+	}
+	if link.ThumbnailURL == "" {
+		link.ThumbnailURL = fallback.ThumbnailURL
+		link.ThumbnailWidth = fallback.ThumbnailWidth
+		link.ThumbnailHeight = fallback.ThumbnailHeight
+	}
+	if link.WebPage == "" {
+		link.WebPage = fallback.WebPage
+	}
+	return link
+}
+
+// htmlMeta holds the metadata found in the head of a page
+type htmlMeta struct {
+	title string
+	// content of the meta tags by lowercased property or name. The first one wins
+	meta map[string]string
+	// href of the oEmbed discovery link. JSON is preferred over XML
+	oembedURL string
+	isJSON    bool
+	// href of the canonical link
+	canonicalURL string
+}
+
+// link converts the metadata to a link. OpenGraph wins over Twitter Card which wins over plain HTML
+func (m htmlMeta) link() *Link {
+	l := &Link{
+		Type:         LinkTypeLink,
+		Provider:     Provider(m.first("og:site_name")),
+		Title:        m.first("og:title", "twitter:title"),
+		AuthorName:   m.first("author", "twitter:creator"),
+		ThumbnailURL: m.first("og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src"),
+		Duration:     m.int("og:video:duration", "video:duration"),
+		WebPage:      m.first("og:url"),
+	}
+	if l.ThumbnailURL != "" {
+		l.ThumbnailWidth = StringInt(m.int("og:image:width"))
+		l.ThumbnailHeight = StringInt(m.int("og:image:height"))
+	}
+
+	if l.Title == "" {
+		l.Title = m.title
+	}
+	if l.WebPage == "" {
+		l.WebPage = m.canonicalURL
+	}
+
+	ogType := m.first("og:type")
+	twitterCard := m.first("twitter:card")
+	switch {
+	case strings.HasPrefix(ogType, "video"), twitterCard == "player":
+		l.Type = LinkTypeVideo
+		l.Width = StringInt(m.int("og:video:width", "twitter:player:width"))
+		l.Height = StringInt(m.int("og:video:height", "twitter:player:height"))
+	case twitterCard == "photo":
+		l.Type = LinkTypePhoto
+		l.Width = StringInt(m.int("og:image:width"))
+		l.Height = StringInt(m.int("og:image:height"))
+	}
+
+	return l
+}
+
+// first returns the first non-empty metadata among keys
+func (m htmlMeta) first(keys ...string) string {
+	for _, key := range keys {
+		if value := m.meta[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// int returns the first metadata among keys that is a number, or zero
+func (m htmlMeta) int(keys ...string) int {
+	for _, key := range keys {
+		if value, err := strconv.Atoi(m.meta[key]); err == nil {
+			return value
+		}
+	}
+	return 0
+}
+
+// parseHTMLMeta extracts the metadata of a page
+// This is not a full HTML parser. It only reads the tags we are interested in and
+// tolerates broken markup, which is the norm on the web
+func parseHTMLMeta(page string) htmlMeta {
+	m := htmlMeta{meta: map[string]string{}}
+	lower := asciiLower(page)
+
+	for i := 0; i < len(page); {
+		lt := strings.IndexByte(page[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+
+		if strings.HasPrefix(page[i:], "<!--") {
+			end := strings.Index(page[i:], "-->")
+			if end < 0 {
+				break
+			}
+			i += end + len("-->")
+			continue
+		}
+
+		name, attrs, next := parseTag(page, i)
+		i = next
+
+		switch name {
+		case "meta":
+			key := asciiLower(strings.TrimSpace(attrs["property"]))
+			if key == "" {
+				key = asciiLower(strings.TrimSpace(attrs["name"]))
+			}
+			if _, ok := m.meta[key]; key != "" && !ok {
+				m.meta[key] = strings.TrimSpace(attrs["content"])
+			}
+		case "link":
+			if hasToken(attrs["rel"], "canonical") && m.canonicalURL == "" {
+				m.canonicalURL = strings.TrimSpace(attrs["href"])
+			}
+			if m.isJSON || !hasToken(attrs["rel"], "alternate") {
+				break
+			}
+			switch asciiLower(strings.TrimSpace(attrs["type"])) {
+			case "application/json+oembed":
+				m.oembedURL, m.isJSON = strings.TrimSpace(attrs["href"]), true
+			case "text/xml+oembed":
+				if m.oembedURL == "" {
+					m.oembedURL = strings.TrimSpace(attrs["href"])
+				}
+			}
+		case "title":
+			end := strings.Index(lower[i:], "</title")
+			if end < 0 {
+				break
+			}
+			if m.title == "" {
+				m.title = strings.Join(strings.Fields(html.UnescapeString(page[i:i+end])), " ")
+			}
+			i += end
+		case "script", "style":
+			// their content might contain anything, including tags
+			end := strings.Index(lower[i:], "</"+name)
+			if end < 0 {
+				return m
+			}
+			i += end
+		case "body":
+			// metadata are in the head
+			return m
+		}
+	}
+
+	return m
+}
+
+// parseTag parses the tag starting at page[start]
+// It returns its lowercased name, its attributes and the position following the tag
+// Closing tags, doctypes and processing instructions have no name
+func parseTag(page string, start int) (string, map[string]string, int) {
+	i := start + 1
+	if i >= len(page) || !isASCIILetter(page[i]) {
+		end := strings.IndexByte(page[i:], '>')
+		if end < 0 {
+			return "", nil, len(page)
+		}
+		return "", nil, i + end + 1
+	}
+
+	nameStart := i
+	for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '>' && page[i] != '/' {
+		i++
+	}
+	name := asciiLower(page[nameStart:i])
+
+	attrs := map[string]string{}
+	for i < len(page) {
+		for i < len(page) && (isHTMLSpace(page[i]) || page[i] == '/') {
+			i++
+		}
+		if i >= len(page) {
+			break
+		}
+		if page[i] == '>' {
+			return name, attrs, i + 1
+		}
+
+		attrStart := i
+		for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '=' && page[i] != '>' && page[i] != '/' {
+			i++
+		}
+		attr := asciiLower(page[attrStart:i])
+
+		for i < len(page) && isHTMLSpace(page[i]) {
+			i++
+		}
+		if i >= len(page) || page[i] != '=' {
+			if _, ok := attrs[attr]; !ok {
+				attrs[attr] = ""
+			}
+			continue
+		}
+		i++
+		for i < len(page) && isHTMLSpace(page[i]) {
+			i++
+		}
+
+		var value string
+		if i < len(page) && (page[i] == '"' || page[i] == '\'') {
+			quote := page[i]
+			end := strings.IndexByte(page[i+1:], quote)
+			if end < 0 {
+				return name, attrs, len(page)
+			}
+			value = page[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			valueStart := i
+			for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '>' {
+				i++
+			}
+			value = page[valueStart:i]
+		}
+
+		// HTML keeps the first occurrence of an attribute
+		if _, ok := attrs[attr]; !ok {
+			attrs[attr] = html.UnescapeString(value)
+		}
+	}
+
+	return name, attrs, len(page)
+}
+
+// hasToken tells if a space separated list contains a token, ignoring case
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// asciiLower lowercases ASCII letters only so that positions are preserved
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
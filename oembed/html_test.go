@@ -0,0 +1,171 @@
+package oembed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHTMLMeta(t *testing.T) {
+	page := `<!DOCTYPE html>
+<HTML>
+<head>
+	<meta charset="utf-8">
+	<TITLE>
+		Fallback   &amp; title
+	</TITLE>
+	<!-- <meta property="og:title" content="commented out"> -->
+	<script>var s = "<meta property='og:title' content='in a script'>";</script>
+	<meta property="og:title" content="Design &quot;patterns&quot;" />
+	<meta property='og:title' content='second one is ignored'>
+	<meta name=author content=Jane>
+	<meta name="twitter:card" content="summary">
+	<Link REL="alternate shortlink" type="application/json+oembed" href="/oembed?url=x">
+	<link rel="canonical" href="/article">
+</head>
+<body>
+	<meta property="og:site_name" content="in the body">
+</body>
+</HTML>`
+
+	m := parseHTMLMeta(page)
+	assert.Equal(t, "Fallback & title", m.title)
+	assert.Equal(t, `Design "patterns"`, m.meta["og:title"])
+	assert.Equal(t, "Jane", m.meta["author"])
+	assert.Equal(t, "summary", m.meta["twitter:card"])
+	assert.Equal(t, "/oembed?url=x", m.oembedURL)
+	assert.Equal(t, "/article", m.canonicalURL)
+	assert.NotContains(t, m.meta, "og:site_name")
+}
+
+func TestParseHTMLMetaToleratesBrokenMarkup(t *testing.T) {
+	for _, page := range []string{
+		``,
+		`<`,
+		`<meta property="og:title" content="unclosed`,
+		`<title>no end`,
+		`<!-- unclosed comment`,
+		`<script>no end`,
+		`< title>not a tag</title>`,
+	} {
+		assert.NotPanics(t, func() { parseHTMLMeta(page) }, page)
+	}
+}
+
+func TestHTMLMetaLink(t *testing.T) {
+	fixtures := []struct {
+		meta     htmlMeta
+		expected Link
+	}{
+		{
+			htmlMeta{title: "Page title", meta: map[string]string{}},
+			Link{Type: LinkTypeLink, Title: "Page title"},
+		},
+		{
+			htmlMeta{title: "Page title", canonicalURL: "https://example.com/canonical", meta: map[string]string{}},
+			Link{Type: LinkTypeLink, Title: "Page title", WebPage: "https://example.com/canonical"},
+		},
+		{
+			htmlMeta{canonicalURL: "https://example.com/canonical", meta: map[string]string{
+				"og:url": "https://example.com/og",
+			}},
+			Link{Type: LinkTypeLink, WebPage: "https://example.com/og"},
+		},
+		{
+			htmlMeta{title: "Page title", meta: map[string]string{
+				"twitter:title": "Twitter title",
+				"twitter:image": "https://example.com/t.jpg",
+				"og:site_name":  "Example",
+			}},
+			Link{Type: LinkTypeLink, Title: "Twitter title", Provider: "Example", ThumbnailURL: "https://example.com/t.jpg"},
+		},
+		{
+			htmlMeta{meta: map[string]string{
+				"og:type":           "video.other",
+				"og:title":          "OG title",
+				"twitter:title":     "Twitter title",
+				"og:video:width":    "1280",
+				"og:video:height":   "720",
+				"og:video:duration": "95",
+			}},
+			Link{Type: LinkTypeVideo, Title: "OG title", Width: 1280, Height: 720, Duration: 95},
+		},
+		{
+			htmlMeta{meta: map[string]string{
+				"twitter:card":    "photo",
+				"og:image:width":  "not a number",
+				"og:image:height": "600",
+			}},
+			Link{Type: LinkTypePhoto, Height: 600},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		assert.Equal(t, fixture.expected, *fixture.meta.link())
+	}
+}
+
+func TestHTMLFetcher(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>An article</title><meta property="og:image" content="/cover.jpg">
+			<link rel="canonical" href="/article?page=1"></head></html>`)
+	})
+	mux.HandleFunc("/video", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>A video</title><meta property="og:image" content="/cover.jpg">
+			<link rel="alternate" type="application/json+oembed" href="/oembed"></head></html>`)
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "video", "title": "Discovered video", "width": 640}`)
+	})
+	mux.HandleFunc("/broken-discovery", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Broken</title><link rel="alternate" type="application/json+oembed" href="/missing"></head></html>`)
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		fmt.Fprint(w, `%PDF`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := NewHTMLFetcher(noRateLimit, testLogger(), FetcherOptions{Client: server.Client()})
+
+	link, err := f.Fetch(context.Background(), server.URL+"/article")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "An article", link.Title)
+		assert.Equal(t, LinkTypeLink, link.Type)
+		assert.Equal(t, server.URL+"/cover.jpg", link.ThumbnailURL)
+		assert.Equal(t, server.URL+"/article?page=1", link.WebPage)
+	}
+
+	link, err = f.Fetch(context.Background(), server.URL+"/video")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Discovered video", link.Title)
+		assert.Equal(t, LinkTypeVideo, link.Type)
+		assert.Equal(t, StringInt(640), link.Width)
+		// completed with the page metadata
+		assert.Equal(t, server.URL+"/cover.jpg", link.ThumbnailURL)
+	}
+
+	link, err = f.Fetch(context.Background(), server.URL+"/broken-discovery")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Broken", link.Title)
+	}
+
+	_, err = f.Fetch(context.Background(), server.URL+"/not-found")
+	assert.IsType(t, &NotFoundError{}, err)
+
+	_, err = f.Fetch(context.Background(), server.URL+"/file.pdf")
+	assert.IsType(t, &UnknownProviderError{}, err)
+
+	_, err = f.Fetch(context.Background(), "ftp://example.com/file")
+	assert.IsType(t, &UnknownProviderError{}, err)
+
+	// the default client does not call the private network
+	_, err = NewHTMLFetcher(noRateLimit, testLogger(), DefaultFetcherOptions).Fetch(context.Background(), server.URL+"/article")
+	assert.IsType(t, &UnknownProviderError{}, err)
+}
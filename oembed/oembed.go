@@ -1,13 +1,17 @@
 package oembed
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/dyatlov/go-oembed/oembed"
@@ -23,6 +27,10 @@ type LinkType string
 const (
 	LinkTypePhoto LinkType = "photo"
 	LinkTypeVideo LinkType = "video"
+	// A plain web page
+	LinkTypeLink LinkType = "link"
+	// Generic embedded HTML
+	LinkTypeRich LinkType = "rich"
 )
 
 // Provider represents an oEmbed provider (Flickr, Vimeo, etc)
@@ -37,21 +45,59 @@ const (
 )
 
 // Link reprensents the result of an oEmbed query
-// We do not implement all possible properties here but only the ones used in this project
+// It holds all the properties of the oEmbed 1.0 spec (https://oembed.com/#section2.3)
+// plus the non-standard duration returned by some video providers
+// Responses are either JSON or XML
 type Link struct {
-	URL        string    `json:"url"`
-	Type       LinkType  `json:"type"`
-	Provider   Provider  `json:"provider"`
-	Title      string    `json:"title"`
-	AuthorName string    `json:"author_name"`
-	Width      StringInt `json:"width"`
-	Height     StringInt `json:"height"`
-	Duration   int       `json:"duration"`
+	XMLName     xml.Name `json:"-" xml:"oembed"`
+	Version     string   `json:"version" xml:"version"`
+	URL         string   `json:"url" xml:"url"`
+	Type        LinkType `json:"type" xml:"type"`
+	Provider    Provider `json:"provider_name" xml:"provider_name"`
+	ProviderURL string   `json:"provider_url" xml:"provider_url"`
+	Title       string   `json:"title" xml:"title"`
+	AuthorName  string   `json:"author_name" xml:"author_name"`
+	AuthorURL   string   `json:"author_url" xml:"author_url"`
+	// How long the response may be cached, in seconds
+	CacheAge StringInt `json:"cache_age" xml:"cache_age"`
+	// Required for photo, video and rich types
+	Width  StringInt `json:"width" xml:"width"`
+	Height StringInt `json:"height" xml:"height"`
+	// The embed code of video and rich types. Must be sanitized before being displayed
+	HTML            string    `json:"html" xml:"html"`
+	ThumbnailURL    string    `json:"thumbnail_url" xml:"thumbnail_url"`
+	ThumbnailWidth  StringInt `json:"thumbnail_width" xml:"thumbnail_width"`
+	ThumbnailHeight StringInt `json:"thumbnail_height" xml:"thumbnail_height"`
+	Duration        int       `json:"duration" xml:"duration"`
+	// The canonical page of the link. Not part of oEmbed 1.0 but returned by some providers (Flickr)
+	// The HTML fetcher reads it from og:url or the canonical link of pages
+	WebPage string `json:"web_page" xml:"web_page"`
 }
 
 // Fetcher uses the oEmbed protocol to fetch properties of a link
 type Fetcher interface {
-	Fetch(rawURL string) (*Link, error)
+	// Fetch returns the properties of a link
+	// Calls to providers are abandoned when the context is done
+	Fetch(ctx context.Context, rawURL string) (*Link, error)
+}
+
+// FetcherOptions configures the HTTP calls of fetchers
+type FetcherOptions struct {
+	// Client makes the calls. A shared client with a 10s timeout is used if nil. The one of
+	// the HTML fetcher refuses private addresses
+	// Tests can set one calling an httptest.Server or with a custom transport
+	Client *http.Client
+}
+
+// DefaultFetcherOptions are sensible options for production
+var DefaultFetcherOptions = FetcherOptions{}
+
+// client returns the HTTP client of the options
+func (opts FetcherOptions) client() *http.Client {
+	if opts.Client == nil {
+		return httpClient
+	}
+	return opts.Client
 }
 
 // ProvidersURL is the url where the providers list is located
@@ -61,111 +107,173 @@ const ProvidersURL = "https://oembed.com/providers.json"
 // based on the https://github.com/dyatlov/go-oembed library
 // We confine this dependency here. It should not be referenced outside this package
 type fetcher struct {
-	oe     *oembed.Oembed
-	logger log.FieldLogger
+	registry Registry
+	// operator-defined providers. nil if none
+	custom *providerSet
+	// Authorization headers of the custom providers, by provider name
+	authHeaders map[string]string
+	limiter     RateLimiter
+	client      *http.Client
+	logger      log.FieldLogger
 }
 
 // NewFetcher returns a default fetch implementation
-// This function loads the provider list from an URL
-// For this reason it might fail
-func NewFetcher(logger log.FieldLogger) (Fetcher, error) {
-	providers, err := getProviders()
-	if err != nil {
-		return nil, err
+// Custom providers take precedence over the ones of the registry. It fails if they are invalid
+// Providers are looked up in the registry at each call so that reloads are taken into account
+// Calls are rate limited by provider name
+func NewFetcher(registry Registry, custom []CustomProvider, limiter RateLimiter, logger log.FieldLogger, opts FetcherOptions) (Fetcher, error) {
+	f := &fetcher{
+		registry:    registry,
+		authHeaders: map[string]string{},
+		limiter:     limiter,
+		client:      opts.client(),
+		logger:      logger,
 	}
 
-	oe := oembed.NewOembed()
-	oe.ParseProviders(providers)
-
-	return &fetcher{
-		oe:     oe,
-		logger: logger,
-	}, nil
-}
+	if len(custom) > 0 {
+		set, err := customProviderSet(custom)
+		if err != nil {
+			return nil, err
+		}
+		f.custom = set
 
-func getProviders() (io.Reader, error) {
-	req, err := http.NewRequest("GET", ProvidersURL, nil)
-	if err != nil {
-		return nil, err
+		for _, p := range custom {
+			if p.AuthHeader != "" {
+				f.authHeaders[p.Name] = p.AuthHeader
+			}
+		}
 	}
 
-	client := http.Client{Timeout: 10 * time.Second}
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	return res.Body, err
+	return f, nil
 }
 
 // Fetch implements the Fetcher interface
-func (f *fetcher) Fetch(rawURL string) (*Link, error) {
-	item := f.oe.FindItem(rawURL)
+func (f *fetcher) Fetch(ctx context.Context, rawURL string) (*Link, error) {
+	headers := map[string]string{}
+
+	var item *oembed.Item
+	if f.custom != nil {
+		item = f.custom.oe.FindItem(rawURL)
+	}
+	if item != nil {
+		if authHeader, ok := f.authHeaders[item.ProviderName]; ok {
+			headers["Authorization"] = authHeader
+		}
+	} else {
+		item = f.registry.find(rawURL)
+	}
+
 	if item == nil {
-		return nil, &NotFoundError{err: errors.New("URL not found")}
+		return nil, &UnknownProviderError{URL: rawURL}
 	}
 
 	// We're interrested in getting the duration field which is non-standard
 	// it is not managed by the library so we have to handle the rest of the process manually
-	// (but still using the library to parse url shemes)
-	fullURL := fmt.Sprintf("%s?format=json&url=%s", item.EndpointURL, escapeURL(rawURL))
+	// (but still using the library to parse url shemes and build the endpoint URL)
+	fullURL := item.ComposeURL(rawURL)
+
+	link, err := f.call(ctx, item.ProviderName, fullURL, headers)
+	if _, ok := err.(*FormatNotImplementedError); ok {
+		// the provider only supports XML
+		link, err = f.call(ctx, item.ProviderName, xmlURL(fullURL), headers)
+	}
+	return link, err
+}
+
+func (f *fetcher) call(ctx context.Context, provider, fullURL string, headers map[string]string) (*Link, error) {
+	if err := f.limiter.Wait(ctx, provider); err != nil {
+		return nil, err
+	}
+
 	f.logger.WithField("url", fullURL).Info("fetching URL...")
 
-	body, err := apiCall(fullURL)
+	body, contentType, err := apiCall(ctx, f.client, provider, fullURL, headers)
 	if err != nil {
 		return nil, err
 	}
 
 	f.logger.WithField("body", string(body)).Debug("provider's response")
 
+	return parseLink(body, contentType)
+}
+
+// parseLink parses an oEmbed response
+// Some providers do not set the content type properly so we look at the body too
+func parseLink(body []byte, contentType string) (*Link, error) {
 	var l Link
-	if err := json.Unmarshal(body, &l); err != nil {
-		return nil, err
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	isXML := strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml") ||
+		bytes.HasPrefix(bytes.TrimSpace(body), []byte("<"))
+
+	if isXML {
+		if err := xml.Unmarshal(body, &l); err != nil {
+			return nil, &MalformedResponseError{err: err}
+		}
+		return &l, nil
 	}
 
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, &MalformedResponseError{err: err}
+	}
 	return &l, nil
 }
 
-func escapeURL(rawURL string) string {
-	// Escape the URL
-	u, err := url.Parse(rawURL)
+// xmlURL converts the URL of a JSON oEmbed call to the URL of the same call in XML
+// The format is either a query parameter or the extension of the endpoint
+func xmlURL(fullURL string) string {
+	u, err := url.Parse(fullURL)
 	if err != nil {
-		// go is very picky about compliance of URL formats
-		// it might work even if the URL is not escaped. It worth trying
-		return rawURL
+		return fullURL
+	}
+
+	if strings.HasSuffix(u.Path, ".json") {
+		u.Path = strings.TrimSuffix(u.Path, ".json") + ".xml"
 	}
+
+	query := u.Query()
+	query.Set("format", "xml")
+	u.RawQuery = query.Encode()
+
 	return u.String()
 }
 
-func apiCall(fullURL string) ([]byte, error) {
+// httpClient is shared by default so that connections to providers are reused
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// maxResponseSize is the number of bytes accepted from an oEmbed API. Responses are a few KB
+const maxResponseSize = 1 << 20
+
+// apiCall calls an oEmbed API. It returns the body and the content type of the response
+// The provider name is only used in errors
+func apiCall(ctx context.Context, client *http.Client, provider, fullURL string, headers map[string]string) ([]byte, string, error) {
 	req, err := http.NewRequest("GET", fullURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json, text/xml;q=0.9")
+	for name, value := range headers {
+		req.Header.Set(name, value)
 	}
 
-	client := http.Client{Timeout: 10 * time.Second}
 	res, err := client.Do(req)
 	if err != nil {
-		return nil, err
-	}
-	switch {
-	case res.StatusCode == 404:
-		return nil, &NotFoundError{err: errors.New("URL not found")}
-	case res.StatusCode >= 300:
-		// TODO: error management is super basic here. Should be improved
-		return nil, fmt.Errorf("provider returned a %d status code", res.StatusCode)
+		return nil, "", transportError(ctx, fullURL, err)
 	}
-
 	defer res.Body.Close()
-	return ioutil.ReadAll(res.Body)
-}
 
-// NotFoundError is retured when no info was found for this URL
-type NotFoundError struct {
-	err error
-}
+	if err := statusError(res, provider); err != nil {
+		return nil, "", err
+	}
 
-// Error implements the Error interface
-func (err *NotFoundError) Error() string {
-	return err.err.Error()
+	// one more byte tells truncated responses apart
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, "", transportError(ctx, fullURL, err)
+	}
+	if len(body) > maxResponseSize {
+		return nil, "", &MalformedResponseError{err: fmt.Errorf("the response exceeds %d bytes", maxResponseSize)}
+	}
+	return body, res.Header.Get("Content-Type"), nil
 }
@@ -0,0 +1,207 @@
+package oembed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fullLink = Link{
+	Version:         "1.0",
+	Type:            LinkTypeVideo,
+	Provider:        ProviderVimeo,
+	ProviderURL:     "https://vimeo.com/",
+	Title:           "A video",
+	AuthorName:      "Jane Doe",
+	AuthorURL:       "https://vimeo.com/jane",
+	CacheAge:        3600,
+	Width:           640,
+	Height:          360,
+	HTML:            `<iframe src="https://player.vimeo.com/video/1"></iframe>`,
+	ThumbnailURL:    "https://i.vimeocdn.com/video/1.jpg",
+	ThumbnailWidth:  295,
+	ThumbnailHeight: 166,
+	Duration:        95,
+}
+
+const fullJSON = `{
+	"version": "1.0",
+	"type": "video",
+	"provider_name": "Vimeo",
+	"provider_url": "https://vimeo.com/",
+	"title": "A video",
+	"author_name": "Jane Doe",
+	"author_url": "https://vimeo.com/jane",
+	"cache_age": "3600",
+	"width": 640,
+	"height": 360,
+	"html": "<iframe src=\"https://player.vimeo.com/video/1\"></iframe>",
+	"thumbnail_url": "https://i.vimeocdn.com/video/1.jpg",
+	"thumbnail_width": 295,
+	"thumbnail_height": 166,
+	"duration": 95
+}`
+
+const fullXML = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<oembed>
+	<version>1.0</version>
+	<type>video</type>
+	<provider_name>Vimeo</provider_name>
+	<provider_url>https://vimeo.com/</provider_url>
+	<title>A video</title>
+	<author_name>Jane Doe</author_name>
+	<author_url>https://vimeo.com/jane</author_url>
+	<cache_age>3600</cache_age>
+	<width>640</width>
+	<height>360</height>
+	<html>&lt;iframe src="https://player.vimeo.com/video/1"&gt;&lt;/iframe&gt;</html>
+	<thumbnail_url>https://i.vimeocdn.com/video/1.jpg</thumbnail_url>
+	<thumbnail_width>295</thumbnail_width>
+	<thumbnail_height>166</thumbnail_height>
+	<duration>95</duration>
+</oembed>`
+
+func TestParseLink(t *testing.T) {
+	fixtures := []struct {
+		body        string
+		contentType string
+	}{
+		{fullJSON, "application/json"},
+		{fullJSON, ""},
+		{fullXML, "text/xml; charset=utf-8"},
+		// wrong content type
+		{fullXML, "text/html"},
+	}
+
+	for _, fixture := range fixtures {
+		link, err := parseLink([]byte(fixture.body), fixture.contentType)
+		if assert.NoError(t, err) {
+			link.XMLName.Local = ""
+			assert.Equal(t, fullLink, *link)
+		}
+	}
+
+	_, err := parseLink([]byte(`<oembed><width>wide</width></oembed>`), "text/xml")
+	assert.Error(t, err)
+}
+
+func TestXMLURL(t *testing.T) {
+	fixtures := map[string]string{
+		"https://vimeo.com/api/oembed.json?format=json&url=https%3A%2F%2Fvimeo.com%2F1": "https://vimeo.com/api/oembed.xml?format=xml&url=https%3A%2F%2Fvimeo.com%2F1",
+		"https://example.com/oembed?url=https%3A%2F%2Fexample.com%2F1&format=json":      "https://example.com/oembed?format=xml&url=https%3A%2F%2Fexample.com%2F1",
+	}
+
+	for input, expected := range fixtures {
+		assert.Equal(t, expected, xmlURL(input))
+	}
+}
+
+func TestFetcherFallsBackToXML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "xml" {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, fullXML)
+	}))
+	defer server.Close()
+
+	source := filepath.Join(t.TempDir(), "providers.json")
+	writeFile(t, source, fmt.Sprintf(`[{"provider_name": "XML only", "endpoints": [{"schemes": ["https://videos.example.com/*"], "url": %q}]}]`, server.URL+"/oembed"))
+	reg, err := NewRegistry(RegistryOptions{Source: source}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	f, _ := NewFetcher(reg, nil, noRateLimit, testLogger(), DefaultFetcherOptions)
+	link, err := f.Fetch(context.Background(), "https://videos.example.com/1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "A video", link.Title)
+		assert.Equal(t, StringInt(3600), link.CacheAge)
+	}
+}
+
+// redirectTransport sends all the requests to a test server, whatever their host
+type redirectTransport struct {
+	server *httptest.Server
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(t.server.URL)
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestFetcherWithCustomClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"type": "video", "title": "Served by %s"}`, r.Host)
+	}))
+	defer server.Close()
+
+	source := filepath.Join(t.TempDir(), "providers.json")
+	writeFile(t, source, testProviders)
+	reg, err := NewRegistry(RegistryOptions{Source: source}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// the provider endpoint is on the internet, the call is not
+	client := &http.Client{Transport: redirectTransport{server: server}}
+	f, _ := NewFetcher(reg, nil, noRateLimit, testLogger(), FetcherOptions{Client: client})
+	link, err := f.Fetch(context.Background(), "https://vimeo.com/1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Served by vimeo.com", link.Title)
+	}
+}
+
+func TestFetcherRejectsHugeResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"type": "video", "title": "%s"}`, strings.Repeat("a", maxResponseSize))
+	}))
+	defer server.Close()
+
+	source := filepath.Join(t.TempDir(), "providers.json")
+	writeFile(t, source, testProviders)
+	reg, err := NewRegistry(RegistryOptions{Source: source}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	client := &http.Client{Transport: redirectTransport{server: server}}
+	f, _ := NewFetcher(reg, nil, noRateLimit, testLogger(), FetcherOptions{Client: client})
+	_, err = f.Fetch(context.Background(), "https://vimeo.com/1")
+	assert.IsType(t, &MalformedResponseError{}, err)
+}
+
+func TestFetchIsCancellable(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	f := NewHTMLFetcher(noRateLimit, testLogger(), FetcherOptions{Client: server.Client()})
+	start := time.Now()
+	_, err := f.Fetch(ctx, server.URL+"/slow")
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < 5*time.Second, time.Since(start).String())
+}
@@ -0,0 +1,145 @@
+package oembed
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the number of calls made to each provider
+// so that background jobs cannot get us throttled or banned
+type RateLimiter interface {
+	// Wait blocks until a call to the provider is allowed
+	// It returns a RateLimitError instead if the wait would be too long,
+	// or the error of the context if it is done first
+	Wait(ctx context.Context, provider string) error
+}
+
+// RateLimitOptions configures the rate limiter
+type RateLimitOptions struct {
+	// Rate is the number of calls per second allowed per provider. No limit if zero
+	Rate float64
+	// Burst is the number of calls that can be made at once after a quiet period
+	Burst int
+	// MaxWait is how long a call can wait for its turn
+	MaxWait time.Duration
+}
+
+// DefaultRateLimitOptions are sensible options for production
+var DefaultRateLimitOptions = RateLimitOptions{
+	Rate:    1,
+	Burst:   5,
+	MaxWait: 30 * time.Second,
+}
+
+// maxBuckets limits the memory used by the limiter. Pages are limited by host so there
+// might be a lot of them. Full buckets are forgotten beyond this number
+const maxBuckets = 10000
+
+// bucket is a token bucket. A call consumes a token. Tokens are added at the rate of the limiter
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	opts RateLimitOptions
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewRateLimiter returns a token bucket rate limiter. Each provider has its own bucket
+func NewRateLimiter(opts RateLimitOptions) RateLimiter {
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	return &rateLimiter{opts: opts, buckets: map[string]*bucket{}}
+}
+
+// Wait implements the RateLimiter interface
+func (l *rateLimiter) Wait(ctx context.Context, provider string) error {
+	if l.opts.Rate <= 0 {
+		return ctx.Err()
+	}
+
+	delay, ok := l.reserve(provider)
+	if !ok {
+		return &RateLimitError{Provider: provider, RetryAfter: delay}
+	}
+
+	// the token is lost if the context is done first. It does not matter much
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait for it to be available
+// Nothing is taken if the wait would be longer than allowed
+func (l *rateLimiter) reserve(provider string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[provider]
+	if !ok {
+		l.prune(now)
+		b = &bucket{tokens: float64(l.opts.Burst), last: now}
+		l.buckets[provider] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.opts.Rate
+	if b.tokens > float64(l.opts.Burst) {
+		b.tokens = float64(l.opts.Burst)
+	}
+	b.last = now
+
+	var delay time.Duration
+	if b.tokens < 1 {
+		delay = time.Duration((1 - b.tokens) / l.opts.Rate * float64(time.Second))
+	}
+	if delay > l.opts.MaxWait {
+		return delay, false
+	}
+
+	b.tokens--
+	return delay, true
+}
+
+// prune forgets the buckets that are full again. Must be called with the lock held
+func (l *rateLimiter) prune(now time.Time) {
+	if len(l.buckets) < maxBuckets {
+		return
+	}
+
+	for provider, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.opts.Rate >= float64(l.opts.Burst) {
+			delete(l.buckets, provider)
+		}
+	}
+}
+
+// RateLimitError is returned when too many calls are made to a provider
+// It is a transient error: the call can be retried later
+type RateLimitError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+// Error implements the Error interface
+func (err *RateLimitError) Error() string {
+	return fmt.Sprintf("too many calls to %s, retry in %s", err.Provider, err.RetryAfter.Round(time.Second))
+}
+
+// Retryable implements the retryable interface
+// Calls are allowed again after RetryAfter
+func (err *RateLimitError) Retryable() bool {
+	return true
+}
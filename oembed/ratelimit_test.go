@@ -0,0 +1,68 @@
+package oembed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(RateLimitOptions{Rate: 10, Burst: 2, MaxWait: 150 * time.Millisecond}).(*rateLimiter)
+
+	// the burst is available right away
+	for i := 0; i < 2; i++ {
+		delay, ok := l.reserve("Vimeo")
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(0), delay)
+	}
+
+	// then a token every 100ms
+	delay, ok := l.reserve("Vimeo")
+	assert.True(t, ok)
+	assert.InDelta(t, 100*time.Millisecond, delay, float64(10*time.Millisecond))
+
+	// the wait would be too long
+	_, ok = l.reserve("Vimeo")
+	assert.False(t, ok)
+	err := l.Wait(context.Background(), "Vimeo")
+	if assert.IsType(t, &RateLimitError{}, err) {
+		assert.Equal(t, "Vimeo", err.(*RateLimitError).Provider)
+	}
+
+	// each provider has its own bucket
+	delay, ok = l.reserve("Flickr")
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), delay)
+}
+
+func TestRateLimiterWaits(t *testing.T) {
+	l := NewRateLimiter(RateLimitOptions{Rate: 20, Burst: 1, MaxWait: time.Second})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, l.Wait(context.Background(), "Vimeo"))
+	}
+	// the first call is free, then 50ms per call
+	assert.True(t, time.Since(start) >= 90*time.Millisecond, time.Since(start).String())
+}
+
+func TestNoRateLimit(t *testing.T) {
+	l := NewRateLimiter(RateLimitOptions{})
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, l.Wait(context.Background(), "Vimeo"))
+	}
+}
+
+func TestRateLimiterWaitIsCancellable(t *testing.T) {
+	l := NewRateLimiter(RateLimitOptions{Rate: 1, Burst: 1, MaxWait: time.Minute})
+	assert.NoError(t, l.Wait(context.Background(), "Vimeo"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.Equal(t, context.DeadlineExceeded, l.Wait(ctx, "Vimeo"))
+	assert.True(t, time.Since(start) < 500*time.Millisecond, time.Since(start).String())
+}
@@ -0,0 +1,254 @@
+package oembed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dyatlov/go-oembed/oembed"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProviderDefinition describes a provider as in https://oembed.com/providers.json
+type ProviderDefinition struct {
+	Name      string               `json:"provider_name"`
+	URL       string               `json:"provider_url"`
+	Endpoints []EndpointDefinition `json:"endpoints"`
+}
+
+// EndpointDefinition describes an API endpoint of a provider and the URLs it supports
+type EndpointDefinition struct {
+	URL     string   `json:"url"`
+	Schemes []string `json:"schemes,omitempty"`
+}
+
+// Registry holds the list of known providers
+// The list can be reloaded while the application is running
+type Registry interface {
+	// Providers returns the loaded providers
+	Providers() []ProviderDefinition
+	// LoadedAt tells when the providers were loaded
+	LoadedAt() time.Time
+	// Reload loads the providers again. The current ones are kept if it fails
+	Reload() error
+	// Start reloads the providers periodically
+	Start()
+	// Stop stops reloading the providers
+	Stop()
+
+	// find returns the library item matching an URL or nil
+	find(rawURL string) *oembed.Item
+}
+
+// RegistryOptions configures the provider registry
+type RegistryOptions struct {
+	// Source is the URL or the local path of the providers list
+	Source string
+	// CachePath is where the last list downloaded successfully is stored
+	// It is used at boot when the source is not available. No cache if empty
+	CachePath string
+	// RefreshInterval is how often the list is reloaded. Never reloaded if zero
+	RefreshInterval time.Duration
+}
+
+// providerSet is an immutable snapshot of the registry
+type providerSet struct {
+	oe        *oembed.Oembed
+	providers []ProviderDefinition
+	loadedAt  time.Time
+}
+
+type registry struct {
+	opts   RegistryOptions
+	logger log.FieldLogger
+
+	// holds a *providerSet. Swapped atomically on reload
+	current atomic.Value
+
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewRegistry loads the providers from the source, or from the cache if the source is not available
+// It fails if no providers could be loaded at all
+func NewRegistry(opts RegistryOptions, logger log.FieldLogger) (Registry, error) {
+	reg := &registry{
+		opts:   opts,
+		logger: logger,
+		quit:   make(chan struct{}),
+	}
+
+	if err := reg.Reload(); err != nil {
+		if opts.CachePath == "" {
+			return nil, err
+		}
+
+		logger.WithError(err).Warning("could not load oEmbed providers, falling back to the cache")
+
+		raw, cacheErr := ioutil.ReadFile(opts.CachePath)
+		if cacheErr != nil {
+			return nil, fmt.Errorf("%s (no usable cache: %s)", err, cacheErr)
+		}
+
+		set, cacheErr := parseProviders(raw)
+		if cacheErr != nil {
+			return nil, fmt.Errorf("%s (no usable cache: %s)", err, cacheErr)
+		}
+		reg.current.Store(set)
+	}
+
+	return reg, nil
+}
+
+func (reg *registry) set() *providerSet {
+	return reg.current.Load().(*providerSet)
+}
+
+// Providers implements the Registry interface
+func (reg *registry) Providers() []ProviderDefinition {
+	return reg.set().providers
+}
+
+// LoadedAt implements the Registry interface
+func (reg *registry) LoadedAt() time.Time {
+	return reg.set().loadedAt
+}
+
+func (reg *registry) find(rawURL string) *oembed.Item {
+	return reg.set().oe.FindItem(rawURL)
+}
+
+// Reload implements the Registry interface
+func (reg *registry) Reload() error {
+	raw, err := readSource(reg.opts.Source)
+	if err != nil {
+		return err
+	}
+
+	set, err := parseProviders(raw)
+	if err != nil {
+		return err
+	}
+	reg.current.Store(set)
+
+	reg.logger.WithField("source", reg.opts.Source).Infof("%d oEmbed providers loaded", len(set.providers))
+
+	if reg.opts.CachePath != "" {
+		if err := writeCache(reg.opts.CachePath, raw); err != nil {
+			// not a big deal, the providers are loaded
+			reg.logger.WithError(err).Warning("could not cache oEmbed providers")
+		}
+	}
+
+	return nil
+}
+
+// Start implements the Registry interface
+func (reg *registry) Start() {
+	if reg.opts.RefreshInterval <= 0 {
+		return
+	}
+
+	reg.wg.Add(1)
+	go func() {
+		defer reg.wg.Done()
+
+		ticker := time.NewTicker(reg.opts.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-reg.quit:
+				return
+			case <-ticker.C:
+				if err := reg.Reload(); err != nil {
+					reg.logger.WithError(err).Warning("could not reload oEmbed providers, keeping the current ones")
+				}
+			}
+		}
+	}()
+}
+
+// Stop implements the Registry interface
+func (reg *registry) Stop() {
+	reg.stopOnce.Do(func() { close(reg.quit) })
+	reg.wg.Wait()
+}
+
+// readSource downloads the providers list or reads it from a local file
+func readSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+
+	res, err := httpClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned a %d status code", source, res.StatusCode)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// parseProviders builds a snapshot from a providers list
+// An empty list is considered as an error. It is most likely a broken download
+func parseProviders(raw []byte) (set *providerSet, err error) {
+	var providers []ProviderDefinition
+	if err := json.Unmarshal(raw, &providers); err != nil {
+		return nil, fmt.Errorf("invalid providers list: %s", err)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("empty providers list")
+	}
+
+	// the library panics on schemes it cannot convert to a regexp
+	defer func() {
+		if r := recover(); r != nil {
+			set, err = nil, fmt.Errorf("invalid providers list: %v", r)
+		}
+	}()
+
+	oe := oembed.NewOembed()
+	if err := oe.ParseProviders(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid providers list: %s", err)
+	}
+
+	return &providerSet{
+		oe:        oe,
+		providers: providers,
+		loadedAt:  time.Now(),
+	}, nil
+}
+
+// writeCache replaces the cache file atomically so that a crash cannot corrupt it
+func writeCache(path string, raw []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,100 @@
+package oembed
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const testProviders = `[
+	{
+		"provider_name": "Vimeo",
+		"provider_url": "https://vimeo.com/",
+		"endpoints": [
+			{
+				"schemes": ["https://vimeo.com/*"],
+				"url": "https://vimeo.com/api/oembed.{format}"
+			}
+		]
+	}
+]`
+
+func testLogger() log.FieldLogger {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
+
+// noRateLimit lets the tests call their fake providers as fast as they want
+var noRateLimit = NewRateLimiter(RateLimitOptions{})
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryLoadsLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "providers.json")
+	cache := filepath.Join(dir, "cache.json")
+	writeFile(t, source, testProviders)
+
+	reg, err := NewRegistry(RegistryOptions{Source: source, CachePath: cache}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	providers := reg.Providers()
+	if assert.Len(t, providers, 1) {
+		assert.Equal(t, "Vimeo", providers[0].Name)
+		assert.Equal(t, []string{"https://vimeo.com/*"}, providers[0].Endpoints[0].Schemes)
+	}
+	assert.NotNil(t, reg.find("https://vimeo.com/123"))
+	assert.Nil(t, reg.find("https://www.flickr.com/photos/123"))
+
+	cached, err := ioutil.ReadFile(cache)
+	assert.NoError(t, err)
+	assert.Equal(t, testProviders, string(cached))
+}
+
+func TestRegistryFallsBackToCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "cache.json")
+	writeFile(t, cache, testProviders)
+
+	reg, err := NewRegistry(RegistryOptions{Source: filepath.Join(dir, "missing.json"), CachePath: cache}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.NotNil(t, reg.find("https://vimeo.com/123"))
+
+	// no cache at all
+	_, err = NewRegistry(RegistryOptions{Source: filepath.Join(dir, "missing.json")}, testLogger())
+	assert.Error(t, err)
+}
+
+func TestRegistryKeepsProvidersOnFailedReload(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "providers.json")
+	writeFile(t, source, testProviders)
+
+	reg, err := NewRegistry(RegistryOptions{Source: source}, testLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for _, invalid := range []string{`not json`, `[]`, `[{"provider_name": "Broken", "endpoints": [{"schemes": ["https://example.com/(*"]}]}]`} {
+		writeFile(t, source, invalid)
+		assert.Error(t, reg.Reload())
+		assert.NotNil(t, reg.find("https://vimeo.com/123"))
+	}
+
+	writeFile(t, source, `[{"provider_name": "Flickr", "provider_url": "https://www.flickr.com/", "endpoints": [{"schemes": ["https://www.flickr.com/photos/*"], "url": "https://www.flickr.com/services/oembed/"}]}]`)
+	assert.NoError(t, reg.Reload())
+	assert.Nil(t, reg.find("https://vimeo.com/123"))
+	assert.NotNil(t, reg.find("https://www.flickr.com/photos/123"))
+}
@@ -0,0 +1,166 @@
+package oembed
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// allowedTags are the elements kept by SanitizeHTML with their allowed attributes
+// Embed codes are mostly an iframe, sometimes a blockquote with a fallback link
+var allowedTags = map[string][]string{
+	"iframe":     {"src", "width", "height", "title", "allow", "allowfullscreen", "frameborder", "scrolling"},
+	"img":        {"src", "alt", "title", "width", "height"},
+	"video":      {"src", "poster", "width", "height", "controls", "loop", "muted", "playsinline"},
+	"audio":      {"src", "controls", "loop"},
+	"source":     {"src", "type"},
+	"a":          {"href", "title"},
+	"blockquote": {"cite"},
+	"p":          nil,
+	"div":        nil,
+	"span":       nil,
+	"br":         nil,
+	"em":         nil,
+	"strong":     nil,
+	"b":          nil,
+	"i":          nil,
+	"figure":     nil,
+	"figcaption": nil,
+	"ul":         nil,
+	"ol":         nil,
+	"li":         nil,
+}
+
+// voidTags have no closing tag
+var voidTags = map[string]bool{"img": true, "br": true, "source": true}
+
+// urlAttributes must be absolute http(s) URLs. Relative URLs would point to this application
+var urlAttributes = map[string]bool{"src": true, "href": true, "poster": true, "cite": true}
+
+// droppedContent are the elements removed along with their content
+var droppedContent = []string{"script", "style", "noscript", "template", "textarea", "title", "object", "embed"}
+
+// SanitizeHTML keeps the harmless parts of an embed code returned by a provider
+// Elements and attributes that are not explicitly allowed are removed, including scripts,
+// event handlers and styles. Text is escaped again so that the output is well formed
+// The result should still be displayed in a sandboxed iframe: players need their scripts
+func SanitizeHTML(embed string) string {
+	var out strings.Builder
+	lower := asciiLower(embed)
+	// the allowed elements that are open, to close them at the end
+	open := []string{}
+
+	for i := 0; i < len(embed); {
+		lt := strings.IndexByte(embed[i:], '<')
+		if lt < 0 {
+			out.WriteString(html.EscapeString(html.UnescapeString(embed[i:])))
+			break
+		}
+		out.WriteString(html.EscapeString(html.UnescapeString(embed[i : i+lt])))
+		i += lt
+
+		if strings.HasPrefix(embed[i:], "<!--") {
+			end := strings.Index(embed[i:], "-->")
+			if end < 0 {
+				break
+			}
+			i += end + len("-->")
+			continue
+		}
+
+		if strings.HasPrefix(embed[i:], "</") {
+			end := strings.IndexByte(embed[i:], '>')
+			if end < 0 {
+				break
+			}
+			name := asciiLower(strings.TrimSpace(embed[i+2 : i+end]))
+			i += end + 1
+
+			// only close the elements we opened
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j] == name {
+					for _, tag := range reverse(open[j:]) {
+						out.WriteString("</" + tag + ">")
+					}
+					open = open[:j]
+					break
+				}
+			}
+			continue
+		}
+
+		name, attrs, next := parseTag(embed, i)
+		i = next
+
+		if isDroppedContent(name) {
+			end := strings.Index(lower[i:], "</"+name)
+			if end < 0 {
+				break
+			}
+			i += end
+			continue
+		}
+
+		allowed, ok := allowedTags[name]
+		if !ok {
+			continue
+		}
+
+		out.WriteString("<" + name)
+		for _, attr := range allowed {
+			value, ok := attrs[attr]
+			if !ok {
+				continue
+			}
+			if urlAttributes[attr] && !isWebURL(value) {
+				continue
+			}
+			out.WriteString(" " + attr + `="` + html.EscapeString(value) + `"`)
+		}
+		if name == "a" {
+			// links open outside the embed
+			out.WriteString(` target="_blank" rel="noopener noreferrer"`)
+		}
+		out.WriteString(">")
+
+		if !voidTags[name] {
+			open = append(open, name)
+		}
+	}
+
+	for _, tag := range reverse(open) {
+		out.WriteString("</" + tag + ">")
+	}
+
+	return out.String()
+}
+
+func isDroppedContent(name string) bool {
+	for _, tag := range droppedContent {
+		if name == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// isWebURL tells if an URL is absolute and uses http or https
+// Protocol relative URLs (//player.vimeo.com) are common in embed codes so they are accepted
+func isWebURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		return strings.HasPrefix(strings.TrimSpace(raw), "//") && u.Host != ""
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func reverse(tags []string) []string {
+	reversed := make([]string, len(tags))
+	for i, tag := range tags {
+		reversed[len(tags)-1-i] = tag
+	}
+	return reversed
+}
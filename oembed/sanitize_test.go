@@ -0,0 +1,59 @@
+package oembed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	fixtures := map[string]struct {
+		embed    string
+		expected string
+	}{
+		"vimeo iframe": {
+			`<iframe src="https://player.vimeo.com/video/1" width="640" height="360" frameborder="0" allow="autoplay; fullscreen" allowfullscreen></iframe>`,
+			`<iframe src="https://player.vimeo.com/video/1" width="640" height="360" allow="autoplay; fullscreen" allowfullscreen="" frameborder="0"></iframe>`,
+		},
+		"protocol relative URL": {
+			`<iframe src="//www.youtube.com/embed/1"></iframe>`,
+			`<iframe src="//www.youtube.com/embed/1"></iframe>`,
+		},
+		"scripts": {
+			`<blockquote class="twitter-tweet"><p>Hello &amp; welcome</p><a href="https://twitter.com/x/status/1">link</a></blockquote><script async src="https://platform.twitter.com/widgets.js"></script>`,
+			`<blockquote><p>Hello &amp; welcome</p><a href="https://twitter.com/x/status/1" target="_blank" rel="noopener noreferrer">link</a></blockquote>`,
+		},
+		"event handlers and styles": {
+			`<div onclick="alert(1)" style="position:fixed"><img src="https://example.com/1.jpg" onerror="alert(1)"></div>`,
+			`<div><img src="https://example.com/1.jpg"></div>`,
+		},
+		"dangerous URLs": {
+			`<a href="javascript:alert(1)">x</a><iframe src="data:text/html,<script>alert(1)</script>"></iframe><img src="/local">`,
+			`<a target="_blank" rel="noopener noreferrer">x</a><iframe></iframe><img>`,
+		},
+		"unknown elements": {
+			`<form action="https://evil.com"><input name="password"></form><object data="x.swf"></object><style>body{}</style>text`,
+			`text`,
+		},
+		"unclosed elements": {
+			`<div><p>text`,
+			`<div><p>text</p></div>`,
+		},
+		"stray closing tags": {
+			`</div><span>text</p></span></iframe>`,
+			`<span>text</span>`,
+		},
+		"quotes in attributes": {
+			`<img alt='"><script>alert(1)</script>' src="https://example.com/1.jpg">`,
+			`<img src="https://example.com/1.jpg" alt="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;">`,
+		},
+		"comments": {
+			`<!-- <script>alert(1)</script> --><br>`,
+			`<br>`,
+		},
+	}
+
+	for name, fixture := range fixtures {
+		assert.Equal(t, fixture.expected, SanitizeHTML(fixture.embed), name)
+	}
+}
@@ -26,6 +26,12 @@ func (s *StringInt) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	// some providers return empty strings for rich types
+	if stringVal == "" {
+		*s = 0
+		return nil
+	}
+
 	intVal, err := strconv.Atoi(stringVal)
 	if err != nil {
 		return err
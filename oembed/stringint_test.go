@@ -21,6 +21,7 @@ func TestStringInt(t *testing.T) {
 			{`{"Value":"1234"}`, 1234, false},
 			{`{"Value":"-1234"}`, -1234, false},
 			{`{"Value":"blah"}`, 0, true},
+			{`{"Value":""}`, 0, false},
 
 			// Let's accept null
 			{`{"Value":null}`, 0, false},
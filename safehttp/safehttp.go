@@ -0,0 +1,120 @@
+// Package safehttp makes HTTP calls to URLs supplied by users, like the pages and thumbnails
+// of bookmarks. Calls to the network of the server (databases, cloud metadata...) are refused
+// so that users cannot make the server reach it on their behalf (SSRF)
+package safehttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ForbiddenAddressError is returned when an URL resolves to an address of the private network
+type ForbiddenAddressError struct {
+	Address string
+}
+
+// Error implements the Error interface
+func (err *ForbiddenAddressError) Error() string {
+	return fmt.Sprintf("%s is not a public address", err.Address)
+}
+
+// InvalidURLError is returned when an URL is not a web URL
+type InvalidURLError struct {
+	URL string
+}
+
+// Error implements the Error interface
+func (err *InvalidURLError) Error() string {
+	return fmt.Sprintf("not a web URL: %s", err.URL)
+}
+
+// CheckURL parses an URL and makes sure that it is an http or https one
+func CheckURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &InvalidURLError{URL: rawURL}
+	}
+	return u, nil
+}
+
+// NewClient returns a client refusing to connect to private, loopback and link-local addresses
+// The check is made when connecting, after the name is resolved, so it also applies to
+// redirects and to names resolving to private addresses. Proxies are not used since they
+// would connect in our place
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   checkAddress,
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   timeout,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+			if _, err := CheckURL(req.URL.String()); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// checkAddress is the Control function of the dialer. address is a resolved ip:port
+func checkAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublic(ip) {
+		return &ForbiddenAddressError{Address: host}
+	}
+	return nil
+}
+
+// reservedNetworks are not covered by the net.IP predicates: carrier-grade NAT (RFC 6598)
+// and "this network" (RFC 1122), which reaches the host itself on Linux
+var reservedNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("0.0.0.0/8"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// IsPublic returns false for the addresses of the private network and the host itself
+// Unique local IPv6 addresses (fc00::/7) are private
+func IsPublic(ip net.IP) bool {
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return !(ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified())
+}
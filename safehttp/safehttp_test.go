@@ -0,0 +1,62 @@
+package safehttp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublic(t *testing.T) {
+	fixtures := map[string]bool{
+		"93.184.216.34":     true,
+		"2606:4700::1111":   true,
+		"127.0.0.1":         false,
+		"::1":               false,
+		"10.1.2.3":          false,
+		"172.16.0.1":        false,
+		"192.168.1.1":       false,
+		"169.254.169.254":   false,
+		"fe80::1":           false,
+		"fd00::1":           false,
+		"fc00::1":           false,
+		"fdff:ffff::1":      false,
+		"100.64.0.1":        false,
+		"100.127.255.254":   false,
+		"100.63.255.255":    true,
+		"100.128.0.1":       true,
+		"0.0.0.0":           false,
+		"0.1.2.3":           false,
+		"::ffff:100.64.0.1": false,
+		"::ffff:10.0.0.1":   false,
+	}
+
+	for address, expected := range fixtures {
+		assert.Equal(t, expected, IsPublic(net.ParseIP(address)), address)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	_, err := CheckURL("https://example.com/page")
+	assert.NoError(t, err)
+
+	for _, rawURL := range []string{"file:///etc/passwd", "gopher://example.com", "https://", "not a url"} {
+		_, err := CheckURL(rawURL)
+		assert.IsType(t, &InvalidURLError{}, err, rawURL)
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the server must not be called")
+	}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Get(server.URL)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "127.0.0.1 is not a public address")
+	}
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package main
+
+// The SQLite driver requires cgo so it is not part of the default build
+// Build with -tags sqlite to enable STORAGE_DRIVER=sqlite
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,216 @@
+// Package thumbnails downloads the thumbnails of bookmarks and stores a resized copy
+// so that the web interface does not depend on third party servers
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	// decoders of the supported formats
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/fchoquet/bookmarks/blobs"
+	"github.com/fchoquet/bookmarks/safehttp"
+)
+
+// Store captures and serves thumbnails
+type Store interface {
+	// Capture downloads an image, resizes it and stores it as the thumbnail of a bookmark
+	// The previous thumbnail of the bookmark is replaced. The download is abandoned when the
+	// context is done
+	Capture(ctx context.Context, bookmarkID int, imageURL string) error
+	// Open opens the thumbnail of a bookmark. The caller must close it
+	// Returns a blobs.NotFoundError if the bookmark has no thumbnail
+	Open(bookmarkID int) (*blobs.Blob, error)
+	// Delete deletes the thumbnail of a bookmark. Deleting a missing thumbnail is not an error
+	Delete(bookmarkID int) error
+}
+
+// ContentType is the content type of stored thumbnails. They are all converted to JPEG
+const ContentType = "image/jpeg"
+
+// Options configures the thumbnails
+type Options struct {
+	// MaxWidth and MaxHeight are the dimensions thumbnails must fit in
+	// The aspect ratio is preserved. Smaller images are not enlarged
+	MaxWidth  int
+	MaxHeight int
+	// MaxDownloadSize is the maximum size of a downloaded image, in bytes
+	MaxDownloadSize int64
+	// MaxPixels is the maximum number of pixels of a downloaded image
+	// Decoding huge images would use too much memory
+	MaxPixels int
+	// Client downloads the images. A shared client refusing private addresses is used if nil
+	// Tests can set one calling an httptest.Server
+	Client *http.Client
+}
+
+// DefaultOptions are sensible options for production
+var DefaultOptions = Options{
+	MaxWidth:        320,
+	MaxHeight:       320,
+	MaxDownloadSize: 10 << 20,
+	MaxPixels:       50 * 1000 * 1000,
+}
+
+// httpClient is shared by default so that connections to image servers are reused
+// Thumbnail URLs come from users and third parties so private addresses are refused
+var httpClient = safehttp.NewClient(10 * time.Second)
+
+type store struct {
+	blobs  blobs.Store
+	client *http.Client
+	opts   Options
+}
+
+// NewStore returns a store keeping thumbnails in a blob store
+func NewStore(blobs blobs.Store, opts Options) Store {
+	client := opts.Client
+	if client == nil {
+		client = httpClient
+	}
+	return &store{blobs: blobs, client: client, opts: opts}
+}
+
+func key(bookmarkID int) string {
+	return fmt.Sprintf("thumbnails/%d.jpg", bookmarkID)
+}
+
+// Capture implements the Store interface
+func (s *store) Capture(ctx context.Context, bookmarkID int, imageURL string) error {
+	raw, err := s.download(ctx, imageURL)
+	if err != nil {
+		return err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("unsupported image: %s", err)
+	}
+	if cfg.Width*cfg.Height > s.opts.MaxPixels {
+		return fmt.Errorf("image is too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("unsupported image: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Resize(img, s.opts.MaxWidth, s.opts.MaxHeight), &jpeg.Options{Quality: 85}); err != nil {
+		return err
+	}
+
+	return s.blobs.Put(key(bookmarkID), &buf)
+}
+
+// download fetches an image. It fails if the image is larger than the allowed size
+func (s *store) download(ctx context.Context, imageURL string) ([]byte, error) {
+	if _, err := safehttp.CheckURL(imageURL); err != nil {
+		return nil, fmt.Errorf("invalid thumbnail URL: %s", imageURL)
+	}
+
+	req, err := http.NewRequest("GET", imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image server returned a %d status code", res.StatusCode)
+	}
+
+	raw, err := ioutil.ReadAll(io.LimitReader(res.Body, s.opts.MaxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > s.opts.MaxDownloadSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", s.opts.MaxDownloadSize)
+	}
+
+	return raw, nil
+}
+
+// Open implements the Store interface
+func (s *store) Open(bookmarkID int) (*blobs.Blob, error) {
+	return s.blobs.Get(key(bookmarkID))
+}
+
+// Delete implements the Store interface
+func (s *store) Delete(bookmarkID int) error {
+	return s.blobs.Delete(key(bookmarkID))
+}
+
+// Resize scales an image down to fit in maxWidth x maxHeight, preserving its aspect ratio
+// Each pixel is the average of the source pixels it covers (box filter), which is good enough
+// for thumbnails. Transparent pixels are rendered over a white background since JPEG has no alpha
+func Resize(src image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if dstW > maxWidth {
+		dstW, dstH = maxWidth, dstH*maxWidth/dstW
+	}
+	if dstH > maxHeight {
+		dstW, dstH = dstW*maxHeight/dstH, maxHeight
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := bounds.Min.Y + (y+1)*srcH/dstH
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := bounds.Min.X + (x+1)*srcW/dstW
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// colors are alpha-premultiplied. Adding the missing alpha whitens them
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+
+	return dst
+}
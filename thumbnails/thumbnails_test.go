@@ -0,0 +1,92 @@
+package thumbnails
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fchoquet/bookmarks/blobs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResize(t *testing.T) {
+	cases := []struct {
+		width, height       int
+		expectedW, expected int
+	}{
+		{640, 360, 320, 180},
+		{360, 640, 180, 320},
+		{1000, 1000, 320, 320},
+		// small images are not enlarged
+		{100, 50, 100, 50},
+		{4000, 1, 320, 1},
+	}
+
+	for _, c := range cases {
+		img := Resize(image.NewRGBA(image.Rect(0, 0, c.width, c.height)), 320, 320)
+		assert.Equal(t, c.expectedW, img.Bounds().Dx(), "%dx%d", c.width, c.height)
+		assert.Equal(t, c.expected, img.Bounds().Dy(), "%dx%d", c.width, c.height)
+	}
+}
+
+func TestResizeAveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 0xff, A: 0xff})
+	// transparent pixels are white
+	src.Set(1, 0, color.RGBA{})
+
+	img := Resize(src, 1, 1)
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0x7f, B: 0x7f, A: 0xff}, img.At(0, 0))
+}
+
+func TestCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			png.Encode(w, image.NewRGBA(image.Rect(0, 0, 640, 360)))
+		case "/huge.png":
+			png.Encode(w, image.NewRGBA(image.Rect(0, 0, 2000, 2000)))
+		case "/page.html":
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	opts := DefaultOptions
+	opts.MaxPixels = 1000 * 1000
+	opts.Client = server.Client()
+	s := NewStore(blobs.NewMemoryStore(), opts)
+
+	assert.NoError(t, s.Capture(context.Background(), 1, server.URL+"/image.png"))
+	blob, err := s.Open(1)
+	if assert.NoError(t, err) {
+		defer blob.Close()
+		img, err := jpeg.Decode(blob)
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Rect(0, 0, 320, 180), img.Bounds())
+		}
+	}
+
+	assert.Error(t, s.Capture(context.Background(), 2, server.URL+"/huge.png"))
+	assert.Error(t, s.Capture(context.Background(), 2, server.URL+"/page.html"))
+	assert.Error(t, s.Capture(context.Background(), 2, server.URL+"/missing.png"))
+	assert.Error(t, s.Capture(context.Background(), 2, "file:///etc/passwd"))
+	_, err = s.Open(2)
+	assert.IsType(t, &blobs.NotFoundError{}, err)
+
+	// the default client does not call the private network
+	assert.Error(t, NewStore(blobs.NewMemoryStore(), DefaultOptions).Capture(context.Background(), 2, server.URL+"/image.png"))
+
+	assert.NoError(t, s.Delete(1))
+	_, err = s.Open(1)
+	assert.IsType(t, &blobs.NotFoundError{}, err)
+	// deleting twice is harmless
+	assert.NoError(t, s.Delete(1))
+}
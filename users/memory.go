@@ -0,0 +1,44 @@
+package users
+
+import (
+	"sync"
+)
+
+// NewMemoryRepository returns a Repository implementation storing users in memory
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		users: map[string]*User{},
+	}
+}
+
+type memoryRepository struct {
+	mu     sync.Mutex
+	lastID int
+	users  map[string]*User
+}
+
+func (rep *memoryRepository) ByName(name string) (*User, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	u, ok := rep.users[name]
+	if !ok {
+		return nil, nil
+	}
+
+	c := *u
+	return &c, nil
+}
+
+func (rep *memoryRepository) Register(name string) (*User, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, ok := rep.users[name]; !ok {
+		rep.lastID++
+		rep.users[name] = &User{ID: rep.lastID, Name: name}
+	}
+
+	c := *rep.users[name]
+	return &c, nil
+}
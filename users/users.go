@@ -0,0 +1,71 @@
+package users
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// User represents an authenticated user owning bookmarks
+// Credentials are not stored here. They come from the application configuration
+type User struct {
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+}
+
+// Repository stores users to a permanent storage
+type Repository interface {
+	// ByName loads a unique user by its name. returns nil if not found
+	ByName(name string) (*User, error)
+
+	// Register creates a user if it does not exist yet and returns it
+	Register(name string) (*User, error)
+}
+
+// NewRepository returns a default Repository implementation
+func NewRepository(db *sqlx.DB) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+type repository struct {
+	db *sqlx.DB
+}
+
+func (rep *repository) ByName(name string) (*User, error) {
+	var u User
+	err := rep.db.Get(&u, `SELECT id, name FROM users WHERE name = ?`, name)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (rep *repository) Register(name string) (*User, error) {
+	u, err := rep.ByName(name)
+	if err != nil || u != nil {
+		return u, err
+	}
+
+	res, err := rep.db.Exec(`INSERT INTO users (name) VALUES (?)`, name)
+	if err != nil {
+		// another instance might have registered the same user in the meantime
+		// the unique key on name protects us, so let's try to load it again
+		if u, err2 := rep.ByName(name); err2 == nil && u != nil {
+			return u, nil
+		}
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{ID: int(id), Name: name}, nil
+}